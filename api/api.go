@@ -10,11 +10,19 @@
 // @BasePath /api/
 package api
 
+import "time"
+
 const (
 	BlockingStatusPath  = "/api/blocking/status"
 	BlockingEnablePath  = "/api/blocking/enable"
 	BlockingDisablePath = "/api/blocking/disable"
 	BlockingQueryPath   = "/api/query"
+	ConfigReloadPath    = "/api/config/reload"
+	QueryLogPath        = "/api/querylog"
+	CacheStatsPath      = "/api/cache/stats"
+	CacheLookupPath     = "/api/cache/lookup"
+	CacheDeletePath     = "/api/cache/delete"
+	CacheFlushPath      = "/api/cache/flush"
 )
 
 type QueryRequest struct {
@@ -40,4 +48,88 @@ type BlockingStatus struct {
 	Enabled bool `json:"enabled"`
 	// If blocking is temporary disabled: amount of seconds until blocking will be enabled
 	AutoEnableInSec uint `json:"autoEnableInSec"`
+	// Groups with time-based schedule
+	ScheduledGroups []ScheduledGroup `json:"scheduledGroups,omitempty"`
+	// Blocking status of each group
+	Groups []BlockingTargetStatus `json:"groups,omitempty"`
+	// Clients with disabled blocking
+	DisabledClients []BlockingTargetStatus `json:"disabledClients,omitempty"`
+}
+
+type BlockingTargetStatus struct {
+	// name of the group or client
+	Name string `json:"name"`
+	// True if blocking is enabled for this group or client
+	Enabled bool `json:"enabled"`
+	// If blocking is temporary disabled: amount of seconds until blocking will be enabled
+	AutoEnableInSec uint `json:"autoEnableInSec"`
+}
+
+type ScheduledGroup struct {
+	// client of the clientGroupsBlock entry
+	Client string `json:"client"`
+	// name of the group
+	Group string `json:"group"`
+	// configured schedules (Example: "Mon,Tue 20:00-06:00 (Europe/Berlin)")
+	Schedule string `json:"schedule"`
+	// True if the group is active now
+	Active bool `json:"active"`
+}
+
+type QueryLogEntry struct {
+	// time of the request
+	Time time.Time `json:"time"`
+	// IP address of the client
+	ClientIP string `json:"clientIP"`
+	// resolved names of the client
+	ClientName string `json:"clientName"`
+	// duration of the resolution in ms
+	DurationMs int64 `json:"durationMs"`
+	// blocky reason for resolution
+	Reason string `json:"reason"`
+	// response type (CACHED, BLOCKED, ...)
+	ResponseType string `json:"responseType"`
+	// request type (A, AAAA, ...)
+	QuestionType string `json:"questionType"`
+	// queried domain
+	QuestionName string `json:"questionName"`
+	// actual DNS response
+	Answer string `json:"answer"`
+	// DNS return code (NOERROR, NXDOMAIN, ...)
+	ReturnCode string `json:"returnCode"`
+}
+
+type CacheStats struct {
+	// count of DNS cache entries (including stale entries)
+	ItemCount int `json:"itemCount"`
+	// count of DNS cache entries per query type (A, AAAA, ...)
+	ItemCountPerType map[string]int `json:"itemCountPerType"`
+	// count of expired DNS cache entries, which are kept for serve-stale
+	StaleItemCount int `json:"staleItemCount"`
+	// count of cached client names
+	ClientNamesItemCount int `json:"clientNamesItemCount"`
+}
+
+type CacheEntry struct {
+	// cached domain
+	Name string `json:"name"`
+	// query type (A, AAAA, ...)
+	Type string `json:"type"`
+	// upstream group of the entry, empty for the default group
+	Group string `json:"group,omitempty"`
+	// DNS return code (NOERROR, NXDOMAIN, ...)
+	ReturnCode string `json:"returnCode"`
+	// cached answer, empty for negative responses
+	Answer string `json:"answer"`
+	// remaining TTL in seconds, 0 for stale entries
+	RemainingTTLSec uint `json:"remainingTTLSec"`
+	// True if the entry is expired and will only be returned if the upstream resolver fails
+	Stale bool `json:"stale"`
+	// True if the entry was stored by prefetching
+	Prefetched bool `json:"prefetched"`
+}
+
+type CacheDeleteResult struct {
+	// count of deleted DNS cache entries
+	Deleted int `json:"deleted"`
 }
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -14,13 +17,15 @@ import (
 func init() {
 	rootCmd.AddCommand(blockingCmd)
 
-	blockingCmd.AddCommand(&cobra.Command{
+	enableCommand := &cobra.Command{
 		Use:     "enable",
 		Args:    cobra.NoArgs,
 		Aliases: []string{"on"},
 		Short:   "Enable blocking",
 		Run:     enableBlocking,
-	})
+	}
+	addTargetFlags(enableCommand)
+	blockingCmd.AddCommand(enableCommand)
 
 	disableCommand := &cobra.Command{
 		Use:     "disable",
@@ -30,6 +35,7 @@ func init() {
 		Run:     disableBlocking,
 	}
 	disableCommand.Flags().DurationP("duration", "d", 0, "duration in min")
+	addTargetFlags(disableCommand)
 	blockingCmd.AddCommand(disableCommand)
 
 	blockingCmd.AddCommand(&cobra.Command{
@@ -47,8 +53,35 @@ var blockingCmd = &cobra.Command{
 	Short:   "Control status of blocking resolver",
 }
 
+// adds flags to restrict the command to certain groups or clients
+func addTargetFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceP("groups", "g", nil, "groups (comma separated), default: all")
+	cmd.Flags().StringSliceP("clients", "c", nil, "clients (comma separated names, IPs, wildcards or CIDRs), default: all")
+}
+
+// returns the query parameters for groups and clients. Without command, all groups and clients are used
+func targetParams(cmd *cobra.Command) url.Values {
+	params := url.Values{}
+
+	if cmd == nil {
+		return params
+	}
+
+	if groups, _ := cmd.Flags().GetStringSlice("groups"); len(groups) > 0 {
+		params.Set("groups", strings.Join(groups, ","))
+	}
+
+	if clients, _ := cmd.Flags().GetStringSlice("clients"); len(clients) > 0 {
+		params.Set("clients", strings.Join(clients, ","))
+	}
+
+	return params
+}
+
 func enableBlocking(cmd *cobra.Command, args []string) {
-	resp, err := http.Get(apiURL(api.BlockingEnablePath))
+	params := targetParams(cmd)
+
+	resp, err := http.Get(fmt.Sprintf("%s?%s", apiURL(api.BlockingEnablePath), params.Encode()))
 	if err != nil {
 		log.Fatal("can't execute", err)
 	}
@@ -62,9 +95,15 @@ func enableBlocking(cmd *cobra.Command, args []string) {
 }
 
 func disableBlocking(cmd *cobra.Command, args []string) {
-	duration, _ := cmd.Flags().GetDuration("duration")
+	var duration time.Duration
+	if cmd != nil {
+		duration, _ = cmd.Flags().GetDuration("duration")
+	}
+
+	params := targetParams(cmd)
+	params.Set("duration", duration.String())
 
-	resp, err := http.Get(fmt.Sprintf("%s?duration=%s", apiURL(api.BlockingDisablePath), duration))
+	resp, err := http.Get(fmt.Sprintf("%s?%s", apiURL(api.BlockingDisablePath), params.Encode()))
 	if err != nil {
 		log.Fatal("can't execute", err)
 	}
@@ -104,4 +143,31 @@ func statusBlocking(cmd *cobra.Command, args []string) {
 			log.Infof("blocking disabled for %d seconds", result.AutoEnableInSec)
 		}
 	}
+
+	for _, g := range result.Groups {
+		if !g.Enabled {
+			log.Infof("blocking disabled for group '%s'%s", g.Name, autoEnableDescription(g.AutoEnableInSec))
+		}
+	}
+
+	for _, c := range result.DisabledClients {
+		log.Infof("blocking disabled for client '%s'%s", c.Name, autoEnableDescription(c.AutoEnableInSec))
+	}
+
+	for _, g := range result.ScheduledGroups {
+		state := "inactive"
+		if g.Active {
+			state = "active"
+		}
+
+		log.Infof("group '%s' of client '%s' is %s (schedule: %s)", g.Group, g.Client, state, g.Schedule)
+	}
+}
+
+func autoEnableDescription(seconds uint) string {
+	if seconds == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" for %d seconds", seconds)
 }
@@ -8,6 +8,9 @@ import (
 	"net/url"
 	"strconv"
 	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
 )
 
 func testHTTPAPIServer(fn func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
@@ -26,6 +29,31 @@ func TestEnable(t *testing.T) {
 	enableBlocking(nil, []string{})
 }
 
+func TestEnableDisableWithTargets(t *testing.T) {
+	var queries []url.Values
+
+	ts := testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+	})
+	defer ts.Close()
+
+	cmd := &cobra.Command{}
+	addTargetFlags(cmd)
+	cmd.Flags().Duration("duration", 0, "")
+	_ = cmd.Flags().Set("groups", "ads,special")
+	_ = cmd.Flags().Set("clients", "laptop")
+	_ = cmd.Flags().Set("duration", "5m")
+
+	disableBlocking(cmd, []string{})
+	enableBlocking(cmd, []string{})
+
+	assert.Len(t, queries, 2)
+	assert.Equal(t, "ads,special", queries[0].Get("groups"))
+	assert.Equal(t, "laptop", queries[0].Get("clients"))
+	assert.Equal(t, "5m0s", queries[0].Get("duration"))
+	assert.Equal(t, "ads,special", queries[1].Get("groups"))
+}
+
 func TestDisable(t *testing.T) {
 	ts := testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {})
 	defer ts.Close()
@@ -40,3 +68,17 @@ func TestStatus(t *testing.T) {
 	defer ts.Close()
 	statusBlocking(nil, []string{})
 }
+
+func TestStatusWithScheduledGroups(t *testing.T) {
+	ts := testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+		response, _ := json.Marshal(api.BlockingStatus{Enabled: true, ScheduledGroups: []api.ScheduledGroup{
+			{Client: "kids", Group: "gr1", Schedule: "Mon 20:00-06:00 (UTC)", Active: true},
+		},
+			Groups:          []api.BlockingTargetStatus{{Name: "gr1", Enabled: false, AutoEnableInSec: 10}},
+			DisabledClients: []api.BlockingTargetStatus{{Name: "laptop", Enabled: false}},
+		})
+		_, _ = w.Write(response)
+	})
+	defer ts.Close()
+	statusBlocking(nil, []string{})
+}
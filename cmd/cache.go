@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"blocky/api"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatsCmd, cacheLookupCmd, cacheDeleteCmd, cacheFlushCmd)
+	cacheDeleteCmd.Flags().BoolP("subdomains", "s", false, "delete also entries of all subdomains")
+	cacheFlushCmd.Flags().String("cache", "", "flush only this cache (dns or clientNames)")
+}
+
+//nolint:gochecknoglobals
+var (
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and flush the DNS and client name caches",
+	}
+	cacheStatsCmd = &cobra.Command{
+		Use:   "stats",
+		Args:  cobra.NoArgs,
+		Short: "Print the count of cache entries per query type",
+		Run:   cacheStats,
+	}
+	cacheLookupCmd = &cobra.Command{
+		Use:   "lookup <domain>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Print the cache entries of the domain",
+		Run:   cacheLookup,
+	}
+	cacheDeleteCmd = &cobra.Command{
+		Use:     "delete <domain>",
+		Aliases: []string{"rm"},
+		Args:    cobra.ExactArgs(1),
+		Short:   "Delete the cache entries of the domain",
+		Run:     cacheDelete,
+	}
+	cacheFlushCmd = &cobra.Command{
+		Use:   "flush",
+		Args:  cobra.NoArgs,
+		Short: "Remove all entries from the DNS and client name caches",
+		Run:   cacheFlush,
+	}
+)
+
+func cacheStats(cmd *cobra.Command, args []string) {
+	var result api.CacheStats
+
+	cacheAPIRequest(http.MethodGet, api.CacheStatsPath, url.Values{}, &result)
+
+	log.Infof("DNS cache entries: %d (stale: %d)", result.ItemCount, result.StaleItemCount)
+
+	types := make([]string, 0, len(result.ItemCountPerType))
+	for t := range result.ItemCountPerType {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	for _, t := range types {
+		log.Infof("\t%-8s %d", t, result.ItemCountPerType[t])
+	}
+
+	log.Infof("client name cache entries: %d", result.ClientNamesItemCount)
+}
+
+func cacheLookup(cmd *cobra.Command, args []string) {
+	var result []api.CacheEntry
+
+	cacheAPIRequest(http.MethodGet, api.CacheLookupPath, url.Values{"name": {args[0]}}, &result)
+
+	if len(result) == 0 {
+		log.Infof("'%s' is not cached", args[0])
+		return
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Name", "Type", "Group", "Return code", "Answer", "Remaining TTL (s)", "Stale", "Prefetched"})
+
+	for _, e := range result {
+		t.AppendRow(table.Row{e.Name, e.Type, e.Group, e.ReturnCode, e.Answer, e.RemainingTTLSec, e.Stale, e.Prefetched})
+	}
+
+	t.Render()
+}
+
+func cacheDelete(cmd *cobra.Command, args []string) {
+	params := url.Values{"name": {args[0]}}
+
+	if subdomains, _ := cmd.Flags().GetBool("subdomains"); subdomains {
+		params.Set("subdomains", "true")
+	}
+
+	var result api.CacheDeleteResult
+
+	cacheAPIRequest(http.MethodPost, api.CacheDeletePath, params, &result)
+
+	log.Infof("deleted %d cache entries", result.Deleted)
+}
+
+func cacheFlush(cmd *cobra.Command, args []string) {
+	params := url.Values{}
+
+	if cache, _ := cmd.Flags().GetString("cache"); cache != "" {
+		params.Set("cache", cache)
+	}
+
+	cacheAPIRequest(http.MethodPost, api.CacheFlushPath, params, nil)
+
+	log.Info("OK")
+}
+
+// calls the cache API endpoint and decodes the JSON response into result (if not nil)
+func cacheAPIRequest(method, path string, params url.Values, result interface{}) {
+	var (
+		resp *http.Response
+		err  error
+	)
+
+	u := fmt.Sprintf("%s?%s", apiURL(path), params.Encode())
+
+	if method == http.MethodPost {
+		resp, err = http.Post(u, "", nil)
+	} else {
+		resp, err = http.Get(u)
+	}
+
+	if err != nil {
+		log.Fatal("can't execute", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Fatalf("NOK: %s %s", resp.Status, string(body))
+	}
+
+	if result != nil {
+		if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+			log.Fatal("can't read response: ", err)
+		}
+	}
+}
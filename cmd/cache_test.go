@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"blocky/api"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheStats(t *testing.T) {
+	var path string
+
+	ts := testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		response, _ := json.Marshal(api.CacheStats{ItemCount: 2, ItemCountPerType: map[string]int{"A": 1, "MX": 1}})
+		_, _ = w.Write(response)
+	})
+	defer ts.Close()
+
+	cacheStats(cacheStatsCmd, []string{})
+
+	assert.Equal(t, api.CacheStatsPath, path)
+}
+
+func TestCacheLookup(t *testing.T) {
+	var query string
+
+	ts := testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		response, _ := json.Marshal([]api.CacheEntry{{Name: "example.com", Type: "A", ReturnCode: "NOERROR",
+			Answer: "A (123.122.121.120)", RemainingTTLSec: 250}})
+		_, _ = w.Write(response)
+	})
+	defer ts.Close()
+
+	cacheLookup(cacheLookupCmd, []string{"example.com"})
+
+	assert.Equal(t, "name=example.com", query)
+}
+
+func TestCacheDelete(t *testing.T) {
+	var method, query string
+
+	ts := testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		query = r.URL.RawQuery
+		response, _ := json.Marshal(api.CacheDeleteResult{Deleted: 3})
+		_, _ = w.Write(response)
+	})
+	defer ts.Close()
+
+	cmd := &cobra.Command{}
+	cmd.Flags().BoolP("subdomains", "s", false, "")
+	_ = cmd.Flags().Set("subdomains", "true")
+
+	cacheDelete(cmd, []string{"example.com"})
+
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "name=example.com&subdomains=true", query)
+}
+
+func TestCacheFlush(t *testing.T) {
+	var method, path string
+
+	ts := testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+	})
+	defer ts.Close()
+
+	cacheFlush(cacheFlushCmd, []string{})
+
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, api.CacheFlushPath, path)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"blocky/api"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(queryLogCmd)
+	queryLogCmd.Flags().String("client", "", "client name (part of) or client IP")
+	queryLogCmd.Flags().StringP("domain", "d", "", "queried domain (part of)")
+	queryLogCmd.Flags().StringP("type", "t", "", "response type (RESOLVED, CACHED, BLOCKED, CONDITIONAL, CUSTOMDNS, STALE)")
+	queryLogCmd.Flags().String("from", "", "only entries after this time (RFC 3339, example: 2020-04-01T10:00:00+02:00)")
+	queryLogCmd.Flags().String("to", "", "only entries before this time (RFC 3339)")
+	queryLogCmd.Flags().IntP("limit", "l", 0, "max count of entries (default 100)")
+	queryLogCmd.Flags().Int("offset", 0, "count of entries to skip")
+}
+
+//nolint:gochecknoglobals
+var queryLogCmd = &cobra.Command{
+	Use:     "querylog",
+	Aliases: []string{"log"},
+	Args:    cobra.NoArgs,
+	Short:   "Search the query log",
+	Run:     queryLog,
+}
+
+func queryLog(cmd *cobra.Command, args []string) {
+	params := url.Values{}
+
+	for flag, param := range map[string]string{
+		"client": "client",
+		"domain": "domain",
+		"type":   "responseType",
+		"from":   "from",
+		"to":     "to",
+	} {
+		if v, _ := cmd.Flags().GetString(flag); v != "" {
+			params.Set(param, v)
+		}
+	}
+
+	for _, flag := range []string{"limit", "offset"} {
+		if v, _ := cmd.Flags().GetInt(flag); v > 0 {
+			params.Set(flag, strconv.Itoa(v))
+		}
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s?%s", apiURL(api.QueryLogPath), params.Encode()))
+	if err != nil {
+		log.Fatal("can't execute", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Fatalf("NOK: %s %s", resp.Status, string(body))
+	}
+
+	var result []api.QueryLogEntry
+	err = json.NewDecoder(resp.Body).Decode(&result)
+
+	if err != nil {
+		log.Fatal("can't read response: ", err)
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Time", "Client IP", "Client name", "Question", "Response type", "Reason",
+		"Answer", "Return code", "Duration (ms)"})
+
+	for _, e := range result {
+		t.AppendRow(table.Row{e.Time.Format("2006-01-02 15:04:05"), e.ClientIP, e.ClientName,
+			fmt.Sprintf("%s (%s)", e.QuestionType, e.QuestionName), e.ResponseType, e.Reason,
+			e.Answer, e.ReturnCode, e.DurationMs})
+	}
+
+	t.Render()
+}
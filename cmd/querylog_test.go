@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"blocky/api"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryLog(t *testing.T) {
+	var query string
+
+	ts := testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		response, _ := json.Marshal([]api.QueryLogEntry{{
+			Time:         time.Now(),
+			ClientIP:     "192.168.178.25",
+			ClientName:   "client1",
+			ResponseType: "BLOCKED",
+			QuestionType: "A",
+			QuestionName: "ads.example.com",
+		}})
+		_, _ = w.Write(response)
+	})
+	defer ts.Close()
+
+	_ = queryLogCmd.Flags().Set("domain", "example.com")
+	_ = queryLogCmd.Flags().Set("limit", "10")
+
+	queryLog(queryLogCmd, []string{})
+
+	assert.Equal(t, "domain=example.com&limit=10", query)
+}
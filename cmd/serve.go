@@ -31,7 +31,7 @@ var serveCmd = &cobra.Command{
 
 		configureHTTPClient(&cfg)
 
-		signals := make(chan os.Signal)
+		signals := make(chan os.Signal, 1)
 		done := make(chan bool)
 
 		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
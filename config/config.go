@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"path"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/miekg/dns"
 	log "github.com/sirupsen/logrus"
 
 	"gopkg.in/yaml.v2"
@@ -47,6 +50,76 @@ func (u *Upstream) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+func (u Upstream) String() string {
+	return fmt.Sprintf("%s:%s:%d%s", u.Net, u.Host, u.Port, u.Path)
+}
+
+// UpstreamList contains one or more upstreams
+type UpstreamList []Upstream
+
+// UnmarshalYAML accepts a comma separated string or a list with upstreams
+func (l *UpstreamList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var values []string
+
+	var s string
+	if err := unmarshal(&s); err == nil {
+		values = strings.Split(s, ",")
+	} else if err := unmarshal(&values); err != nil {
+		return err
+	}
+
+	result := make(UpstreamList, 0, len(values))
+
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+
+		upstream, err := ParseUpstream(strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+
+		result = append(result, upstream)
+	}
+
+	*l = result
+
+	return nil
+}
+
+func (l UpstreamList) String() string {
+	values := make([]string, len(l))
+	for i, u := range l {
+		values[i] = u.String()
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// nolint:gochecknoglobals
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWeekday returns the day of week for short (mon) or long (monday) english names
+func ParseWeekday(day string) (time.Weekday, error) {
+	day = strings.ToLower(strings.TrimSpace(day))
+	if len(day) >= 3 {
+		if d, found := weekdays[day[:3]]; found && strings.HasPrefix(strings.ToLower(d.String()), day) {
+			return d, nil
+		}
+	}
+
+	return time.Sunday, fmt.Errorf("unknown day of week '%s'", day)
+}
+
 // ParseUpstream creates new Upstream from passed string in format net:host[:port][/path]
 func ParseUpstream(upstream string) (result Upstream, err error) {
 	if strings.TrimSpace(upstream) == "" {
@@ -103,25 +176,53 @@ func ParseUpstream(upstream string) (result Upstream, err error) {
 	return Upstream{Net: net, Host: host, Port: port, Path: path}, nil
 }
 
+// UpstreamDefaultGroup is the name of the upstream group defined by externalResolvers
+const UpstreamDefaultGroup = "default"
+
 const (
 	cfgDefaultPort           = 53
+	cfgDefaultTLSPort        = 853
 	cfgDefaultPrometheusPath = "/metrics"
 )
 
 // main configuration
 type Config struct {
-	Upstream     UpstreamConfig            `yaml:"upstream"`
-	CustomDNS    CustomDNSConfig           `yaml:"customDNS"`
-	Conditional  ConditionalUpstreamConfig `yaml:"conditional"`
-	Blocking     BlockingConfig            `yaml:"blocking"`
-	ClientLookup ClientLookupConfig        `yaml:"clientLookup"`
-	Caching      CachingConfig             `yaml:"caching"`
-	QueryLog     QueryLogConfig            `yaml:"queryLog"`
-	Prometheus   PrometheusConfig          `yaml:"prometheus"`
-	LogLevel     string                    `yaml:"logLevel"`
-	Port         uint16                    `yaml:"port"`
-	HTTPPort     uint16                    `yaml:"httpPort"`
-	BootstrapDNS Upstream                  `yaml:"bootstrapDns"`
+	Upstream      UpstreamConfig            `yaml:"upstream"`
+	CustomDNS     CustomDNSConfig           `yaml:"customDNS"`
+	Conditional   ConditionalUpstreamConfig `yaml:"conditional"`
+	Blocking      BlockingConfig            `yaml:"blocking"`
+	ClientLookup  ClientLookupConfig        `yaml:"clientLookup"`
+	Caching       CachingConfig             `yaml:"caching"`
+	QueryLog      QueryLogConfig            `yaml:"queryLog"`
+	Prometheus    PrometheusConfig          `yaml:"prometheus"`
+	BlockPage     BlockPageConfig           `yaml:"blockPage"`
+	CacheSnapshot CacheSnapshotConfig       `yaml:"cacheSnapshot"`
+	LogLevel      string                    `yaml:"logLevel"`
+	Port          uint16                    `yaml:"port"`
+	HTTPPort      uint16                    `yaml:"httpPort"`
+	HTTPSPort     uint16                    `yaml:"httpsPort"`
+	TLSPort       uint16                    `yaml:"tlsPort"`
+	CertFile      string                    `yaml:"certFile"`
+	KeyFile       string                    `yaml:"keyFile"`
+	BootstrapDNS  Upstream                  `yaml:"bootstrapDns"`
+	// path of the config file, used for reload
+	Path string `yaml:"-"`
+}
+
+// BlockPageConfig contains the config values for the block page HTTP listener
+type BlockPageConfig struct {
+	// 0: no block page listener
+	Port uint16 `yaml:"port"`
+	// link to the admin interface on the block page. Default: http://<blocky IP>:<httpPort>/
+	AdminURL string `yaml:"adminURL"`
+}
+
+// CacheSnapshotConfig contains the config values for the persistent snapshot of the DNS and client name caches
+type CacheSnapshotConfig struct {
+	// snapshot file. Empty: no snapshot
+	File string `yaml:"file"`
+	// period of the snapshot. 0: 1h, negative: only on shutdown
+	Period time.Duration `yaml:"period"`
 }
 
 // PrometheusConfig contains the config values for prometheus
@@ -131,23 +232,152 @@ type PrometheusConfig struct {
 }
 
 type UpstreamConfig struct {
+	// upstreams of the group "default"
 	ExternalResolvers []Upstream `yaml:"externalResolvers"`
+	// parallel_best (default), strict, random or fastest
+	Strategy string `yaml:"strategy"`
+	// additional named upstream groups
+	Groups map[string][]Upstream `yaml:"groups"`
+	// client name or IP -> upstream group. Clients without mapping use the group "default"
+	ClientGroups map[string]string `yaml:"clientGroups"`
 }
 
 type CustomDNSConfig struct {
-	Mapping map[string]net.IP `yaml:"mapping"`
+	Mapping map[string]CustomDNSEntry `yaml:"mapping"`
+	// TTL of the custom DNS answers. 0: 1h
+	TTL time.Duration `yaml:"ttl"`
+	// files in /etc/hosts format
+	HostsFiles []string `yaml:"hostsFiles"`
+	// RFC 1035 zone files
+	ZoneFiles []string `yaml:"zoneFiles"`
+	// reload period of hosts and zone files in minutes. 0: 1h, negative: no reload
+	RefreshPeriod int `yaml:"refreshPeriod"`
+}
+
+// CustomDNSEntry contains the records for a custom DNS name
+type CustomDNSEntry struct {
+	// addresses for A and AAAA records
+	IPs []net.IP
+	// other records in zone file notation without name and TTL: "CNAME printer.lan", "TXT some text",
+	// "MX 10 mail.lan", "SRV 0 5 5060 sip.lan"
+	Records []string
+}
+
+// nolint:gochecknoglobals
+var customDNSRecordTypes = map[uint16]bool{
+	dns.TypeCNAME: true,
+	dns.TypeTXT:   true,
+	dns.TypeMX:    true,
+	dns.TypeSRV:   true,
+}
+
+// UnmarshalYAML accepts a comma separated string with IP addresses, a single record or a list with IP addresses
+// and records. Records are never split, since they can contain commas (TXT "a,b")
+func (e *CustomDNSEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var values []string
+
+	var s string
+	if err := unmarshal(&s); err == nil {
+		values = splitIPs(s)
+	} else if err := unmarshal(&values); err != nil {
+		return err
+	}
+
+	entry, err := ParseCustomDNSEntry(values)
+	if err != nil {
+		return err
+	}
+
+	*e = entry
+
+	return nil
+}
+
+// splits the comma separated IP addresses, returns the whole string as single value if it is not a list of IPs
+func splitIPs(s string) []string {
+	values := strings.Split(s, ",")
+
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && net.ParseIP(v) == nil {
+			return []string{s}
+		}
+	}
+
+	return values
+}
+
+// ParseCustomDNSEntry creates a CustomDNSEntry from IP addresses and records ("CNAME printer.lan")
+func ParseCustomDNSEntry(values []string) (CustomDNSEntry, error) {
+	var entry CustomDNSEntry
+
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(v); ip != nil {
+			entry.IPs = append(entry.IPs, ip)
+			continue
+		}
+
+		rr, err := dns.NewRR(fmt.Sprintf(". 0 IN %s", v))
+		if err != nil || rr == nil || !customDNSRecordTypes[rr.Header().Rrtype] {
+			return entry, fmt.Errorf("invalid custom DNS entry '%s', please use an IP address or one of "+
+				"CNAME, TXT, MX, SRV records (e.g. 'CNAME printer.lan')", v)
+		}
+
+		entry.Records = append(entry.Records, v)
+	}
+
+	return entry, nil
+}
+
+func (e CustomDNSEntry) String() string {
+	values := make([]string, 0, len(e.IPs)+len(e.Records))
+	for _, ip := range e.IPs {
+		values = append(values, ip.String())
+	}
+
+	values = append(values, e.Records...)
+
+	return strings.Join(values, ", ")
 }
 
 type ConditionalUpstreamConfig struct {
-	Mapping map[string]Upstream `yaml:"mapping"`
+	// domain -> upstreams
+	Mapping map[string]UpstreamList `yaml:"mapping"`
+	// strategy for domains with multiple upstreams: parallel_best (default), strict, random or fastest
+	Strategy string `yaml:"strategy"`
+	// if true, the query will be passed to the next resolver, if all upstreams of the domain fail
+	FallThrough bool `yaml:"fallThrough"`
 }
 
 type BlockingConfig struct {
 	BlackLists        map[string][]string `yaml:"blackLists"`
 	WhiteLists        map[string][]string `yaml:"whiteLists"`
 	ClientGroupsBlock map[string][]string `yaml:"clientGroupsBlock"`
-	BlockType         string              `yaml:"blockType"`
-	RefreshPeriod     int                 `yaml:"refreshPeriod"`
+	// client -> group -> time windows for entries of clientGroupsBlock. A group with schedules is only applied to
+	// the client within one of its windows
+	Schedules map[string]map[string][]BlockingSchedule `yaml:"schedules"`
+	// zeroIP, nxDomain, refused, nodata or comma separated list of IP addresses
+	BlockType string `yaml:"blockType"`
+	// black list group -> block type, overrides blockType
+	GroupBlockType map[string]string `yaml:"groupBlockType"`
+	// TTL of the answer for blocked requests. 0: 6h
+	BlockTTL      time.Duration `yaml:"blockTTL"`
+	RefreshPeriod int           `yaml:"refreshPeriod"`
+}
+
+// BlockingSchedule is a time window on certain days of week
+type BlockingSchedule struct {
+	// mon, tue, ... Empty: every day
+	Days []string `yaml:"days"`
+	// start and end time (HH:MM), the window can cross midnight ("22:00" - "06:00")
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// IANA time zone (Europe/Berlin). Empty: UTC
+	Timezone string `yaml:"timezone"`
 }
 
 type ClientLookupConfig struct {
@@ -158,34 +388,249 @@ type ClientLookupConfig struct {
 type CachingConfig struct {
 	MinCachingTime int `yaml:"minTime"`
 	MaxCachingTime int `yaml:"maxTime"`
+	// if true, popular entries will be refreshed shortly before they expire
+	Prefetching bool `yaml:"prefetching"`
+	// time window for counting of queries per entry. 0: 2h
+	PrefetchExpires time.Duration `yaml:"prefetchExpires"`
+	// minimum count of queries within the time window for prefetching. 0: 5
+	PrefetchThreshold int `yaml:"prefetchThreshold"`
+	// max count of prefetched entries within the time window. 0: unlimited
+	PrefetchMaxItemsCount int `yaml:"prefetchMaxItemsCount"`
+	// expired entries will be kept for this duration and returned, if the next resolver fails (RFC 8767).
+	// 0: disabled
+	ServeStale time.Duration `yaml:"serveStale"`
 }
 
 type QueryLogConfig struct {
+	// csv, console, sqlite or mysql. Empty: csv if dir is defined, console otherwise
+	Type string `yaml:"type"`
+	// database file (sqlite) or data source name (mysql)
+	Target           string `yaml:"target"`
 	Dir              string `yaml:"dir"`
 	PerClient        bool   `yaml:"perClient"`
 	LogRetentionDays uint64 `yaml:"logRetentionDays"`
 }
 
+// NewConfig reads the config file, terminates the program if the file can't be read or is not valid
 func NewConfig(path string) Config {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return cfg
+}
+
+// LoadConfig reads and validates the config file
+func LoadConfig(path string) (Config, error) {
 	cfg := Config{}
 	setDefaultValues(&cfg)
 
 	data, err := ioutil.ReadFile(path)
 
 	if err != nil {
-		log.Fatal("Can't read config file: ", err)
+		return cfg, fmt.Errorf("can't read config file: %v", err)
 	}
 
 	err = yaml.UnmarshalStrict(data, &cfg)
 	if err != nil {
-		log.Fatal("wrong file structure: ", err)
+		return cfg, fmt.Errorf("wrong file structure: %v", err)
 	}
 
-	return cfg
+	cfg.Path = path
+
+	return cfg, validate(&cfg)
+}
+
+// ValidateBlockType checks the block type: one of ZeroIP, NxDomain, Refused, NoData (case insensitive) or
+// a comma separated list of IP addresses
+func ValidateBlockType(blockType string) error {
+	switch strings.TrimSpace(strings.ToUpper(blockType)) {
+	case "", "ZEROIP", "NXDOMAIN", "REFUSED", "NODATA":
+		return nil
+	}
+
+	for _, ip := range strings.Split(blockType, ",") {
+		if net.ParseIP(strings.TrimSpace(ip)) == nil {
+			return fmt.Errorf("unknown blockType '%s', please use one of: ZeroIP, NxDomain, Refused, NoData "+
+				"or a comma separated list of IP addresses", blockType)
+		}
+	}
+
+	return nil
+}
+
+// validates values which can't be checked during unmarshalling
+func validate(cfg *Config) error {
+	if _, err := log.ParseLevel(cfg.LogLevel); err != nil {
+		return fmt.Errorf("invalid log level '%s': %v", cfg.LogLevel, err)
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return errors.New("certFile and keyFile must be defined together")
+	}
+
+	if cfg.HTTPSPort > 0 && cfg.CertFile == "" {
+		return errors.New("httpsPort requires certFile and keyFile")
+	}
+
+	if err := ValidateBlockType(cfg.Blocking.BlockType); err != nil {
+		return err
+	}
+
+	for group, blockType := range cfg.Blocking.GroupBlockType {
+		if _, found := cfg.Blocking.BlackLists[group]; !found {
+			return fmt.Errorf("groupBlockType: unknown black list group '%s'", group)
+		}
+
+		if err := ValidateBlockType(blockType); err != nil {
+			return fmt.Errorf("groupBlockType for group '%s': %v", group, err)
+		}
+	}
+
+	if cfg.Caching.PrefetchExpires < 0 || cfg.Caching.PrefetchThreshold < 0 || cfg.Caching.PrefetchMaxItemsCount < 0 {
+		return errors.New("prefetchExpires, prefetchThreshold and prefetchMaxItemsCount must not be negative")
+	}
+
+	if cfg.Caching.ServeStale < 0 {
+		return fmt.Errorf("invalid serveStale '%s'", cfg.Caching.ServeStale)
+	}
+
+	if cfg.Blocking.BlockTTL < 0 {
+		return fmt.Errorf("invalid blockTTL '%s'", cfg.Blocking.BlockTTL)
+	}
+
+	switch strings.ToLower(cfg.Upstream.Strategy) {
+	case "", "parallel_best", "strict", "random", "fastest":
+	default:
+		return fmt.Errorf("unknown upstream strategy '%s', please use one of: parallel_best, strict, random, fastest",
+			cfg.Upstream.Strategy)
+	}
+
+	switch strings.ToLower(cfg.Conditional.Strategy) {
+	case "", "parallel_best", "strict", "random", "fastest":
+	default:
+		return fmt.Errorf("unknown conditional strategy '%s', please use one of: parallel_best, strict, random, fastest",
+			cfg.Conditional.Strategy)
+	}
+
+	for domain, upstreams := range cfg.Conditional.Mapping {
+		if len(upstreams) == 0 {
+			return fmt.Errorf("conditional mapping for '%s' has no upstream", domain)
+		}
+	}
+
+	if _, ok := cfg.Upstream.Groups[UpstreamDefaultGroup]; ok {
+		return fmt.Errorf("upstream group '%s' is defined by externalResolvers", UpstreamDefaultGroup)
+	}
+
+	for group, upstreams := range cfg.Upstream.Groups {
+		if len(upstreams) == 0 {
+			return fmt.Errorf("upstream group '%s' has no upstream", group)
+		}
+	}
+
+	for client, groups := range cfg.Blocking.Schedules {
+		for group, schedules := range groups {
+			if !hasGroup(cfg.Blocking.ClientGroupsBlock[client], group) {
+				return fmt.Errorf("schedule for group '%s' of client '%s' without clientGroupsBlock entry", group, client)
+			}
+
+			for _, schedule := range schedules {
+				if err := validateSchedule(schedule); err != nil {
+					return fmt.Errorf("invalid schedule for group '%s' of client '%s': %v", group, client, err)
+				}
+			}
+		}
+	}
+
+	for client := range cfg.Blocking.ClientGroupsBlock {
+		if err := validateClientKey(client); err != nil {
+			return err
+		}
+	}
+
+	for client, group := range cfg.Upstream.ClientGroups {
+		if err := validateClientKey(client); err != nil {
+			return err
+		}
+
+		if _, ok := cfg.Upstream.Groups[group]; !ok && group != UpstreamDefaultGroup {
+			return fmt.Errorf("unknown upstream group '%s' for client '%s'", group, client)
+		}
+	}
+
+	switch strings.ToLower(cfg.QueryLog.Type) {
+	case "", "console":
+	case "csv":
+		if cfg.QueryLog.Dir == "" {
+			return errors.New("query log type 'csv' requires dir")
+		}
+	case "sqlite", "mysql":
+		if cfg.QueryLog.Target == "" {
+			return fmt.Errorf("query log type '%s' requires target", cfg.QueryLog.Type)
+		}
+	default:
+		return fmt.Errorf("unknown query log type '%s', please use one of: csv, console, sqlite, mysql", cfg.QueryLog.Type)
+	}
+
+	// the default group is used for all clients without upstream group
+	if len(cfg.Upstream.ExternalResolvers) == 0 {
+		return errors.New("no upstream resolver defined, please configure at least one in upstream.externalResolvers")
+	}
+
+	return nil
+}
+
+// returns true if the group is in the list
+func hasGroup(groups []string, group string) bool {
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateSchedule(schedule BlockingSchedule) error {
+	for _, day := range schedule.Days {
+		if _, err := ParseWeekday(day); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range []string{schedule.From, schedule.To} {
+		if _, err := time.Parse("15:04", t); err != nil {
+			return fmt.Errorf("wrong time format '%s', please use HH:MM", t)
+		}
+	}
+
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("unknown time zone '%s'", schedule.Timezone)
+	}
+
+	return nil
+}
+
+// checks client keys (client name, wildcard name, IP address or CIDR) of client group mappings
+func validateClientKey(key string) error {
+	if strings.Contains(key, "/") {
+		if _, _, err := net.ParseCIDR(key); err != nil {
+			return fmt.Errorf("invalid CIDR client key '%s': %v", key, err)
+		}
+	}
+
+	if _, err := path.Match(key, ""); err != nil {
+		return fmt.Errorf("invalid wildcard client key '%s': %v", key, err)
+	}
+
+	return nil
 }
 
 func setDefaultValues(cfg *Config) {
 	cfg.Port = cfgDefaultPort
+	cfg.TLSPort = cfgDefaultTLSPort
 	cfg.LogLevel = "info"
 	cfg.Prometheus.Path = cfgDefaultPrometheusPath
 }
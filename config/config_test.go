@@ -6,9 +6,11 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 )
 
 func Test_NewConfig(t *testing.T) {
@@ -18,18 +20,30 @@ func Test_NewConfig(t *testing.T) {
 	cfg := NewConfig("config.yml")
 
 	assert.Equal(t, uint16(55555), cfg.Port)
+	assert.Equal(t, uint16(853), cfg.TLSPort)
 	assert.Len(t, cfg.Upstream.ExternalResolvers, 3)
 	assert.Equal(t, "8.8.8.8", cfg.Upstream.ExternalResolvers[0].Host)
 	assert.Equal(t, "8.8.4.4", cfg.Upstream.ExternalResolvers[1].Host)
 	assert.Equal(t, "1.1.1.1", cfg.Upstream.ExternalResolvers[2].Host)
-	assert.Len(t, cfg.CustomDNS.Mapping, 1)
-	assert.Equal(t, net.ParseIP("192.168.178.3"), cfg.CustomDNS.Mapping["my.duckdns.org"])
-	assert.Len(t, cfg.Conditional.Mapping, 1)
+	assert.Equal(t, "185.228.168.168", cfg.Upstream.Groups["kids"][0].Host)
+	assert.Equal(t, map[string]string{"kid-laptop": "kids"}, cfg.Upstream.ClientGroups)
+	assert.Len(t, cfg.CustomDNS.Mapping, 2)
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.178.3")}, cfg.CustomDNS.Mapping["my.duckdns.org"].IPs)
+	assert.Equal(t, "192.168.178.4, fd00::4, MX 10 mail.lan, TXT \"v=spf1 -all\"", cfg.CustomDNS.Mapping["nas.lan"].String())
+	assert.Equal(t, 10*time.Minute, cfg.CustomDNS.TTL)
+	assert.Len(t, cfg.Conditional.Mapping, 2)
+	assert.Equal(t, "udp:192.168.178.1:53, udp:192.168.178.2:53", cfg.Conditional.Mapping["fritz.box"].String())
+	assert.Len(t, cfg.Conditional.Mapping["lan"], 1)
+	assert.Equal(t, "strict", cfg.Conditional.Strategy)
+	assert.True(t, cfg.Conditional.FallThrough)
 	assert.Equal(t, "192.168.178.1", cfg.ClientLookup.Upstream.Host)
 	assert.Equal(t, []uint{2, 1}, cfg.ClientLookup.SingleNameOrder)
 	assert.Len(t, cfg.Blocking.BlackLists, 2)
 	assert.Len(t, cfg.Blocking.WhiteLists, 1)
 	assert.Len(t, cfg.Blocking.ClientGroupsBlock, 2)
+	assert.Equal(t, "Europe/Berlin", cfg.Blocking.Schedules["default"]["special"][0].Timezone)
+	assert.Equal(t, "192.168.178.100, fd00::100", cfg.Blocking.GroupBlockType["special"])
+	assert.Equal(t, time.Minute, cfg.Blocking.BlockTTL)
 	assert.Equal(t, 0, cfg.Caching.MaxCachingTime)
 	assert.Equal(t, 0, cfg.Caching.MinCachingTime)
 }
@@ -54,6 +68,210 @@ func Test_NewConfig_Malformed(t *testing.T) {
 	assert.True(t, fatal)
 }
 
+func Test_LoadConfig_Validation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocky")
+	defer os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	path := dir + "/config.yml"
+
+	err = ioutil.WriteFile(path, []byte("logLevel: wrong"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("blocking:\n  blockType: wrong"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("certFile: cert.pem"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("httpsPort: 443"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("queryLog:\n  type: sqlite"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("upstream:\n  strategy: wrong"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("conditional:\n  strategy: wrong"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("conditional:\n  mapping:\n    fritz.box: \"\""), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("upstream:\n  clientGroups:\n    laptop: kids"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("upstream:\n  groups:\n    default:\n      - udp:1.1.1.1"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("blocking:\n  clientGroupsBlock:\n    192.168.178.0/33:\n      - ads"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("blocking:\n  clientGroupsBlock:\n    laptop-[:\n      - ads"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	for _, schedule := range []string{
+		"days: [mon, holiday]\n          from: '20:00'\n          to: '06:00'",
+		"from: '8pm'\n          to: '06:00'",
+		"from: '20:00'\n          to: '06:00'\n          timezone: Mars/Olympus",
+	} {
+		err = ioutil.WriteFile(path, []byte("blocking:\n  clientGroupsBlock:\n    kids:\n      - social\n"+
+			"  schedules:\n    kids:\n      social:\n        - "+schedule), 0644)
+		assert.NoError(t, err)
+
+		_, err = LoadConfig(path)
+		assert.Error(t, err, schedule)
+	}
+
+	// schedule without clientGroupsBlock entry
+	for _, schedules := range []string{"kids:\n      ads:", "adults:\n      social:"} {
+		err = ioutil.WriteFile(path, []byte("blocking:\n  clientGroupsBlock:\n    kids:\n      - social\n"+
+			"  schedules:\n    "+schedules+"\n        - from: '20:00'\n          to: '06:00'"), 0644)
+		assert.NoError(t, err)
+
+		_, err = LoadConfig(path)
+		assert.Error(t, err, schedules)
+	}
+
+	for _, blocking := range []string{
+		"blockType: 192.168.178.1,wrong",
+		"blockTTL: 5x",
+		"blockTTL: -5m",
+		"groupBlockType:\n    unknown: nxDomain",
+		"blackLists:\n    ads:\n      - list.txt\n  groupBlockType:\n    ads: wrong",
+	} {
+		err = ioutil.WriteFile(path, []byte("blocking:\n  "+blocking), 0644)
+		assert.NoError(t, err)
+
+		_, err = LoadConfig(path)
+		assert.Error(t, err, blocking)
+	}
+
+	err = ioutil.WriteFile(path, []byte("customDNS:\n  mapping:\n    printer.lan: 192.168.178.3, wrong"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("queryLog:\n  type: wrong"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	for _, upstream := range []string{
+		"strategy: strict",
+		"externalResolvers:\n    - udp:1.1.1.1\n  groups:\n    kids:",
+		"groups:\n    kids:\n      - udp:1.1.1.1",
+	} {
+		err = ioutil.WriteFile(path, []byte("upstream:\n  "+upstream), 0644)
+		assert.NoError(t, err)
+
+		_, err = LoadConfig(path)
+		assert.Error(t, err, upstream)
+	}
+
+	err = ioutil.WriteFile(path, []byte("upstream:\n  externalResolvers:\n    - udp:1.1.1.1\n"+
+		"blocking:\n  blockType: nxDomain"), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, path, cfg.Path)
+}
+
+func Test_ValidateBlockType(t *testing.T) {
+	for _, blockType := range []string{"", "zeroIP", "NXDOMAIN", "refused", "NoData", "192.168.178.100",
+		"192.168.178.100, fd00::100"} {
+		assert.NoError(t, ValidateBlockType(blockType), blockType)
+	}
+
+	for _, blockType := range []string{"wrong", "192.168.178.100,", "192.168.178.300"} {
+		assert.Error(t, ValidateBlockType(blockType), blockType)
+	}
+}
+
+func Test_CustomDNSEntry_UnmarshalYAML(t *testing.T) {
+	var mapping map[string]CustomDNSEntry
+
+	err := yaml.Unmarshal([]byte(`
+nas.lan: 192.168.178.4, fd00::4
+txt.lan: TXT "v=spf1 ip4:192.168.178.4,192.168.178.5 -all"
+list.lan:
+  - 192.168.178.6
+  - TXT "a,b"
+`), &mapping)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.178.4"), net.ParseIP("fd00::4")}, mapping["nas.lan"].IPs)
+	assert.Equal(t, []string{`TXT "v=spf1 ip4:192.168.178.4,192.168.178.5 -all"`}, mapping["txt.lan"].Records)
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.178.6")}, mapping["list.lan"].IPs)
+	assert.Equal(t, []string{`TXT "a,b"`}, mapping["list.lan"].Records)
+}
+
+func Test_ParseCustomDNSEntry(t *testing.T) {
+	entry, err := ParseCustomDNSEntry([]string{" 192.168.178.3", "fd00::3 ", "", "CNAME printer.lan",
+		"SRV 0 5 5060 sip.lan"})
+	assert.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.178.3"), net.ParseIP("fd00::3")}, entry.IPs)
+	assert.Equal(t, []string{"CNAME printer.lan", "SRV 0 5 5060 sip.lan"}, entry.Records)
+
+	for _, value := range []string{"192.168.178.300", "A 192.168.178.3", "MX mail.lan", "wrong"} {
+		_, err = ParseCustomDNSEntry([]string{value})
+		assert.Error(t, err, value)
+	}
+}
+
+func Test_ParseWeekday(t *testing.T) {
+	for _, day := range []string{"mon", "Monday", "MON", " monday "} {
+		d, err := ParseWeekday(day)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Monday, d)
+	}
+
+	for _, day := range []string{"mo", "monkey", "holiday", ""} {
+		_, err := ParseWeekday(day)
+		assert.Error(t, err)
+	}
+}
+
 func Test_NewConfig_FileDoesNotExist(t *testing.T) {
 	err := os.Chdir("../..")
 	assert.NoError(t, err)
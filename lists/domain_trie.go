@@ -0,0 +1,269 @@
+package lists
+
+import (
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+const (
+	exactEntry uint8 = 1 << iota
+	wildcardEntry
+)
+
+// domainTrie stores domain names with reversed labels ("ads.example.com" -> "com" -> "example" -> "ads").
+// Each node can be marked as exact entry (matches only this name) and/or as wildcard entry
+// (matches this name and all sub-domains). Children are stored as sorted slice to keep the memory footprint low.
+type domainTrie struct {
+	root           trieNode
+	exactCount     int
+	wildcardCount  int
+	footprintBytes uint64
+}
+
+type trieNode struct {
+	label    string
+	children []*trieNode
+	flags    uint8
+}
+
+// nolint:gochecknoglobals
+var trieNodeSize = uint64(unsafe.Sizeof(trieNode{}))
+
+func newDomainTrie() *domainTrie {
+	return &domainTrie{}
+}
+
+// count returns the number of all entries in the trie
+func (t *domainTrie) count() int {
+	return t.exactCount + t.wildcardCount
+}
+
+// returns the child with passed label or nil
+func (n *trieNode) child(label string) *trieNode {
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].label >= label
+	})
+
+	if idx < len(n.children) && n.children[idx].label == label {
+		return n.children[idx]
+	}
+
+	return nil
+}
+
+// returns the child with passed label, creates a new one if the child does not exist
+func (n *trieNode) getOrCreateChild(label string) *trieNode {
+	// fast path: entries are inserted in sorted order, the new label is usually the last one
+	if l := len(n.children); l > 0 && n.children[l-1].label == label {
+		return n.children[l-1]
+	}
+
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].label >= label
+	})
+
+	if idx < len(n.children) && n.children[idx].label == label {
+		return n.children[idx]
+	}
+
+	// copy the label, otherwise the node would keep the whole entry string in memory
+	c := &trieNode{label: string([]byte(label))}
+
+	n.children = append(n.children, nil)
+	copy(n.children[idx+1:], n.children[idx:])
+	n.children[idx] = c
+
+	return c
+}
+
+// insert adds the domain to the trie, returns false if the entry already exists
+func (t *domainTrie) insert(domain string, wildcard bool) bool {
+	n := &t.root
+
+	forEachReversedLabel(domain, func(label string, _ int) bool {
+		n = n.getOrCreateChild(label)
+		return true
+	})
+
+	return t.mark(n, wildcard)
+}
+
+// marks the node as exact or wildcard entry, returns false if the entry already exists
+func (t *domainTrie) mark(n *trieNode, wildcard bool) bool {
+	flag := exactEntry
+	if wildcard {
+		flag = wildcardEntry
+	}
+
+	if n.flags&flag != 0 {
+		return false
+	}
+
+	n.flags |= flag
+
+	if wildcard {
+		t.wildcardCount++
+	} else {
+		t.exactCount++
+	}
+
+	return true
+}
+
+// insertBatch adds the entries ("domain" or "*.domain" for wildcards) to the trie, the slice will be sorted.
+// Children which must be inserted between existing children are collected per node and merged once at the end,
+// so a big node (e.g. "com") is copied only once per batch instead of once per new child
+func (t *domainTrie) insertBatch(entries []string) {
+	sort.Slice(entries, func(i, j int) bool {
+		return reversedLess(strings.TrimPrefix(entries[i], "*."), strings.TrimPrefix(entries[j], "*."))
+	})
+
+	// node -> new children (sorted), which are not merged yet
+	pending := make(map[*trieNode][]*trieNode)
+
+	child := func(n *trieNode, label string) *trieNode {
+		l := len(n.children)
+
+		// entries are sorted: new labels are usually greater than all existing ones
+		if l == 0 || n.children[l-1].label < label {
+			c := &trieNode{label: string([]byte(label))}
+			n.children = append(n.children, c)
+
+			return c
+		}
+
+		if c := n.child(label); c != nil {
+			return c
+		}
+
+		p := pending[n]
+		if l := len(p); l > 0 && p[l-1].label == label {
+			return p[l-1]
+		}
+
+		c := &trieNode{label: string([]byte(label))}
+		pending[n] = append(p, c)
+
+		return c
+	}
+
+	for _, entry := range entries {
+		domain := strings.TrimPrefix(entry, "*.")
+		n := &t.root
+
+		forEachReversedLabel(domain, func(label string, _ int) bool {
+			n = child(n, label)
+			return true
+		})
+
+		t.mark(n, domain != entry)
+	}
+
+	for n, p := range pending {
+		n.children = mergeChildren(n.children, p)
+	}
+}
+
+// merges two sorted child slices
+func mergeChildren(a, b []*trieNode) []*trieNode {
+	result := make([]*trieNode, 0, len(a)+len(b))
+
+	for len(a) > 0 && len(b) > 0 {
+		if a[0].label < b[0].label {
+			result, a = append(result, a[0]), a[1:]
+		} else {
+			result, b = append(result, b[0]), b[1:]
+		}
+	}
+
+	result = append(result, a...)
+
+	return append(result, b...)
+}
+
+// match returns the matching rule (domain name or wildcard entry) or empty string if no entry matches
+func (t *domainTrie) match(domain string) string {
+	n := &t.root
+	wildcardRule := ""
+
+	forEachReversedLabel(domain, func(label string, start int) bool {
+		n = n.child(label)
+		if n == nil {
+			return false
+		}
+
+		// take the wildcard entry with the shortest domain
+		if n.flags&wildcardEntry != 0 && wildcardRule == "" {
+			wildcardRule = "*." + domain[start:]
+		}
+
+		return true
+	})
+
+	if n != nil && n != &t.root && n.flags&exactEntry != 0 {
+		return domain
+	}
+
+	return wildcardRule
+}
+
+// compact trims the capacity of all child slices and calculates the memory footprint of the trie.
+// Should be called after all entries were inserted.
+func (t *domainTrie) compact() {
+	var size uint64
+
+	var walk func(n *trieNode)
+	walk = func(n *trieNode) {
+		if cap(n.children) > len(n.children) {
+			children := make([]*trieNode, len(n.children))
+			copy(children, n.children)
+			n.children = children
+		}
+
+		size += trieNodeSize + uint64(len(n.label)) + uint64(len(n.children))*uint64(unsafe.Sizeof(n))
+
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+
+	walk(&t.root)
+
+	t.footprintBytes = size
+}
+
+// calls fn for each label of the domain, beginning with the last one. Stops if fn returns false.
+// start is the index of the label in the domain string
+func forEachReversedLabel(domain string, fn func(label string, start int) bool) {
+	end := len(domain)
+
+	for end > 0 {
+		start := strings.LastIndexByte(domain[:end], '.') + 1
+
+		if !fn(domain[start:end], start) {
+			return
+		}
+
+		end = start - 1
+	}
+}
+
+// reversedLess compares two domain names label by label, beginning with the last label.
+// Sorting by this order gives the optimal insertion order for the trie.
+func reversedLess(a, b string) bool {
+	for {
+		ai := strings.LastIndexByte(a, '.')
+		bi := strings.LastIndexByte(b, '.')
+
+		if la, lb := a[ai+1:], b[bi+1:]; la != lb {
+			return la < lb
+		}
+
+		if ai < 0 || bi < 0 {
+			return ai < bi
+		}
+
+		a, b = a[:ai], b[:bi]
+	}
+}
@@ -0,0 +1,122 @@
+package lists
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DomainTrie_Exact_Match(t *testing.T) {
+	sut := newDomainTrie()
+
+	assert.True(t, sut.insert("example.com", false))
+	assert.True(t, sut.insert("192.168.178.55", false))
+	assert.True(t, sut.insert("2001:db8::1", false))
+
+	// duplicate
+	assert.False(t, sut.insert("example.com", false))
+
+	assert.Equal(t, "example.com", sut.match("example.com"))
+	assert.Equal(t, "192.168.178.55", sut.match("192.168.178.55"))
+	assert.Equal(t, "2001:db8::1", sut.match("2001:db8::1"))
+
+	// no sub-domains or parent domains
+	assert.Equal(t, "", sut.match("sub.example.com"))
+	assert.Equal(t, "", sut.match("com"))
+	assert.Equal(t, "", sut.match("168.178.55"))
+	assert.Equal(t, "", sut.match(""))
+
+	assert.Equal(t, 3, sut.count())
+}
+
+func Test_DomainTrie_Wildcard_Match(t *testing.T) {
+	sut := newDomainTrie()
+
+	assert.True(t, sut.insert("doubleclick.net", true))
+	assert.True(t, sut.insert("ads.doubleclick.net", true))
+	assert.True(t, sut.insert("doubleclick.net", false))
+	assert.False(t, sut.insert("doubleclick.net", true))
+
+	// exact entry wins
+	assert.Equal(t, "doubleclick.net", sut.match("doubleclick.net"))
+
+	// shortest wildcard entry
+	assert.Equal(t, "*.doubleclick.net", sut.match("ads.doubleclick.net"))
+	assert.Equal(t, "*.doubleclick.net", sut.match("a.b.c.doubleclick.net"))
+
+	assert.Equal(t, "", sut.match("notdoubleclick.net"))
+	assert.Equal(t, "", sut.match("net"))
+
+	assert.Equal(t, 1, sut.exactCount)
+	assert.Equal(t, 2, sut.wildcardCount)
+}
+
+func Test_DomainTrie_Unsorted_Insert(t *testing.T) {
+	sut := newDomainTrie()
+
+	domains := []string{"c.com", "a.com", "b.org", "x.a.com", "b.com", "a.org"}
+	for _, d := range domains {
+		sut.insert(d, false)
+	}
+
+	for _, d := range domains {
+		assert.Equal(t, d, sut.match(d))
+	}
+
+	com := sut.root.child("com")
+	assert.NotNil(t, com)
+	assert.Len(t, com.children, 3)
+	assert.True(t, sort.SliceIsSorted(com.children, func(i, j int) bool {
+		return com.children[i].label < com.children[j].label
+	}))
+}
+
+func Test_DomainTrie_InsertBatch(t *testing.T) {
+	sut := newDomainTrie()
+
+	sut.insert("m.com", false)
+	sut.insert("x.com", false)
+
+	sut.insertBatch([]string{"z.com", "a.com", "*.n.com", "n.com", "a.b.org", "n.com", "b.com", "c.x.com"})
+	sut.insertBatch([]string{"y.com", "b.com", "a.a.com"})
+
+	for _, d := range []string{"m.com", "x.com", "z.com", "a.com", "n.com", "a.b.org", "b.com", "c.x.com", "y.com",
+		"a.a.com"} {
+		assert.Equal(t, d, sut.match(d))
+	}
+
+	assert.Equal(t, "*.n.com", sut.match("sub.n.com"))
+	assert.Equal(t, "", sut.match("b.org"))
+	assert.Equal(t, 10, sut.exactCount)
+	assert.Equal(t, 1, sut.wildcardCount)
+
+	com := sut.root.child("com")
+	assert.Len(t, com.children, 7)
+	assert.True(t, sort.SliceIsSorted(com.children, func(i, j int) bool {
+		return com.children[i].label < com.children[j].label
+	}))
+}
+
+func Test_DomainTrie_Compact(t *testing.T) {
+	sut := newDomainTrie()
+
+	sut.insert("a.example.com", false)
+	sut.insert("b.example.com", false)
+
+	sut.compact()
+
+	assert.True(t, sut.footprintBytes > 0)
+	assert.Equal(t, len(sut.root.children), cap(sut.root.children))
+	assert.Equal(t, "b.example.com", sut.match("b.example.com"))
+}
+
+func Test_ReversedLess(t *testing.T) {
+	domains := []string{"b.a.com", "a.org", "ex-a.b.com", "ex.com", "a.com", "com", "b.com"}
+
+	sort.Slice(domains, func(i, j int) bool {
+		return reversedLess(domains[i], domains[j])
+	})
+
+	assert.Equal(t, []string{"com", "a.com", "b.a.com", "b.com", "ex-a.b.com", "ex.com", "a.org"}, domains)
+}
@@ -8,9 +8,10 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"sort"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,6 +21,8 @@ import (
 const (
 	timeout              = 30 * time.Second
 	defaultRefreshPeriod = 4 * time.Hour
+	// count of list entries, which are read and inserted into the trie at once
+	entryBatchSize = 100000
 )
 
 type ListCacheType int
@@ -38,19 +41,51 @@ func (l ListCacheType) String() string {
 }
 
 type Matcher interface {
-	// matches passed domain name against cached list entries
-	Match(domain string, groupsToCheck []string) (found bool, group string)
+	// matches passed domain name against cached list entries, returns the group and the rule which matched
+	Match(domain string, groupsToCheck []string) (found bool, group string, rule string)
 
 	// returns current configuration and stats
 	Configuration() []string
+
+	// stops the periodical refresh
+	Stop()
+}
+
+// groupCache contains all entries of one group
+type groupCache struct {
+	// domain names, IP addresses and wildcard entries ("*.domain")
+	domains *domainTrie
+	// regex entries ("/regex/")
+	regexes []*regexp.Regexp
+}
+
+func (c *groupCache) count() int {
+	return c.domains.count() + len(c.regexes)
+}
+
+// returns the matching rule for domain or empty string if no entry matches
+func (c *groupCache) match(domain string) string {
+	if rule := c.domains.match(domain); rule != "" {
+		return rule
+	}
+
+	for _, regex := range c.regexes {
+		if regex.MatchString(domain) {
+			return fmt.Sprintf("/%s/", regex)
+		}
+	}
+
+	return ""
 }
 
 type ListCache struct {
-	groupCaches map[string][]string
-	lock        sync.RWMutex
+	// contains map[string]*groupCache, will be replaced completely on refresh. Readers don't need any lock
+	groupCaches  atomic.Value
+	refreshMutex sync.Mutex
 
 	groupToLinks  map[string][]string
 	refreshPeriod time.Duration
+	stopChan      chan struct{}
 
 	counter *prometheus.GaugeVec
 }
@@ -72,21 +107,24 @@ func (b *ListCache) Configuration() (result []string) {
 
 	result = append(result, "group caches:")
 
-	var total int
+	var (
+		total          int
+		footprintBytes uint64
+	)
 
-	for group, cache := range b.groupCaches {
-		result = append(result, fmt.Sprintf("  %s: %d entries", group, len(cache)))
-		total += len(cache)
+	for group, cache := range b.caches() {
+		result = append(result, fmt.Sprintf("  %s: %d entries (%d wildcards, %d regexes), memory: %d KB",
+			group, cache.count(), cache.domains.wildcardCount, len(cache.regexes), cache.domains.footprintBytes/1024))
+		total += cache.count()
+		footprintBytes += cache.domains.footprintBytes
 	}
 
-	result = append(result, fmt.Sprintf("  TOTAL: %d entries", total))
+	result = append(result, fmt.Sprintf("  TOTAL: %d entries, memory: %d KB", total, footprintBytes/1024))
 
 	return
 }
 
 func NewListCache(t ListCacheType, groupToLinks map[string][]string, refreshPeriod int) *ListCache {
-	groupCaches := make(map[string][]string)
-
 	p := time.Duration(refreshPeriod) * time.Minute
 	if refreshPeriod == 0 {
 		p = defaultRefreshPeriod
@@ -107,10 +145,11 @@ func NewListCache(t ListCacheType, groupToLinks map[string][]string, refreshPeri
 
 	b := &ListCache{
 		groupToLinks:  groupToLinks,
-		groupCaches:   groupCaches,
 		refreshPeriod: p,
+		stopChan:      make(chan struct{}),
 		counter:       counter,
 	}
+	b.groupCaches.Store(make(map[string]*groupCache))
 	b.refresh()
 
 	go periodicUpdate(b)
@@ -125,21 +164,31 @@ func periodicUpdate(cache *ListCache) {
 		defer ticker.Stop()
 
 		for {
-			<-ticker.C
-			cache.refresh()
+			select {
+			case <-ticker.C:
+				cache.refresh()
+			case <-cache.stopChan:
+				return
+			}
 		}
 	}
 }
 
+// Stop stops the periodical refresh
+func (b *ListCache) Stop() {
+	close(b.stopChan)
+}
+
 func logger() *logrus.Entry {
 	return logrus.WithField("prefix", "list_cache")
 }
 
-// downloads and reads files with domain names and creates cache for them
-func createCacheForGroup(links []string) []string {
-	var cache []string
+// downloads and reads files with domain names and creates cache for them. Entries are inserted into the trie
+// in batches while the files are read, so only the current batches are kept in memory
+func createCacheForGroup(links []string) *groupCache {
+	cache := &groupCache{domains: newDomainTrie()}
 
-	keys := make(map[string]bool)
+	regexes := make(map[string]bool)
 
 	var wg sync.WaitGroup
 
@@ -151,66 +200,94 @@ func createCacheForGroup(links []string) []string {
 		go processFile(link, c, &wg)
 	}
 
-	wg.Wait()
+	go func() {
+		wg.Wait()
+		close(c)
+	}()
+
+	for res := range c {
+		domains := res[:0]
 
-Loop:
-	for {
-		select {
-		case res := <-c:
-			for _, entry := range res {
-				if _, value := keys[entry]; !value {
-					keys[entry] = true
-					cache = append(cache, entry)
+		for _, entry := range res {
+			if isRegex(entry) {
+				if !regexes[entry] {
+					regexes[entry] = true
+					cache.addRegex(entry)
 				}
+			} else if len(entry) > 0 {
+				domains = append(domains, entry)
 			}
-		default:
-			close(c)
-			break Loop
 		}
+
+		cache.domains.insertBatch(domains)
 	}
 
-	sort.Strings(cache)
+	cache.domains.compact()
 
 	return cache
 }
 
-func (b *ListCache) Match(domain string, groupsToCheck []string) (found bool, group string) {
-	b.lock.RLock()
-	defer b.lock.RUnlock()
+func isRegex(entry string) bool {
+	return len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/")
+}
 
-	for _, g := range groupsToCheck {
-		if contains(domain, b.groupCaches[g]) {
-			return true, g
-		}
+// compiles the regex entry and adds it to the cache
+func (c *groupCache) addRegex(entry string) {
+	regex, err := regexp.Compile(entry[1 : len(entry)-1])
+	if err != nil {
+		logger().WithField("entry", entry).Warn("invalid regex, entry will be ignored: ", err)
+		return
 	}
 
-	return false, ""
+	c.regexes = append(c.regexes, regex)
+}
+
+// returns the current caches of all groups
+func (b *ListCache) caches() map[string]*groupCache {
+	return b.groupCaches.Load().(map[string]*groupCache)
 }
 
-func contains(domain string, cache []string) bool {
-	idx := sort.SearchStrings(cache, domain)
-	if idx < len(cache) {
-		return cache[idx] == strings.ToLower(domain)
+func (b *ListCache) Match(domain string, groupsToCheck []string) (found bool, group string, rule string) {
+	caches := b.caches()
+
+	domain = strings.ToLower(domain)
+
+	for _, g := range groupsToCheck {
+		if cache, ok := caches[g]; ok {
+			if rule := cache.match(domain); rule != "" {
+				return true, g, rule
+			}
+		}
 	}
 
-	return false
+	return false, "", ""
 }
 
 func (b *ListCache) refresh() {
+	b.refreshMutex.Lock()
+	defer b.refreshMutex.Unlock()
+
 	for group, links := range b.groupToLinks {
 		cacheForGroup := createCacheForGroup(links)
 
-		b.lock.Lock()
-		b.groupCaches[group] = cacheForGroup
-		b.lock.Unlock()
+		// copy on write: readers still use the old map until the new one is stored
+		oldCaches := b.caches()
+		newCaches := make(map[string]*groupCache, len(oldCaches)+1)
+
+		for g, c := range oldCaches {
+			newCaches[g] = c
+		}
+
+		newCaches[group] = cacheForGroup
+		b.groupCaches.Store(newCaches)
 
 		if metrics.IsEnabled() {
-			b.counter.WithLabelValues(group).Set(float64(len(b.groupCaches[group])))
+			b.counter.WithLabelValues(group).Set(float64(cacheForGroup.count()))
 		}
 
 		logger().WithFields(logrus.Fields{
 			"group":       group,
-			"total_count": len(b.groupCaches[group]),
+			"total_count": cacheForGroup.count(),
 		}).Info("group import finished")
 	}
 }
@@ -239,7 +316,7 @@ func readFile(file string) (io.ReadCloser, error) {
 	return os.Open(file)
 }
 
-// downloads file (or reads local file) and writes file content as string array in the channel
+// downloads file (or reads local file) and writes file content in batches of string arrays in the channel
 func processFile(link string, ch chan<- []string, wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -272,6 +349,11 @@ func processFile(link string, ch chan<- []string, wg *sync.WaitGroup) {
 			result = append(result, processLine(line))
 
 			count++
+
+			if len(result) == entryBatchSize {
+				ch <- result
+				result = nil
+			}
 		}
 	}
 
@@ -286,8 +368,13 @@ func processFile(link string, ch chan<- []string, wg *sync.WaitGroup) {
 	ch <- result
 }
 
-// return only first column (see hosts format)
+// return only first column (see hosts format) or the regex entry
 func processLine(line string) string {
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "/") && strings.HasSuffix(trimmed, "/") {
+		// regex entry, can contain whitespaces and upper case characters
+		return trimmed
+	}
+
 	parts := strings.Fields(line)
 	if len(parts) > 0 {
 		host := parts[len(parts)-1]
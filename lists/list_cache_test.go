@@ -23,7 +23,7 @@ func Test_NoMatch_With_Empty_List(t *testing.T) {
 
 	sut := NewListCache(BLACKLIST, lists, 0)
 
-	found, group := sut.Match("google.com", []string{"gr1"})
+	found, group, _ := sut.Match("google.com", []string{"gr1"})
 	assert.Equal(t, false, found)
 	assert.Equal(t, "", group)
 }
@@ -45,15 +45,15 @@ func Test_Match_Download_Multiple_Groups(t *testing.T) {
 
 	sut := NewListCache(BLACKLIST, lists, 0)
 
-	found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
+	found, group, _ := sut.Match("blocked1.com", []string{"gr1", "gr2"})
 	assert.Equal(t, true, found)
 	assert.Equal(t, "gr1", group)
 
-	found, group = sut.Match("blocked1a.com", []string{"gr1", "gr2"})
+	found, group, _ = sut.Match("blocked1a.com", []string{"gr1", "gr2"})
 	assert.Equal(t, true, found)
 	assert.Equal(t, "gr1", group)
 
-	found, group = sut.Match("blocked1a.com", []string{"gr2"})
+	found, group, _ = sut.Match("blocked1a.com", []string{"gr2"})
 	assert.Equal(t, true, found)
 	assert.Equal(t, "gr2", group)
 }
@@ -76,7 +76,7 @@ func Test_Match_Download_No_Group(t *testing.T) {
 
 	sut := NewListCache(BLACKLIST, lists, 0)
 
-	found, group := sut.Match("blocked1.com", []string{})
+	found, group, _ := sut.Match("blocked1.com", []string{})
 	assert.Equal(t, false, found)
 	assert.Equal(t, "", group)
 }
@@ -93,7 +93,7 @@ func Test_Match_Download_WithMetrics(t *testing.T) {
 
 	sut := NewListCache(BLACKLIST, lists, 0)
 
-	found, group := sut.Match("blocked1.com", []string{})
+	found, group, _ := sut.Match("blocked1.com", []string{})
 	assert.Equal(t, false, found)
 	assert.Equal(t, "", group)
 
@@ -117,19 +117,61 @@ func Test_Match_Files_Multiple_Groups(t *testing.T) {
 
 	sut := NewListCache(BLACKLIST, lists, 0)
 
-	found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
+	found, group, _ := sut.Match("blocked1.com", []string{"gr1", "gr2"})
 	assert.Equal(t, true, found)
 	assert.Equal(t, "gr1", group)
 
-	found, group = sut.Match("blocked1a.com", []string{"gr1", "gr2"})
+	found, group, _ = sut.Match("blocked1a.com", []string{"gr1", "gr2"})
 	assert.Equal(t, true, found)
 	assert.Equal(t, "gr1", group)
 
-	found, group = sut.Match("blocked1a.com", []string{"gr2"})
+	found, group, _ = sut.Match("blocked1a.com", []string{"gr2"})
 	assert.Equal(t, true, found)
 	assert.Equal(t, "gr2", group)
 }
 
+func Test_Match_Wildcard_And_Regex(t *testing.T) {
+	file1 := helpertest.TempFile("# comment\n*.doubleclick.net\n/^ads?[0-9]*\\./\n/[invalid/\nexact.com")
+	defer os.Remove(file1.Name())
+
+	lists := map[string][]string{
+		"gr1": {file1.Name()},
+	}
+
+	sut := NewListCache(BLACKLIST, lists, 0)
+
+	found, group, rule := sut.Match("doubleclick.net", []string{"gr1"})
+	assert.Equal(t, true, found)
+	assert.Equal(t, "gr1", group)
+	assert.Equal(t, "*.doubleclick.net", rule)
+
+	found, _, rule = sut.Match("ad.Doubleclick.net", []string{"gr1"})
+	assert.Equal(t, true, found)
+	assert.Equal(t, "*.doubleclick.net", rule)
+
+	found, _, _ = sut.Match("notdoubleclick.net", []string{"gr1"})
+	assert.Equal(t, false, found)
+
+	found, _, rule = sut.Match("ads1.example.com", []string{"gr1"})
+	assert.Equal(t, true, found)
+	assert.Equal(t, "/^ads?[0-9]*\\./", rule)
+
+	found, _, _ = sut.Match("myads.example.com", []string{"gr1"})
+	assert.Equal(t, false, found)
+
+	found, _, rule = sut.Match("exact.com", []string{"gr1"})
+	assert.Equal(t, true, found)
+	assert.Equal(t, "exact.com", rule)
+
+	// exact entries don't match sub-domains
+	found, _, _ = sut.Match("sub.exact.com", []string{"gr1"})
+	assert.Equal(t, false, found)
+
+	assert.Equal(t, 1, sut.caches()["gr1"].domains.exactCount)
+	assert.Equal(t, 1, sut.caches()["gr1"].domains.wildcardCount)
+	assert.Len(t, sut.caches()["gr1"].regexes, 1)
+}
+
 func BenchmarkRefresh(b *testing.B) {
 	count := 10000
 
@@ -155,16 +197,16 @@ func BenchmarkRefresh(b *testing.B) {
 
 	for n := 0; n < b.N; n++ {
 		go sut.refresh()
-		found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
+		found, group, _ := sut.Match("blocked1.com", []string{"gr1", "gr2"})
 		assert.Equal(b, true, found)
 		assert.Equal(b, "gr1", group)
 	}
 
-	found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
+	found, group, _ := sut.Match("blocked1.com", []string{"gr1", "gr2"})
 	assert.Equal(b, true, found)
 	assert.Equal(b, "gr1", group)
 
-	assert.Len(b, sut.groupCaches["gr1"], count)
+	assert.Equal(b, count, sut.caches()["gr1"].count())
 }
 
 func Test_Configuration_RefreshEnabled(t *testing.T) {
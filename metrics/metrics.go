@@ -14,8 +14,15 @@ var reg = prometheus.NewRegistry()
 // nolint
 var enabled bool
 
+// RegisterMetric registers the collector. An already registered collector with the same
+// description will be replaced (for example, after config reload)
 func RegisterMetric(c prometheus.Collector) {
-	_ = reg.Register(c)
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			reg.Unregister(are.ExistingCollector)
+			_ = reg.Register(c)
+		}
+	}
 }
 
 func Start(router *chi.Mux, cfg config.PrometheusConfig) {
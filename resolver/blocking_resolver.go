@@ -17,11 +17,13 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/miekg/dns"
+	"github.com/patrickmn/go-cache"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
+	// default TTL of the answer for blocked requests
 	BlockTTL = 6 * 60 * 60
 )
 
@@ -30,10 +32,13 @@ type BlockType uint8
 const (
 	ZeroIP BlockType = iota
 	NxDomain
+	Refused
+	NoData
+	CustomIP
 )
 
 func (b BlockType) String() string {
-	return [...]string{"ZeroIP", "NxDomain"}[b]
+	return [...]string{"ZeroIP", "NxDomain", "Refused", "NoData", "CustomIP"}[b]
 }
 
 // nolint:gochecknoglobals
@@ -42,19 +47,75 @@ var typeToZeroIP = map[uint16]net.IP{
 	dns.TypeAAAA: net.IPv6zero,
 }
 
-func resolveBlockType(cfg config.BlockingConfig) BlockType {
-	cfgBlockType := strings.TrimSpace(strings.ToUpper(cfg.BlockType))
-	if cfgBlockType == "" || cfgBlockType == "ZEROIP" {
-		return ZeroIP
+// blockResponse defines the response for blocked requests
+type blockResponse struct {
+	blockType BlockType
+	// IP addresses for CustomIP
+	ips []net.IP
+}
+
+func (b blockResponse) String() string {
+	if b.blockType != CustomIP {
+		return b.blockType.String()
+	}
+
+	ips := make([]string, len(b.ips))
+	for i, ip := range b.ips {
+		ips[i] = ip.String()
+	}
+
+	return strings.Join(ips, ", ")
+}
+
+// returns IP addresses for the query type (A or AAAA), nil for other query types
+func (b blockResponse) answerIPs(qType uint16) (result []net.IP) {
+	switch b.blockType {
+	case ZeroIP:
+		if ip, found := typeToZeroIP[qType]; found {
+			result = append(result, ip)
+		}
+	case CustomIP:
+		for _, ip := range b.ips {
+			isIPv4 := ip.To4() != nil
+			if (qType == dns.TypeA && isIPv4) || (qType == dns.TypeAAAA && !isIPv4) {
+				result = append(result, ip)
+			}
+		}
 	}
 
-	if cfgBlockType == "NXDOMAIN" {
-		return NxDomain
+	return
+}
+
+func parseBlockResponse(blockType string) (blockResponse, error) {
+	if err := config.ValidateBlockType(blockType); err != nil {
+		return blockResponse{}, err
+	}
+
+	switch strings.TrimSpace(strings.ToUpper(blockType)) {
+	case "", "ZEROIP":
+		return blockResponse{blockType: ZeroIP}, nil
+	case "NXDOMAIN":
+		return blockResponse{blockType: NxDomain}, nil
+	case "REFUSED":
+		return blockResponse{blockType: Refused}, nil
+	case "NODATA":
+		return blockResponse{blockType: NoData}, nil
 	}
 
-	log.Fatalf("unknown blockType, please use one of: ZeroIP, NxDomain")
+	result := blockResponse{blockType: CustomIP}
+	for _, ip := range strings.Split(blockType, ",") {
+		result.ips = append(result.ips, net.ParseIP(strings.TrimSpace(ip)))
+	}
 
-	return ZeroIP
+	return result, nil
+}
+
+func resolveBlockTTL(cfg config.BlockingConfig) uint32 {
+	if cfg.BlockTTL > 0 {
+		return uint32(cfg.BlockTTL.Seconds())
+	}
+
+	return BlockTTL
 }
 
 type status struct {
@@ -100,13 +161,50 @@ type BlockingResolver struct {
 	blacklistMatcher    lists.Matcher
 	whitelistMatcher    lists.Matcher
 	clientGroupsBlock   map[string][]string
-	blockType           BlockType
+	clientMatcher       *clientMatcher
+	schedules           clientSchedules
+	blockResponse       blockResponse
+	groupBlockResponse  map[string]blockResponse
+	blockTTL            uint32
 	whitelistOnlyGroups []string
+	groups              []string
 	status              status
+	disabledGroups      *disabledTargets
+	disabledClients     *disabledTargets
+	// recently blocked domains for the block page
+	blockedDomains *cache.Cache
 }
 
-func NewBlockingResolver(router *chi.Mux, cfg config.BlockingConfig) ChainedResolver {
-	bt := resolveBlockType(cfg)
+// BlockedDomain contains the information about a recently blocked domain
+type BlockedDomain struct {
+	Domain string
+	Group  string
+	Reason string
+	Time   time.Time
+}
+
+func NewBlockingResolver(cfg config.BlockingConfig) (ChainedResolver, error) {
+	defaultBlockResponse, err := parseBlockResponse(cfg.BlockType)
+	if err != nil {
+		return nil, err
+	}
+
+	groupBlockResponse := make(map[string]blockResponse, len(cfg.GroupBlockType))
+
+	for group, blockType := range cfg.GroupBlockType {
+		response, err := parseBlockResponse(blockType)
+		if err != nil {
+			return nil, fmt.Errorf("groupBlockType for group '%s': %v", group, err)
+		}
+
+		groupBlockResponse[group] = response
+	}
+
+	schedules, err := newClientSchedules(cfg.Schedules)
+	if err != nil {
+		return nil, err
+	}
+
 	blacklistMatcher := lists.NewListCache(lists.BLACKLIST, cfg.BlackLists, cfg.RefreshPeriod)
 	whitelistMatcher := lists.NewListCache(lists.WHITELIST, cfg.WhiteLists, cfg.RefreshPeriod)
 	whitelistOnlyGroups := determineWhitelistOnlyGroups(&cfg)
@@ -124,11 +222,19 @@ func NewBlockingResolver(router *chi.Mux, cfg config.BlockingConfig) ChainedReso
 	}
 
 	res := &BlockingResolver{
-		blockType:           bt,
+		blockResponse:       defaultBlockResponse,
+		groupBlockResponse:  groupBlockResponse,
+		blockTTL:            resolveBlockTTL(cfg),
 		clientGroupsBlock:   cfg.ClientGroupsBlock,
+		clientMatcher:       newClientMatcher(clientKeys(cfg.ClientGroupsBlock)),
+		schedules:           schedules,
 		blacklistMatcher:    blacklistMatcher,
 		whitelistMatcher:    whitelistMatcher,
 		whitelistOnlyGroups: whitelistOnlyGroups,
+		groups:              determineGroups(&cfg),
+		disabledGroups:      newDisabledTargets("group"),
+		disabledClients:     newDisabledTargets("client"),
+		blockedDomains:      cache.New(time.Duration(resolveBlockTTL(cfg))*time.Second, 10*time.Minute),
 		status: status{
 			enabledGauge: enabledGauge,
 			enabled:      true,
@@ -136,23 +242,86 @@ func NewBlockingResolver(router *chi.Mux, cfg config.BlockingConfig) ChainedReso
 		},
 	}
 
-	// register API endpoints
-	router.Get(api.BlockingEnablePath, res.apiBlockingEnable)
-	router.Get(api.BlockingDisablePath, res.apiBlockingDisable)
-	router.Get(api.BlockingStatusPath, res.apiBlockingStatus)
+	return res, nil
+}
 
-	return res
+// RegisterBlockingAPIEndpoints registers the REST endpoints of the blocking resolver. The handlers call the resolver
+// returned by current, so the endpoints are registered only once and use the new resolver after a config reload
+func RegisterBlockingAPIEndpoints(router chi.Router, current func() *BlockingResolver) {
+	router.Get(api.BlockingEnablePath, func(rw http.ResponseWriter, req *http.Request) {
+		current().apiBlockingEnable(rw, req)
+	})
+	router.Get(api.BlockingDisablePath, func(rw http.ResponseWriter, req *http.Request) {
+		current().apiBlockingDisable(rw, req)
+	})
+	router.Get(api.BlockingStatusPath, func(rw http.ResponseWriter, req *http.Request) {
+		current().apiBlockingStatus(rw, req)
+	})
 }
 
 // apiBlockingEnable is the http endpoint to enable the blocking status
 // @Summary Enable blocking
-// @Description enable the blocking status
+// @Description enable the blocking status. Without groups and clients, blocking will be enabled globally and for all groups and clients
 // @Tags blocking
+// @Param groups query string false "comma separated list of groups to enable" Example(ads,special)
+// @Param clients query string false "comma separated list of clients (name, IP address, wildcard or CIDR) to enable"
 // @Success 200   "Blocking is enabled"
+// @Failure 400   "Unknown group"
 // @Router /blocking/enable [get]
-func (r *BlockingResolver) apiBlockingEnable(_ http.ResponseWriter, _ *http.Request) {
-	log.Info("enabling blocking...")
-	r.status.enableBlocking()
+func (r *BlockingResolver) apiBlockingEnable(rw http.ResponseWriter, req *http.Request) {
+	groups, clients, err := r.parseTargets(req)
+	if err != nil {
+		log.Error(err)
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	if len(groups) == 0 && len(clients) == 0 {
+		log.Info("enabling blocking...")
+		r.status.enableBlocking()
+		r.disabledGroups.enableAll()
+		r.disabledClients.enableAll()
+
+		return
+	}
+
+	r.disabledGroups.enable(groups)
+	r.disabledClients.enable(clients)
+}
+
+// parses the comma separated "groups" and "clients" query parameters, returns error on unknown groups and on the
+// client "default" (it would match all clients without own definition, blocking should be disabled globally instead)
+func (r *BlockingResolver) parseTargets(req *http.Request) (groups, clients []string, err error) {
+	groups = splitParam(req.URL.Query()["groups"])
+	clients = splitParam(req.URL.Query()["clients"])
+
+	for _, group := range groups {
+		if i := sort.SearchStrings(r.groups, group); i == len(r.groups) || r.groups[i] != group {
+			return nil, nil, fmt.Errorf("unknown group '%s'", group)
+		}
+	}
+
+	for _, client := range clients {
+		if client == defaultClientKey {
+			return nil, nil, fmt.Errorf("'%s' is not a client, please disable blocking globally", defaultClientKey)
+		}
+	}
+
+	return groups, clients, nil
+}
+
+// splits comma separated query parameter values, ignores empty values
+func splitParam(values []string) (result []string) {
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				result = append(result, v)
+			}
+		}
+	}
+
+	return
 }
 
 // apiBlockingStatus is the http endpoint to get current blocking status
@@ -171,6 +340,9 @@ func (r *BlockingResolver) apiBlockingStatus(rw http.ResponseWriter, _ *http.Req
 	response, _ := json.Marshal(api.BlockingStatus{
 		Enabled:         r.status.enabled,
 		AutoEnableInSec: uint(autoEnableDuration.Seconds()),
+		ScheduledGroups: r.scheduledGroups(time.Now()),
+		Groups:          r.groupsStatus(),
+		DisabledClients: r.disabledClients.disabled(),
 	})
 	_, err := rw.Write(response)
 
@@ -179,13 +351,40 @@ func (r *BlockingResolver) apiBlockingStatus(rw http.ResponseWriter, _ *http.Req
 	}
 }
 
+// returns the blocking status of all groups
+func (r *BlockingResolver) groupsStatus() (result []api.BlockingTargetStatus) {
+	for _, group := range r.groups {
+		result = append(result, r.disabledGroups.status(group))
+	}
+
+	return
+}
+
+// returns the state of all client groups with schedule
+func (r *BlockingResolver) scheduledGroups(t time.Time) (result []api.ScheduledGroup) {
+	for _, client := range r.schedules.clients() {
+		for _, group := range r.schedules.groups(client) {
+			result = append(result, api.ScheduledGroup{
+				Client:   client,
+				Group:    group,
+				Schedule: r.schedules.describe(client, group),
+				Active:   r.schedules.isActive(client, group, t),
+			})
+		}
+	}
+
+	return
+}
+
 // apiBlockingDisable is the http endpoint to disable the blocking status
 // @Summary Disable blocking
-// @Description disable the blocking status
+// @Description disable the blocking status. Without groups and clients, blocking will be disabled globally
 // @Tags blocking
 // @Param duration query string false "duration of blocking (Example: 300s, 5m, 1h, 5m30s)" Format(duration)
+// @Param groups query string false "comma separated list of groups to disable" Example(ads,special)
+// @Param clients query string false "comma separated list of clients (name, IP address, wildcard or CIDR) to disable"
 // @Success 200   "Blocking is disabled"
-// @Failure 400   "Wrong duration format"
+// @Failure 400   "Wrong duration format or unknown group"
 // @Router /blocking/disable [get]
 func (r *BlockingResolver) apiBlockingDisable(rw http.ResponseWriter, req *http.Request) {
 	var (
@@ -205,7 +404,49 @@ func (r *BlockingResolver) apiBlockingDisable(rw http.ResponseWriter, req *http.
 		}
 	}
 
-	r.status.disableBlocking(duration)
+	groups, clients, err := r.parseTargets(req)
+	if err != nil {
+		log.Error(err)
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	if len(groups) == 0 && len(clients) == 0 {
+		r.status.disableBlocking(duration)
+		return
+	}
+
+	r.disabledGroups.disable(groups, duration)
+	r.disabledClients.disable(clients, duration)
+}
+
+// Close stops the refresh of black and white lists and the timer for blocking status
+func (r *BlockingResolver) Close() error {
+	r.blacklistMatcher.Stop()
+	r.whitelistMatcher.Stop()
+	r.status.enableTimer.Stop()
+	r.disabledGroups.stop()
+	r.disabledClients.stop()
+
+	return nil
+}
+
+// returns all groups of black and white lists, sorted
+func determineGroups(cfg *config.BlockingConfig) (result []string) {
+	for g := range cfg.BlackLists {
+		result = append(result, g)
+	}
+
+	for g := range cfg.WhiteLists {
+		if _, found := cfg.BlackLists[g]; !found {
+			result = append(result, g)
+		}
+	}
+
+	sort.Strings(result)
+
+	return
 }
 
 // returns groups, which have only whitelist entries
@@ -223,30 +464,63 @@ func determineWhitelistOnlyGroups(cfg *config.BlockingConfig) (result []string)
 	return
 }
 
-// sets answer and/or return code for DNS response, if request should be blocked
+// sets answer and/or return code for DNS response, if request should be blocked. The response depends on the
+// block type of the group. Blocked requests with other query types than A and AAAA get an empty answer
+// (zeroIP, custom IP, NODATA), NXDOMAIN or REFUSED
 func (r *BlockingResolver) handleBlocked(logger *log.Entry,
-	request *Request, question dns.Question, reason string) (*Response, error) {
+	request *Request, question dns.Question, reason string, group string) (*Response, error) {
 	response := new(dns.Msg)
 	response.SetReply(request.Req)
 
-	switch r.blockType {
-	case ZeroIP:
-		rr, err := util.CreateAnswerFromQuestion(question, typeToZeroIP[question.Qtype], BlockTTL)
-		if err != nil {
-			return nil, err
-		}
+	blockResp := r.blockResponseForGroup(group)
+
+	switch blockResp.blockType {
+	case ZeroIP, CustomIP:
+		for _, ip := range blockResp.answerIPs(question.Qtype) {
+			rr, err := util.CreateAnswerFromQuestion(question, ip, r.blockTTL)
+			if err != nil {
+				return nil, err
+			}
 
-		response.Answer = append(response.Answer, rr)
+			response.Answer = append(response.Answer, rr)
+		}
 
 	case NxDomain:
 		response.Rcode = dns.RcodeNameError
+
+	case Refused:
+		response.Rcode = dns.RcodeRefused
+
+	case NoData:
+		// empty answer with NOERROR
 	}
 
 	logger.Debugf("blocking request '%s'", reason)
 
+	domain := util.ExtractDomain(question)
+	r.blockedDomains.SetDefault(domain, BlockedDomain{Domain: domain, Group: group, Reason: reason, Time: time.Now()})
+
 	return &Response{Res: response, RType: BLOCKED, Reason: reason}, nil
 }
 
+// BlockedDomain returns the information about the domain, if it was blocked within the block TTL
+func (r *BlockingResolver) BlockedDomain(domain string) (BlockedDomain, bool) {
+	if val, found := r.blockedDomains.Get(strings.ToLower(domain)); found {
+		return val.(BlockedDomain), true
+	}
+
+	return BlockedDomain{}, false
+}
+
+// returns the block response of the group, the default one if the group has no own block type
+func (r *BlockingResolver) blockResponseForGroup(group string) blockResponse {
+	if b, found := r.groupBlockResponse[group]; found {
+		return b
+	}
+
+	return r.blockResponse
+}
+
 func (r *BlockingResolver) Configuration() (result []string) {
 	if len(r.clientGroupsBlock) > 0 {
 		result = append(result, "clientGroupsBlock")
@@ -254,7 +528,16 @@ func (r *BlockingResolver) Configuration() (result []string) {
 			result = append(result, fmt.Sprintf("  %s = \"%s\"", key, strings.Join(val, ";")))
 		}
 
-		result = append(result, fmt.Sprintf("blockType = \"%s\"", r.blockType))
+		result = append(result, fmt.Sprintf("blockType = \"%s\"", r.blockResponse))
+
+		if len(r.groupBlockResponse) > 0 {
+			result = append(result, "groupBlockType:")
+			for group, b := range r.groupBlockResponse {
+				result = append(result, fmt.Sprintf("  %s = \"%s\"", group, b))
+			}
+		}
+
+		result = append(result, fmt.Sprintf("blockTTL = %s", time.Duration(r.blockTTL)*time.Second))
 
 		result = append(result, "blacklist:")
 		for _, c := range r.blacklistMatcher.Configuration() {
@@ -265,6 +548,18 @@ func (r *BlockingResolver) Configuration() (result []string) {
 		for _, c := range r.whitelistMatcher.Configuration() {
 			result = append(result, fmt.Sprintf("  %s", c))
 		}
+
+		if scheduled := r.scheduledGroups(time.Now()); len(scheduled) > 0 {
+			result = append(result, "schedules:")
+			for _, g := range scheduled {
+				state := "inactive"
+				if g.Active {
+					state = "active"
+				}
+
+				result = append(result, fmt.Sprintf("  %s: %s = \"%s\" (%s)", g.Client, g.Group, g.Schedule, state))
+			}
+		}
 	} else {
 		result = []string{"deactivated"}
 	}
@@ -272,34 +567,27 @@ func (r *BlockingResolver) Configuration() (result []string) {
 	return
 }
 
-func shouldHandle(question dns.Question) bool {
-	return question.Qtype == dns.TypeA || question.Qtype == dns.TypeAAAA
-}
-
 func (r *BlockingResolver) handleBlacklist(groupsToCheck []string,
 	request *Request, logger *log.Entry) (*Response, error) {
 	logger.WithField("groupsToCheck", strings.Join(groupsToCheck, "; ")).Debug("checking groups for request")
 	whitelistOnlyAllowed := reflect.DeepEqual(groupsToCheck, r.whitelistOnlyGroups)
 
 	for _, question := range request.Req.Question {
-		if !shouldHandle(question) {
-			return r.next.Resolve(request)
-		}
-
 		domain := util.ExtractDomain(question)
 		logger := logger.WithField("domain", domain)
 
-		if whitelisted, group := r.matches(groupsToCheck, r.whitelistMatcher, domain); whitelisted {
-			logger.WithField("group", group).Debugf("domain is whitelisted")
-			return r.next.Resolve(request)
+		if whitelisted, group, rule := r.matches(groupsToCheck, r.whitelistMatcher, domain); whitelisted {
+			logger.WithFields(log.Fields{"group": group, "rule": rule}).Debugf("domain is whitelisted")
+			return r.GetNext().Resolve(request)
 		}
 
 		if whitelistOnlyAllowed {
-			return r.handleBlocked(logger, request, question, "BLOCKED (WHITELIST ONLY85.100.115.92)")
+			return r.handleBlocked(logger, request, question, "BLOCKED (WHITELIST ONLY85.100.115.92)", "")
 		}
 
-		if blocked, group := r.matches(groupsToCheck, r.blacklistMatcher, domain); blocked {
-			return r.handleBlocked(logger, request, question, fmt.Sprintf("BLOCKED (%s)", group))
+		if blocked, group, rule := r.matches(groupsToCheck, r.blacklistMatcher, domain); blocked {
+			return r.handleBlocked(logger, request, question,
+				fmt.Sprintf("BLOCKED (%s)", matchDescription(group, rule, domain)), group)
 		}
 	}
 
@@ -317,7 +605,7 @@ func (r *BlockingResolver) Resolve(request *Request) (*Response, error) {
 		}
 	}
 
-	respFromNext, err := r.next.Resolve(request)
+	respFromNext, err := r.GetNext().Resolve(request)
 
 	if err == nil && r.status.enabled && len(groupsToCheck) > 0 && respFromNext.Res != nil {
 		for _, rr := range respFromNext.Res.Answer {
@@ -325,10 +613,11 @@ func (r *BlockingResolver) Resolve(request *Request) (*Response, error) {
 			if len(entryToCheck) > 0 {
 				logger := logger.WithField("response_entry", entryToCheck)
 
-				if whitelisted, group := r.matches(groupsToCheck, r.whitelistMatcher, entryToCheck); whitelisted {
-					logger.WithField("group", group).Debugf("%s is whitelisted", tName)
-				} else if blocked, group := r.matches(groupsToCheck, r.blacklistMatcher, entryToCheck); blocked {
-					return r.handleBlocked(logger, request, request.Req.Question[0], fmt.Sprintf("BLOCKED %s (%s)", tName, group))
+				if whitelisted, group, rule := r.matches(groupsToCheck, r.whitelistMatcher, entryToCheck); whitelisted {
+					logger.WithFields(log.Fields{"group": group, "rule": rule}).Debugf("%s is whitelisted", tName)
+				} else if blocked, group, rule := r.matches(groupsToCheck, r.blacklistMatcher, entryToCheck); blocked {
+					return r.handleBlocked(logger, request, request.Req.Question[0],
+						fmt.Sprintf("BLOCKED %s (%s)", tName, matchDescription(group, rule, entryToCheck)), group)
 				}
 			}
 		}
@@ -348,48 +637,72 @@ func extractEntryToCheckFromResponse(rr dns.RR) (entryToCheck string, tName stri
 	case *dns.CNAME:
 		entryToCheck = util.ExtractDomainOnly(v.Target)
 		tName = "CNAME"
+	case *dns.MX:
+		entryToCheck = util.ExtractDomainOnly(v.Mx)
+		tName = "MX"
+	case *dns.SRV:
+		entryToCheck = util.ExtractDomainOnly(v.Target)
+		tName = "SRV"
 	}
 
 	return
 }
 
-// returns groups which should be checked for client's request
+// returns groups which should be checked for client's request: the union of the groups of all matching client keys
+// (client names, wildcard names, IP address, CIDRs), "default" if no key matches. Groups outside of the client's schedule and
+// disabled groups are skipped, no groups will be checked if blocking is disabled for the client
 func (r *BlockingResolver) groupsToCheckForClient(request *Request) (groups []string) {
-	// try client names
-	for _, cName := range request.ClientNames {
-		groupsByName, found := r.clientGroupsBlock[cName]
-		if found {
-			groups = append(groups, groupsByName...)
-		}
+	if r.disabledClients.isClientDisabled(request.ClientNames, request.ClientIP) {
+		return nil
 	}
 
-	// try IP
-	groupsByIP, found := r.clientGroupsBlock[request.ClientIP.String()]
+	unique := make(map[string]bool)
+	now := time.Now()
 
-	if found {
-		groups = append(groups, groupsByIP...)
-	}
+	for _, key := range r.clientMatcher.matchAll(request.ClientNames, request.ClientIP) {
+		for _, group := range r.clientGroupsBlock[key] {
+			if !unique[group] && r.schedules.isActive(key, group, now) {
+				unique[group] = true
 
-	if len(groups) == 0 {
-		if !found {
-			// return default
-			groups = r.clientGroupsBlock["default"]
+				groups = append(groups, group)
+			}
 		}
 	}
 
+	groups = r.disabledGroups.filterEnabled(groups)
+
 	sort.Strings(groups)
 
 	return
 }
 
+// returns the keys of the client to groups mapping
+func clientKeys(clientGroups map[string][]string) []string {
+	keys := make([]string, 0, len(clientGroups))
+	for key := range clientGroups {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
 func (r *BlockingResolver) matches(groupsToCheck []string, m lists.Matcher,
-	domain string) (blocked bool, group string) {
+	domain string) (blocked bool, group string, rule string) {
 	if len(groupsToCheck) > 0 {
-		found, group := m.Match(domain, groupsToCheck)
+		found, group, rule := m.Match(domain, groupsToCheck)
 		if found {
-			return true, group
+			return true, group, rule
 		}
 	}
 
-	return false, ""
+	return false, "", ""
+}
+
+// returns the group and the matching rule, if the rule is not the entry itself (wildcard or regex)
+func matchDescription(group, rule, entry string) string {
+	if rule == "" || rule == entry {
+		return group
+	}
+
+	return fmt.Sprintf("%s: %s", group, rule)
 }
@@ -12,7 +12,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/go-chi/chi"
 	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -23,12 +22,13 @@ func Test_Resolve_ClientName_IpZero(t *testing.T) {
 	file := helpertest.TempFile("blocked1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"client1": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 	req := util.NewMsgWithQuestion("blocked1.com.", dns.TypeA)
 
 	// A
@@ -60,12 +60,13 @@ func Test_Resolve_ClientIp_A_IpZero(t *testing.T) {
 	file := helpertest.TempFile("blocked1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"192.168.178.55": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	req := util.NewMsgWithQuestion("blocked1.com.", dns.TypeA)
 
@@ -80,6 +81,90 @@ func Test_Resolve_ClientIp_A_IpZero(t *testing.T) {
 	assert.Equal(t, "blocked1.com.	21600	IN	A	0.0.0.0", resp.Res.Answer[0].String())
 }
 
+func Test_Resolve_ClientCIDRAndWildcard(t *testing.T) {
+	file1 := helpertest.TempFile("blocked1.com")
+	defer file1.Close()
+
+	file2 := helpertest.TempFile("blocked2.com")
+	defer file2.Close()
+
+	chained, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{
+			"gr1": {file1.Name()},
+			"gr2": {file2.Name()},
+		},
+		ClientGroupsBlock: map[string][]string{
+			"laptop-*":         {"gr2"},
+			"192.168.178.0/24": {"gr1"},
+			"default":          {"gr2"},
+		},
+	})
+	assert.NoError(t, err)
+
+	sut := chained.(*BlockingResolver)
+
+	tests := []struct {
+		name        string
+		clientNames []string
+		clientIP    string
+		expected    []string
+	}{
+		{"wildcard name and CIDR", []string{"laptop-kid"}, "192.168.178.55", []string{"gr1", "gr2"}},
+		{"CIDR", []string{"unknown"}, "192.168.178.55", []string{"gr1"}},
+		{"default", []string{"unknown"}, "192.168.179.55", []string{"gr2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sut.groupsToCheckForClient(&Request{
+				ClientNames: tt.clientNames,
+				ClientIP:    net.ParseIP(tt.clientIP),
+			}))
+		})
+	}
+
+	resp, err := sut.Resolve(&Request{
+		Req:         util.NewMsgWithQuestion("blocked1.com.", dns.TypeA),
+		ClientNames: []string{"unknown"},
+		ClientIP:    net.ParseIP("192.168.178.55"),
+		Log:         logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "blocked1.com.	21600	IN	A	0.0.0.0", resp.Res.Answer[0].String())
+}
+
+func Test_Resolve_ClientNameAndIP_Union(t *testing.T) {
+	file1 := helpertest.TempFile("blocked1.com")
+	defer file1.Close()
+
+	file2 := helpertest.TempFile("blocked2.com")
+	defer file2.Close()
+
+	sut, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{
+			"gr1": {file1.Name()},
+			"gr2": {file2.Name()},
+		},
+		ClientGroupsBlock: map[string][]string{
+			"client1":          {"gr1"},
+			"192.168.178.0/24": {"gr2"},
+		},
+	})
+	assert.NoError(t, err)
+
+	// groups of the client name and of the network are both applied
+	for _, domain := range []string{"blocked1.com.", "blocked2.com."} {
+		resp, err := sut.Resolve(&Request{
+			Req:         util.NewMsgWithQuestion(domain, dns.TypeA),
+			ClientNames: []string{"client1"},
+			ClientIP:    net.ParseIP("192.168.178.55"),
+			Log:         logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, domain+"	21600	IN	A	0.0.0.0", resp.Res.Answer[0].String())
+	}
+}
+
 func Test_Resolve_ClientWith2Names_A_IpZero(t *testing.T) {
 	file1 := helpertest.TempFile("blocked1.com")
 	defer file1.Close()
@@ -87,7 +172,7 @@ func Test_Resolve_ClientWith2Names_A_IpZero(t *testing.T) {
 	file2 := helpertest.TempFile("blocked2.com")
 	defer file2.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{
 			"gr1": {file1.Name()},
 			"gr2": {file2.Name()},
@@ -97,6 +182,7 @@ func Test_Resolve_ClientWith2Names_A_IpZero(t *testing.T) {
 			"altName": {"gr2"},
 		},
 	})
+	assert.NoError(t, err)
 
 	// request in gr1
 	req := util.NewMsgWithQuestion("blocked1.com.", dns.TypeA)
@@ -127,12 +213,13 @@ func Test_Resolve_Default_A_IpZero(t *testing.T) {
 	file := helpertest.TempFile("blocked1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	req := util.NewMsgWithQuestion("blocked1.com.", dns.TypeA)
 	resp, err := sut.Resolve(&Request{
@@ -150,12 +237,15 @@ func Test_Disable_Blocking(t *testing.T) {
 	file := helpertest.TempFile("blocked1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	chained, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
-	}).(*BlockingResolver)
+	})
+	assert.NoError(t, err)
+
+	sut := chained.(*BlockingResolver)
 
 	m := &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(new(Response), nil)
@@ -196,7 +286,10 @@ func Test_Disable_Blocking(t *testing.T) {
 }
 
 func Test_Disable_BlockingWithWrongParam(t *testing.T) {
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{}).(*BlockingResolver)
+	chained, err := NewBlockingResolver(config.BlockingConfig{})
+	assert.NoError(t, err)
+
+	sut := chained.(*BlockingResolver)
 
 	r, _ := http.NewRequest("GET", "/api/blocking/disable?duration=xyz", nil)
 
@@ -209,7 +302,10 @@ func Test_Disable_BlockingWithWrongParam(t *testing.T) {
 }
 
 func Test_Status_Blocking(t *testing.T) {
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{}).(*BlockingResolver)
+	chained, err := NewBlockingResolver(config.BlockingConfig{})
+	assert.NoError(t, err)
+
+	sut := chained.(*BlockingResolver)
 
 	// enable blocking
 	r, _ := http.NewRequest("GET", "/api/blocking/enable", nil)
@@ -230,7 +326,7 @@ func Test_Status_Blocking(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var result api.BlockingStatus
-	err := json.NewDecoder(rr.Body).Decode(&result)
+	err = json.NewDecoder(rr.Body).Decode(&result)
 	assert.NoError(t, err)
 
 	assert.True(t, result.Enabled)
@@ -266,12 +362,15 @@ func Test_Disable_BlockingWithDuration(t *testing.T) {
 	file := helpertest.TempFile("blocked1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	chained, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
-	}).(*BlockingResolver)
+	})
+	assert.NoError(t, err)
+
+	sut := chained.(*BlockingResolver)
 
 	m := &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(new(Response), nil)
@@ -330,20 +429,21 @@ func Test_Resolve_Default_Block_With_Whitelist(t *testing.T) {
 	file := helpertest.TempFile("blocked1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		WhiteLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(new(Response), nil)
 	sut.Next(m)
 
 	req := util.NewMsgWithQuestion("blocked1.com.", dns.TypeA)
-	_, err := sut.Resolve(&Request{
+	_, err = sut.Resolve(&Request{
 		Req:         req,
 		ClientNames: []string{"unknown"},
 		ClientIP:    net.ParseIP("192.168.178.1"),
@@ -357,19 +457,20 @@ func Test_Resolve_Whitelist_Only(t *testing.T) {
 	file := helpertest.TempFile("whitelisted.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		WhiteLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(new(Response), nil)
 	sut.Next(m)
 
 	req := util.NewMsgWithQuestion("whitelisted.com.", dns.TypeA)
-	_, err := sut.Resolve(&Request{
+	_, err = sut.Resolve(&Request{
 		Req:         req,
 		ClientNames: []string{"unknown"},
 		ClientIP:    net.ParseIP("192.168.178.1"),
@@ -415,13 +516,14 @@ func Test_Resolve_Default_A_NxRecord(t *testing.T) {
 	file := helpertest.TempFile("BLOCKED1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 		BlockType: "NxDomain",
 	})
+	assert.NoError(t, err)
 
 	req := util.NewMsgWithQuestion("blocked1.com.", dns.TypeA)
 	resp, err := sut.Resolve(&Request{
@@ -438,12 +540,13 @@ func Test_Resolve_Default_BlockIP_A(t *testing.T) {
 	file := helpertest.TempFile("123.145.123.145")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 	mockResp, _ := util.NewMsgWithAnswer("example.com. 300 IN A 123.145.123.145")
@@ -467,12 +570,13 @@ func Test_Resolve_Default_BlockIP_AAAA(t *testing.T) {
 	file := helpertest.TempFile("2001:db8:85a3:08d3::370:7344")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 	mockResp, _ := util.NewMsgWithAnswer("example.com. 300 IN AAAA 2001:0db8:85a3:08d3::0370:7344")
@@ -497,13 +601,14 @@ func Test_Resolve_Default_BlockIP_A_With_Whitelist(t *testing.T) {
 	file := helpertest.TempFile("123.145.123.145")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		WhiteLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 	mockResp, _ := util.NewMsgWithAnswer("example.com. 300 IN A 123.145.123.145")
@@ -512,7 +617,7 @@ func Test_Resolve_Default_BlockIP_A_With_Whitelist(t *testing.T) {
 	sut.Next(m)
 
 	req := util.NewMsgWithQuestion("blocked1.com.", dns.TypeA)
-	_, err := sut.Resolve(&Request{
+	_, err = sut.Resolve(&Request{
 		Req:         req,
 		ClientNames: []string{"unknown"},
 		ClientIP:    net.ParseIP("123.145.123.145"),
@@ -522,16 +627,51 @@ func Test_Resolve_Default_BlockIP_A_With_Whitelist(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+func Test_Resolve_Wildcard_Reason(t *testing.T) {
+	file := helpertest.TempFile("*.doubleclick.net\n/^ads?\\./")
+	defer file.Close()
+
+	sut, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{"gr1": {file.Name()}},
+		ClientGroupsBlock: map[string][]string{
+			"default": {"gr1"},
+		},
+	})
+	assert.NoError(t, err)
+
+	req := util.NewMsgWithQuestion("ad.doubleclick.net.", dns.TypeA)
+	resp, err := sut.Resolve(&Request{
+		Req:         req,
+		ClientNames: []string{"unknown"},
+		ClientIP:    net.ParseIP("192.168.178.1"),
+		Log:         logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "BLOCKED (gr1: *.doubleclick.net)", resp.Reason)
+	assert.Equal(t, "ad.doubleclick.net.	21600	IN	A	0.0.0.0", resp.Res.Answer[0].String())
+
+	req = util.NewMsgWithQuestion("ads.example.com.", dns.TypeA)
+	resp, err = sut.Resolve(&Request{
+		Req:         req,
+		ClientNames: []string{"unknown"},
+		ClientIP:    net.ParseIP("192.168.178.1"),
+		Log:         logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "BLOCKED (gr1: /^ads?\\./)", resp.Reason)
+}
+
 func Test_Resolve_Default_Block_CNAME(t *testing.T) {
 	file := helpertest.TempFile("baddomain.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 
@@ -565,19 +705,20 @@ func Test_Resolve_NoBlock(t *testing.T) {
 	file := helpertest.TempFile("blocked1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"client1": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(new(Response), nil)
 	sut.Next(m)
 
 	req := util.NewMsgWithQuestion("example.com.", dns.TypeA)
-	_, err := sut.Resolve(&Request{
+	_, err = sut.Resolve(&Request{
 		Req:         req,
 		ClientNames: []string{"unknown"},
 		ClientIP:    net.ParseIP("192.168.178.1"),
@@ -591,40 +732,43 @@ func Test_Configuration_BlockingResolver(t *testing.T) {
 	file := helpertest.TempFile("blocked1.com")
 	defer file.Close()
 
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+	sut, err := NewBlockingResolver(config.BlockingConfig{
 		BlackLists: map[string][]string{"gr1": {file.Name()}},
 		WhiteLists: map[string][]string{"gr1": {file.Name()}},
 		ClientGroupsBlock: map[string][]string{
 			"default": {"gr1"},
 		},
 	})
+	assert.NoError(t, err)
 
 	c := sut.Configuration()
 	assert.True(t, len(c) > 1)
 }
 
 func Test_Resolve_WrongBlockType(t *testing.T) {
-	defer func() { logrus.StandardLogger().ExitFunc = nil }()
-
-	var fatal bool
+	_, err := NewBlockingResolver(config.BlockingConfig{
+		BlockType: "wrong",
+	})
 
-	logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
+	assert.Error(t, err)
 
-	_ = NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
-		BlockType: "wrong",
+	_, err = NewBlockingResolver(config.BlockingConfig{
+		BlackLists:     map[string][]string{"ads": {}},
+		GroupBlockType: map[string]string{"ads": "wrong"},
 	})
 
-	assert.True(t, fatal)
+	assert.Error(t, err)
 }
 
 func Test_Resolve_NoLists(t *testing.T) {
-	sut := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{})
+	sut, err := NewBlockingResolver(config.BlockingConfig{})
+	assert.NoError(t, err)
 	m := &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(new(Response), nil)
 	sut.Next(m)
 
 	req := util.NewMsgWithQuestion("example.com.", dns.TypeA)
-	_, err := sut.Resolve(&Request{
+	_, err = sut.Resolve(&Request{
 		Req:         req,
 		ClientNames: []string{"unknown"},
 		ClientIP:    net.ParseIP("192.168.178.1"),
@@ -637,3 +781,399 @@ func Test_Resolve_NoLists(t *testing.T) {
 
 	assert.Equal(t, []string{"deactivated"}, c)
 }
+
+func Test_Resolve_Schedules(t *testing.T) {
+	file := helpertest.TempFile("blocked1.com")
+	defer file.Close()
+
+	// whole day, but only on a day which is not today
+	otherDay := time.Now().UTC().AddDate(0, 0, 3).Weekday().String()
+
+	chained, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{"gr1": {file.Name()}, "gr2": {file.Name()}},
+		ClientGroupsBlock: map[string][]string{
+			"client1": {"gr1"},
+			"client2": {"gr2"},
+			"client3": {"gr2"},
+		},
+		Schedules: map[string]map[string][]config.BlockingSchedule{
+			"client1": {"gr1": {{From: "00:00", To: "00:00", Timezone: "UTC"}}},
+			"client2": {"gr2": {{Days: []string{otherDay}, From: "00:00", To: "00:00", Timezone: "UTC"}}},
+		},
+	})
+	assert.NoError(t, err)
+
+	sut := chained.(*BlockingResolver)
+
+	m := &resolverMock{}
+	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+	sut.Next(m)
+
+	// group with active schedule blocks
+	resp, err := sut.Resolve(&Request{
+		Req:         util.NewMsgWithQuestion("blocked1.com.", dns.TypeA),
+		ClientNames: []string{"client1"},
+		Log:         logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, BLOCKED, resp.RType)
+
+	// group outside of schedule doesn't block
+	resp, err = sut.Resolve(&Request{
+		Req:         util.NewMsgWithQuestion("blocked1.com.", dns.TypeA),
+		ClientNames: []string{"client2"},
+		Log:         logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.NotEqual(t, BLOCKED, resp.RType)
+	m.AssertExpectations(t)
+
+	// same group without schedule for another client blocks
+	resp, err = sut.Resolve(&Request{
+		Req:         util.NewMsgWithQuestion("blocked1.com.", dns.TypeA),
+		ClientNames: []string{"client3"},
+		Log:         logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, BLOCKED, resp.RType)
+
+	// status contains the scheduled groups
+	r, _ := http.NewRequest("GET", "/api/blocking/status", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(sut.apiBlockingStatus).ServeHTTP(rr, r)
+
+	var result api.BlockingStatus
+	err = json.NewDecoder(rr.Body).Decode(&result)
+	assert.NoError(t, err)
+
+	assert.Len(t, result.ScheduledGroups, 2)
+	assert.Equal(t, "client1", result.ScheduledGroups[0].Client)
+	assert.Equal(t, "gr1", result.ScheduledGroups[0].Group)
+	assert.Equal(t, "every day 00:00-00:00 (UTC)", result.ScheduledGroups[0].Schedule)
+	assert.True(t, result.ScheduledGroups[0].Active)
+	assert.Equal(t, "client2", result.ScheduledGroups[1].Client)
+	assert.Equal(t, "gr2", result.ScheduledGroups[1].Group)
+	assert.False(t, result.ScheduledGroups[1].Active)
+
+	assert.Contains(t, sut.Configuration(), "schedules:")
+}
+
+//nolint:funlen
+func Test_Disable_BlockingForGroupsAndClients(t *testing.T) {
+	file := helpertest.TempFile("blocked1.com")
+	defer file.Close()
+
+	chained, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{"gr1": {file.Name()}, "gr2": {file.Name()}},
+		ClientGroupsBlock: map[string][]string{
+			"client1": {"gr1"},
+			"client2": {"gr2"},
+		},
+	})
+	assert.NoError(t, err)
+
+	sut := chained.(*BlockingResolver)
+	defer sut.Close()
+
+	m := &resolverMock{}
+	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+	sut.Next(m)
+
+	resolve := func(client string, ip string) ResponseType {
+		resp, err := sut.Resolve(&Request{
+			Req:         util.NewMsgWithQuestion("blocked1.com.", dns.TypeA),
+			ClientNames: []string{client},
+			ClientIP:    net.ParseIP(ip),
+			Log:         logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+
+		return resp.RType
+	}
+
+	call := func(handler http.HandlerFunc, query string) int {
+		r, _ := http.NewRequest("GET", "/api/blocking?"+query, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		return rr.Code
+	}
+
+	status := func() (result api.BlockingStatus) {
+		r, _ := http.NewRequest("GET", "/api/blocking/status", nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(sut.apiBlockingStatus).ServeHTTP(rr, r)
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+
+		return
+	}
+
+	// disable group gr1 -> only client2 is blocked
+	assert.Equal(t, http.StatusOK, call(sut.apiBlockingDisable, "groups=gr1"))
+	assert.Equal(t, RESOLVED, resolve("client1", "192.168.178.1"))
+	assert.Equal(t, BLOCKED, resolve("client2", "192.168.178.2"))
+
+	s := status()
+	assert.True(t, s.Enabled)
+	assert.Equal(t, []api.BlockingTargetStatus{{Name: "gr1"}, {Name: "gr2", Enabled: true}}, s.Groups)
+
+	// disable client by CIDR
+	assert.Equal(t, http.StatusOK, call(sut.apiBlockingDisable, "clients=192.168.178.0/24&duration=1h"))
+	assert.Equal(t, RESOLVED, resolve("client2", "192.168.178.2"))
+	assert.Equal(t, BLOCKED, resolve("client2", "10.0.0.2"))
+
+	s = status()
+	assert.Len(t, s.DisabledClients, 1)
+	assert.Equal(t, "192.168.178.0/24", s.DisabledClients[0].Name)
+	assert.True(t, s.DisabledClients[0].AutoEnableInSec > 3500)
+
+	// enable group gr1 again
+	assert.Equal(t, http.StatusOK, call(sut.apiBlockingEnable, "groups=gr1"))
+	assert.Equal(t, BLOCKED, resolve("client1", "10.0.0.1"))
+	assert.Equal(t, RESOLVED, resolve("client1", "192.168.178.1"))
+
+	// unknown group
+	assert.Equal(t, http.StatusBadRequest, call(sut.apiBlockingDisable, "groups=unknown"))
+	assert.Equal(t, http.StatusBadRequest, call(sut.apiBlockingEnable, "groups=gr1,unknown"))
+
+	// "default" is not a client
+	assert.Equal(t, http.StatusBadRequest, call(sut.apiBlockingDisable, "clients=laptop,default"))
+	assert.Equal(t, http.StatusBadRequest, call(sut.apiBlockingEnable, "clients=default"))
+	assert.Equal(t, BLOCKED, resolve("client1", "10.0.0.1"))
+
+	// enable without parameters enables all
+	assert.Equal(t, http.StatusOK, call(sut.apiBlockingEnable, ""))
+	assert.Equal(t, BLOCKED, resolve("client1", "192.168.178.1"))
+	assert.Empty(t, status().DisabledClients)
+}
+
+func Test_Disable_BlockingForGroupWithDuration(t *testing.T) {
+	file := helpertest.TempFile("blocked1.com")
+	defer file.Close()
+
+	chained, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{"gr1": {file.Name()}},
+		ClientGroupsBlock: map[string][]string{
+			"default": {"gr1"},
+		},
+	})
+	assert.NoError(t, err)
+
+	sut := chained.(*BlockingResolver)
+
+	m := &resolverMock{}
+	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+	sut.Next(m)
+
+	sut.disabledGroups.disable([]string{"gr1"}, 10*time.Millisecond)
+	assert.Empty(t, sut.groupsToCheckForClient(&Request{ClientNames: []string{"client1"}}))
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, []string{"gr1"}, sut.groupsToCheckForClient(&Request{ClientNames: []string{"client1"}}))
+}
+
+func Test_Resolve_OtherQueryTypes(t *testing.T) {
+	file := helpertest.TempFile("blocked1.com")
+	defer file.Close()
+
+	const typeHTTPS = 65
+
+	tests := []struct {
+		name      string
+		blockType string
+		qType     uint16
+		rcode     int
+	}{
+		{name: "MX, zeroIP", blockType: "zeroIP", qType: dns.TypeMX, rcode: dns.RcodeSuccess},
+		{name: "TXT, zeroIP", blockType: "zeroIP", qType: dns.TypeTXT, rcode: dns.RcodeSuccess},
+		{name: "CNAME, zeroIP", blockType: "zeroIP", qType: dns.TypeCNAME, rcode: dns.RcodeSuccess},
+		{name: "HTTPS, zeroIP", blockType: "zeroIP", qType: typeHTTPS, rcode: dns.RcodeSuccess},
+		{name: "SRV, zeroIP", blockType: "zeroIP", qType: dns.TypeSRV, rcode: dns.RcodeSuccess},
+		{name: "MX, nxDomain", blockType: "nxDomain", qType: dns.TypeMX, rcode: dns.RcodeNameError},
+		{name: "HTTPS, nxDomain", blockType: "nxDomain", qType: typeHTTPS, rcode: dns.RcodeNameError},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sut, err := NewBlockingResolver(config.BlockingConfig{
+				BlackLists: map[string][]string{"gr1": {file.Name()}},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"gr1"},
+				},
+				BlockType: tt.blockType,
+			})
+			assert.NoError(t, err)
+
+			m := &resolverMock{}
+			sut.Next(m)
+
+			resp, err := sut.Resolve(&Request{
+				Req:         util.NewMsgWithQuestion("blocked1.com.", tt.qType),
+				ClientNames: []string{"unknown"},
+				ClientIP:    net.ParseIP("192.168.178.1"),
+				Log:         logrus.NewEntry(logrus.New()),
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, BLOCKED, resp.RType)
+			assert.Equal(t, tt.rcode, resp.Res.Rcode)
+			assert.Empty(t, resp.Res.Answer)
+			m.AssertNotCalled(t, "Resolve", mock.Anything)
+		})
+	}
+}
+
+func Test_Resolve_Default_Block_MX_Target(t *testing.T) {
+	file := helpertest.TempFile("mail.baddomain.com")
+	defer file.Close()
+
+	sut, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{"gr1": {file.Name()}},
+		ClientGroupsBlock: map[string][]string{
+			"default": {"gr1"},
+		},
+	})
+	assert.NoError(t, err)
+
+	m := &resolverMock{}
+
+	rr, err := dns.NewRR("example.com 300 IN MX 10 mail.baddomain.com")
+	assert.NoError(t, err)
+
+	mockResp := new(dns.Msg)
+	mockResp.Answer = []dns.RR{rr}
+
+	m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil)
+	sut.Next(m)
+
+	resp, err := sut.Resolve(&Request{
+		Req:         util.NewMsgWithQuestion("example.com.", dns.TypeMX),
+		ClientNames: []string{"unknown"},
+		ClientIP:    net.ParseIP("192.168.178.1"),
+		Log:         logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, BLOCKED, resp.RType)
+	assert.Equal(t, "BLOCKED MX (gr1)", resp.Reason)
+	assert.Equal(t, dns.RcodeSuccess, resp.Res.Rcode)
+	assert.Empty(t, resp.Res.Answer)
+}
+
+func Test_Resolve_Whitelisted_OtherQueryType(t *testing.T) {
+	file := helpertest.TempFile("blocked1.com")
+	defer file.Close()
+
+	sut, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{"gr1": {file.Name()}},
+		WhiteLists: map[string][]string{"gr1": {file.Name()}},
+		ClientGroupsBlock: map[string][]string{
+			"default": {"gr1"},
+		},
+	})
+	assert.NoError(t, err)
+
+	m := &resolverMock{}
+	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), RType: RESOLVED}, nil)
+	sut.Next(m)
+
+	resp, err := sut.Resolve(&Request{
+		Req:         util.NewMsgWithQuestion("blocked1.com.", dns.TypeTXT),
+		ClientNames: []string{"unknown"},
+		ClientIP:    net.ParseIP("192.168.178.1"),
+		Log:         logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, RESOLVED, resp.RType)
+	m.AssertExpectations(t)
+}
+
+//nolint:funlen
+func Test_Resolve_BlockTypes(t *testing.T) {
+	file1 := helpertest.TempFile("blocked1.com")
+	defer file1.Close()
+
+	file2 := helpertest.TempFile("blocked2.com")
+	defer file2.Close()
+
+	sut, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{
+			"custom":  {file1.Name()},
+			"refused": {file2.Name()},
+		},
+		ClientGroupsBlock: map[string][]string{
+			"default": {"custom", "refused"},
+		},
+		BlockType:      "192.168.178.100, 192.168.178.101, fd00::100",
+		GroupBlockType: map[string]string{"refused": "refused"},
+		BlockTTL:       time.Minute,
+	})
+	assert.NoError(t, err)
+
+	resolve := func(domain string, qType uint16) *Response {
+		resp, err := sut.Resolve(&Request{
+			Req:         util.NewMsgWithQuestion(domain, qType),
+			ClientNames: []string{"client1"},
+			ClientIP:    net.ParseIP("192.168.178.1"),
+			Log:         logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, BLOCKED, resp.RType)
+
+		return resp
+	}
+
+	// custom IPs, IPv4 for A
+	resp := resolve("blocked1.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Res.Rcode)
+	assert.Len(t, resp.Res.Answer, 2)
+	assert.Equal(t, "blocked1.com.	60	IN	A	192.168.178.100", resp.Res.Answer[0].String())
+	assert.Equal(t, "blocked1.com.	60	IN	A	192.168.178.101", resp.Res.Answer[1].String())
+
+	// custom IPs, IPv6 for AAAA
+	resp = resolve("blocked1.com.", dns.TypeAAAA)
+	assert.Len(t, resp.Res.Answer, 1)
+	assert.Equal(t, "blocked1.com.	60	IN	AAAA	fd00::100", resp.Res.Answer[0].String())
+
+	// custom IPs, other query type: empty answer
+	resp = resolve("blocked1.com.", dns.TypeMX)
+	assert.Equal(t, dns.RcodeSuccess, resp.Res.Rcode)
+	assert.Empty(t, resp.Res.Answer)
+
+	// block type of the group
+	resp = resolve("blocked2.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeRefused, resp.Res.Rcode)
+	assert.Empty(t, resp.Res.Answer)
+
+	c := sut.Configuration()
+	assert.Contains(t, c, `blockType = "192.168.178.100, 192.168.178.101, fd00::100"`)
+	assert.Contains(t, c, `  refused = "Refused"`)
+	assert.Contains(t, c, "blockTTL = 1m0s")
+}
+
+func Test_Resolve_NoData(t *testing.T) {
+	file := helpertest.TempFile("blocked1.com")
+	defer file.Close()
+
+	sut, err := NewBlockingResolver(config.BlockingConfig{
+		BlackLists: map[string][]string{"gr1": {file.Name()}},
+		ClientGroupsBlock: map[string][]string{
+			"default": {"gr1"},
+		},
+		BlockType: "NODATA",
+	})
+	assert.NoError(t, err)
+
+	for _, qType := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT} {
+		resp, err := sut.Resolve(&Request{
+			Req:         util.NewMsgWithQuestion("blocked1.com.", qType),
+			ClientNames: []string{"unknown"},
+			ClientIP:    net.ParseIP("192.168.178.1"),
+			Log:         logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, BLOCKED, resp.RType)
+		assert.Equal(t, dns.RcodeSuccess, resp.Res.Rcode)
+		assert.Empty(t, resp.Res.Answer)
+	}
+}
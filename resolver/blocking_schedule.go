@@ -0,0 +1,185 @@
+package resolver
+
+import (
+	"blocky/config"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// blockingSchedule is a time window on certain days of week, in which a group is active
+type blockingSchedule struct {
+	// empty: every day
+	days     map[time.Weekday]bool
+	from     int
+	to       int
+	location *time.Location
+}
+
+func newBlockingSchedule(cfg config.BlockingSchedule) (*blockingSchedule, error) {
+	s := &blockingSchedule{days: make(map[time.Weekday]bool)}
+
+	for _, day := range cfg.Days {
+		d, err := config.ParseWeekday(day)
+		if err != nil {
+			return nil, err
+		}
+
+		s.days[d] = true
+	}
+
+	var err error
+
+	if s.from, err = parseMinuteOfDay(cfg.From); err != nil {
+		return nil, err
+	}
+
+	if s.to, err = parseMinuteOfDay(cfg.To); err != nil {
+		return nil, err
+	}
+
+	s.location = time.UTC
+
+	if cfg.Timezone != "" {
+		if s.location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown time zone '%s'", cfg.Timezone)
+		}
+	}
+
+	return s, nil
+}
+
+// returns the minutes since midnight for time in format "HH:MM"
+func parseMinuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("wrong time format '%s', please use HH:MM", s)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// returns true if the day is in the schedule
+func (s *blockingSchedule) hasDay(day time.Weekday) bool {
+	return len(s.days) == 0 || s.days[day]
+}
+
+// isActive returns true if t is within the time window. A window crossing midnight belongs to the day of its start
+func (s *blockingSchedule) isActive(t time.Time) bool {
+	t = t.In(s.location)
+	minute := t.Hour()*60 + t.Minute()
+
+	switch {
+	case s.from == s.to:
+		// whole day
+		return s.hasDay(t.Weekday())
+	case s.from < s.to:
+		return s.hasDay(t.Weekday()) && minute >= s.from && minute < s.to
+	default:
+		// window crosses midnight
+		yesterday := (t.Weekday() + 6) % 7
+
+		return (s.hasDay(t.Weekday()) && minute >= s.from) || (s.hasDay(yesterday) && minute < s.to)
+	}
+}
+
+func (s *blockingSchedule) String() string {
+	days := "every day"
+
+	if len(s.days) > 0 {
+		weekdays := make([]time.Weekday, 0, len(s.days))
+		for d := range s.days {
+			weekdays = append(weekdays, d)
+		}
+
+		// begin with monday
+		sort.Slice(weekdays, func(i, j int) bool {
+			return (weekdays[i]+6)%7 < (weekdays[j]+6)%7
+		})
+
+		names := make([]string, len(weekdays))
+		for i, d := range weekdays {
+			names[i] = d.String()[:3]
+		}
+
+		days = strings.Join(names, ",")
+	}
+
+	return fmt.Sprintf("%s %02d:%02d-%02d:%02d (%s)", days, s.from/60, s.from%60, s.to/60, s.to%60, s.location)
+}
+
+// clientSchedules contains the schedules of the clientGroupsBlock entries with time restriction:
+// client -> group -> schedules
+type clientSchedules map[string]map[string][]*blockingSchedule
+
+func newClientSchedules(cfg map[string]map[string][]config.BlockingSchedule) (clientSchedules, error) {
+	result := make(clientSchedules, len(cfg))
+
+	for client, groups := range cfg {
+		result[client] = make(map[string][]*blockingSchedule, len(groups))
+
+		for group, schedules := range groups {
+			for _, c := range schedules {
+				s, err := newBlockingSchedule(c)
+				if err != nil {
+					return nil, fmt.Errorf("invalid schedule for group '%s' of client '%s': %v", group, client, err)
+				}
+
+				result[client][group] = append(result[client][group], s)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// isActive returns true if the group of the client has no schedule or t is within one of its schedules
+func (c clientSchedules) isActive(client, group string, t time.Time) bool {
+	schedules, found := c[client][group]
+	if !found {
+		return true
+	}
+
+	for _, s := range schedules {
+		if s.isActive(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the names of all clients with schedules, sorted
+func (c clientSchedules) clients() []string {
+	result := make([]string, 0, len(c))
+	for client := range c {
+		result = append(result, client)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// returns the names of all scheduled groups of the client, sorted
+func (c clientSchedules) groups(client string) []string {
+	result := make([]string, 0, len(c[client]))
+	for group := range c[client] {
+		result = append(result, group)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// returns the description of all schedules of the group of the client
+func (c clientSchedules) describe(client, group string) string {
+	descriptions := make([]string, len(c[client][group]))
+	for i, s := range c[client][group] {
+		descriptions[i] = s.String()
+	}
+
+	return strings.Join(descriptions, "; ")
+}
@@ -0,0 +1,144 @@
+package resolver
+
+import (
+	"blocky/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_blockingSchedule_isActive(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	tests := []struct {
+		name   string
+		cfg    config.BlockingSchedule
+		time   time.Time
+		active bool
+	}{
+		{
+			name:   "within window",
+			cfg:    config.BlockingSchedule{From: "08:00", To: "12:00"},
+			time:   time.Date(2020, 6, 1, 9, 30, 0, 0, time.UTC),
+			active: true,
+		},
+		{
+			name:   "end of window is exclusive",
+			cfg:    config.BlockingSchedule{From: "08:00", To: "12:00"},
+			time:   time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+			active: false,
+		},
+		{
+			name:   "wrong day",
+			cfg:    config.BlockingSchedule{Days: []string{"tue"}, From: "08:00", To: "12:00"},
+			time:   time.Date(2020, 6, 1, 9, 30, 0, 0, time.UTC),
+			active: false,
+		},
+		{
+			name:   "crossing midnight, before midnight",
+			cfg:    config.BlockingSchedule{Days: []string{"mon"}, From: "20:00", To: "06:00"},
+			time:   time.Date(2020, 6, 1, 23, 0, 0, 0, time.UTC),
+			active: true,
+		},
+		{
+			name:   "crossing midnight, after midnight on next day",
+			cfg:    config.BlockingSchedule{Days: []string{"mon"}, From: "20:00", To: "06:00"},
+			time:   time.Date(2020, 6, 2, 5, 0, 0, 0, time.UTC),
+			active: true,
+		},
+		{
+			name:   "crossing midnight, after midnight of a listed day",
+			cfg:    config.BlockingSchedule{Days: []string{"mon"}, From: "20:00", To: "06:00"},
+			time:   time.Date(2020, 6, 1, 5, 0, 0, 0, time.UTC),
+			active: false,
+		},
+		{
+			name:   "whole day",
+			cfg:    config.BlockingSchedule{Days: []string{"monday"}, From: "00:00", To: "00:00"},
+			time:   time.Date(2020, 6, 1, 17, 0, 0, 0, time.UTC),
+			active: true,
+		},
+		{
+			name:   "without time zone: UTC",
+			cfg:    config.BlockingSchedule{From: "08:00", To: "12:00"},
+			time:   time.Date(2020, 6, 1, 9, 0, 0, 0, berlin),
+			active: false,
+		},
+		{
+			name:   "time zone",
+			cfg:    config.BlockingSchedule{From: "08:00", To: "12:00", Timezone: "Europe/Berlin"},
+			time:   time.Date(2020, 6, 1, 7, 0, 0, 0, time.UTC),
+			active: true,
+		},
+		{
+			name:   "time zone, local time",
+			cfg:    config.BlockingSchedule{From: "08:00", To: "12:00", Timezone: "Europe/Berlin"},
+			time:   time.Date(2020, 6, 1, 7, 0, 0, 0, berlin),
+			active: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newBlockingSchedule(tt.cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.active, s.isActive(tt.time))
+		})
+	}
+}
+
+func Test_blockingSchedule_String(t *testing.T) {
+	s, err := newBlockingSchedule(config.BlockingSchedule{
+		Days: []string{"sun", "tue", "mon"}, From: "20:00", To: "06:30", Timezone: "Europe/Berlin",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Mon,Tue,Sun 20:00-06:30 (Europe/Berlin)", s.String())
+}
+
+func Test_newBlockingSchedule_Error(t *testing.T) {
+	_, err := newBlockingSchedule(config.BlockingSchedule{Days: []string{"xyz"}, From: "20:00", To: "06:00"})
+	assert.Error(t, err)
+
+	_, err = newBlockingSchedule(config.BlockingSchedule{From: "25:00", To: "06:00"})
+	assert.Error(t, err)
+
+	_, err = newBlockingSchedule(config.BlockingSchedule{From: "20:00", To: "06:00", Timezone: "Mars/Base"})
+	assert.Error(t, err)
+
+	_, err = newClientSchedules(map[string]map[string][]config.BlockingSchedule{
+		"kids": {"evening": {{From: "18:00", To: "8pm"}}},
+	})
+	assert.Error(t, err)
+}
+
+func Test_clientSchedules(t *testing.T) {
+	c, err := newClientSchedules(map[string]map[string][]config.BlockingSchedule{
+		"kids": {
+			"evening": {{From: "18:00", To: "22:00"}},
+			"morning": {{From: "06:00", To: "09:00"}, {From: "11:00", To: "12:00"}},
+		},
+		"adults": {"evening": {{From: "20:00", To: "23:00"}}},
+	})
+	assert.NoError(t, err)
+
+	at := func(hour int) time.Time {
+		return time.Date(2020, 6, 1, hour, 0, 0, 0, time.UTC)
+	}
+
+	assert.True(t, c.isActive("kids", "morning", at(7)))
+	assert.True(t, c.isActive("kids", "morning", at(11)))
+	assert.False(t, c.isActive("kids", "morning", at(14)))
+	assert.True(t, c.isActive("kids", "evening", at(19)))
+	assert.False(t, c.isActive("adults", "evening", at(19)))
+
+	// without schedule
+	assert.True(t, c.isActive("kids", "always", at(14)))
+	assert.True(t, c.isActive("unknown", "morning", at(14)))
+
+	assert.Equal(t, []string{"adults", "kids"}, c.clients())
+	assert.Equal(t, []string{"evening", "morning"}, c.groups("kids"))
+	assert.Equal(t, "every day 06:00-09:00 (UTC); every day 11:00-12:00 (UTC)", c.describe("kids", "morning"))
+}
@@ -0,0 +1,211 @@
+package resolver
+
+import (
+	"blocky/api"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// disabledTarget is a group or client with disabled blocking
+type disabledTarget struct {
+	// zero: disabled until enabled again
+	disableEnd  time.Time
+	enableTimer *time.Timer
+}
+
+// disabledTargets contains groups or clients (names, IP addresses, wildcards, CIDR) with disabled blocking.
+// Each target can be enabled again automatically after a certain duration
+type disabledTargets struct {
+	kind    string
+	mu      sync.RWMutex
+	targets map[string]*disabledTarget
+	matcher *clientMatcher
+}
+
+func newDisabledTargets(kind string) *disabledTargets {
+	return &disabledTargets{
+		kind:    kind,
+		targets: make(map[string]*disabledTarget),
+		matcher: newClientMatcher(nil),
+	}
+}
+
+// disable disables blocking for the targets. Duration 0 means until enabled again
+func (d *disabledTargets) disable(names []string, duration time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, name := range names {
+		d.removeLocked(name)
+
+		target := &disabledTarget{}
+
+		if duration == 0 {
+			log.Infof("disable blocking for %s '%s'", d.kind, name)
+		} else {
+			log.Infof("disable blocking for %s '%s' for %s", d.kind, name, duration)
+
+			name := name
+			target.disableEnd = time.Now().Add(duration)
+			target.enableTimer = time.AfterFunc(duration, func() {
+				d.expire(name, target)
+			})
+		}
+
+		d.targets[name] = target
+	}
+
+	d.updateMatcherLocked()
+}
+
+// enable enables blocking for the targets again
+func (d *disabledTargets) enable(names []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, name := range names {
+		if d.removeLocked(name) {
+			log.Infof("enable blocking for %s '%s'", d.kind, name)
+		}
+	}
+
+	d.updateMatcherLocked()
+}
+
+// enableAll enables blocking for all targets
+func (d *disabledTargets) enableAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for name := range d.targets {
+		d.removeLocked(name)
+	}
+
+	d.updateMatcherLocked()
+}
+
+// enables the target after the timer expired, if it was not disabled again in the meantime
+func (d *disabledTargets) expire(name string, target *disabledTarget) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.targets[name] == target {
+		delete(d.targets, name)
+		d.updateMatcherLocked()
+		log.Infof("blocking for %s '%s' enabled again", d.kind, name)
+	}
+}
+
+func (d *disabledTargets) removeLocked(name string) bool {
+	target, found := d.targets[name]
+	if !found {
+		return false
+	}
+
+	if target.enableTimer != nil {
+		target.enableTimer.Stop()
+	}
+
+	delete(d.targets, name)
+
+	return true
+}
+
+func (d *disabledTargets) updateMatcherLocked() {
+	keys := make([]string, 0, len(d.targets))
+	for name := range d.targets {
+		keys = append(keys, name)
+	}
+
+	d.matcher = newClientMatcher(keys)
+}
+
+// isClientDisabled returns true if blocking is disabled for the client (name, wildcard name, IP or CIDR)
+func (d *disabledTargets) isClientDisabled(clientNames []string, clientIP net.IP) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.targets) == 0 {
+		return false
+	}
+
+	return len(d.matcher.match(clientNames, clientIP)) > 0
+}
+
+// returns only targets which are not disabled
+func (d *disabledTargets) filterEnabled(names []string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.targets) == 0 {
+		return names
+	}
+
+	result := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if _, found := d.targets[name]; !found {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+// returns the status of the target
+func (d *disabledTargets) status(name string) api.BlockingTargetStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.statusLocked(name)
+}
+
+func (d *disabledTargets) statusLocked(name string) api.BlockingTargetStatus {
+	result := api.BlockingTargetStatus{Name: name, Enabled: true}
+
+	if target, found := d.targets[name]; found {
+		result.Enabled = false
+
+		if target.disableEnd.After(time.Now()) {
+			result.AutoEnableInSec = uint(time.Until(target.disableEnd).Seconds())
+		}
+	}
+
+	return result
+}
+
+// returns the status of all disabled targets, sorted by name
+func (d *disabledTargets) disabled() []api.BlockingTargetStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	names := make([]string, 0, len(d.targets))
+	for name := range d.targets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	result := make([]api.BlockingTargetStatus, len(names))
+	for i, name := range names {
+		result[i] = d.statusLocked(name)
+	}
+
+	return result
+}
+
+// stops all timers
+func (d *disabledTargets) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, target := range d.targets {
+		if target.enableTimer != nil {
+			target.enableTimer.Stop()
+		}
+	}
+}
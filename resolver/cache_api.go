@@ -0,0 +1,156 @@
+package resolver
+
+import (
+	"blocky/api"
+	"blocky/util"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// CacheStats returns the item counts of the DNS and client name caches of the resolver chain
+func CacheStats(chain Resolver) api.CacheStats {
+	result := api.CacheStats{ItemCountPerType: make(map[string]int)}
+
+	forEachResolver(chain, func(r Resolver) {
+		switch v := r.(type) {
+		case *CachingResolver:
+			for t, count := range v.itemCountPerType() {
+				result.ItemCountPerType[t] += count
+				result.ItemCount += count
+			}
+
+			result.StaleItemCount += v.staleItemCount()
+		case *ClientNamesResolver:
+			result.ClientNamesItemCount += v.cache.ItemCount()
+		}
+	})
+
+	return result
+}
+
+// LookupCache returns the DNS cache entries of the name (all query types and upstream groups), sorted by type
+func LookupCache(chain Resolver, name string) []api.CacheEntry {
+	result := []api.CacheEntry{}
+
+	forEachResolver(chain, func(r Resolver) {
+		if c, ok := r.(*CachingResolver); ok {
+			result = append(result, c.lookup(util.ExtractDomainOnly(name))...)
+		}
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Type == result[j].Type {
+			return result[i].Group < result[j].Group
+		}
+
+		return result[i].Type < result[j].Type
+	})
+
+	return result
+}
+
+// DeleteFromCache deletes the DNS cache entries of the name. If withSubdomains is true, entries of all
+// subdomains will be deleted too. Returns the count of deleted entries
+func DeleteFromCache(chain Resolver, name string, withSubdomains bool) int {
+	count := 0
+
+	forEachResolver(chain, func(r Resolver) {
+		if c, ok := r.(*CachingResolver); ok {
+			count += c.delete(util.ExtractDomainOnly(name), withSubdomains)
+		}
+	})
+
+	return count
+}
+
+// FlushCaches removes all entries from the DNS cache (if dnsCache is true) and from the client name cache
+// (if clientNames is true)
+func FlushCaches(chain Resolver, dnsCache, clientNames bool) {
+	forEachResolver(chain, func(r Resolver) {
+		switch v := r.(type) {
+		case *CachingResolver:
+			if dnsCache {
+				v.cache.Flush()
+				v.failedKeys.Flush()
+			}
+		case *ClientNamesResolver:
+			if clientNames {
+				v.FlushCache()
+			}
+		}
+	})
+}
+
+// returns the domain of the cache key ("example.com IN A" -> "example.com")
+func cacheKeyDomain(key string) string {
+	if i := strings.Index(key, " "); i >= 0 {
+		return key[:i]
+	}
+
+	return key
+}
+
+// returns the upstream group of the cache key ("example.com IN A kids" -> "kids"), empty for the default group
+func cacheKeyGroup(key string) string {
+	if fields := strings.Fields(key); len(fields) > 3 {
+		return fields[3]
+	}
+
+	return ""
+}
+
+// returns the count of expired entries, which are kept for serve-stale
+func (r *CachingResolver) staleItemCount() (count int) {
+	for _, item := range r.cache.Items() {
+		if e, ok := item.Object.(*cacheEntry); ok && time.Until(e.expires) <= 0 {
+			count++
+		}
+	}
+
+	return
+}
+
+// returns the cache entries of the domain
+func (r *CachingResolver) lookup(domain string) (result []api.CacheEntry) {
+	for key, item := range r.cache.Items() {
+		e, ok := item.Object.(*cacheEntry)
+		if !ok || cacheKeyDomain(key) != domain {
+			continue
+		}
+
+		entry := api.CacheEntry{
+			Name:       domain,
+			Type:       dns.Type(e.qType).String(),
+			Group:      cacheKeyGroup(key),
+			ReturnCode: dns.RcodeToString[e.rcode],
+			Answer:     util.AnswerToString(e.answer),
+			Prefetched: e.prefetched,
+		}
+
+		if remaining := time.Until(e.expires); remaining > 0 {
+			entry.RemainingTTLSec = uint(remaining.Seconds())
+		} else {
+			entry.Stale = true
+		}
+
+		result = append(result, entry)
+	}
+
+	return
+}
+
+// deletes the cache entries of the domain and optionally of its subdomains, returns the count of deleted entries
+func (r *CachingResolver) delete(domain string, withSubdomains bool) (count int) {
+	for key := range r.cache.Items() {
+		d := cacheKeyDomain(key)
+		if d == domain || (withSubdomains && strings.HasSuffix(d, "."+domain)) {
+			r.cache.Delete(key)
+			count++
+		}
+	}
+
+	return
+}
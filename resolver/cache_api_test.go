@@ -0,0 +1,82 @@
+package resolver
+
+import (
+	"blocky/config"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CacheAPI(t *testing.T) {
+	clientNames := NewClientNamesResolver(config.ClientLookupConfig{}).(*ClientNamesResolver)
+	caching := NewCachingResolver(config.CachingConfig{}).(*CachingResolver)
+	chain := Chain(clientNames, caching, &resolverMock{})
+
+	answer, _ := dns.NewRR("example.com. 300 IN A 123.122.121.120")
+	caching.cache.Set("example.com IN A", &cacheEntry{qType: dns.TypeA, ttl: 5 * time.Minute,
+		expires: time.Now().Add(5 * time.Minute), answer: []dns.RR{answer}}, time.Hour)
+	caching.cache.Set("example.com IN AAAA", &cacheEntry{qType: dns.TypeAAAA, ttl: 5 * time.Minute,
+		expires: time.Now().Add(-time.Minute)}, time.Hour)
+	caching.cache.Set("sub.example.com IN A", &cacheEntry{qType: dns.TypeA, rcode: dns.RcodeNameError,
+		expires: time.Now().Add(time.Minute)}, time.Hour)
+	caching.cache.Set("example.com IN A kids", &cacheEntry{qType: dns.TypeA,
+		expires: time.Now().Add(time.Minute)}, time.Hour)
+	caching.cache.Set("notexample.com IN A", &cacheEntry{qType: dns.TypeA,
+		expires: time.Now().Add(time.Minute)}, time.Hour)
+	clientNames.cache.Set(net.ParseIP("192.168.178.25").String(), []string{"client1"}, time.Hour)
+
+	t.Run("stats", func(t *testing.T) {
+		stats := CacheStats(chain)
+		assert.Equal(t, 5, stats.ItemCount)
+		assert.Equal(t, map[string]int{"A": 4, "AAAA": 1}, stats.ItemCountPerType)
+		assert.Equal(t, 1, stats.StaleItemCount)
+		assert.Equal(t, 1, stats.ClientNamesItemCount)
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		entries := LookupCache(chain, "Example.com.")
+		assert.Len(t, entries, 3)
+		assert.Equal(t, "example.com", entries[0].Name)
+		assert.Equal(t, "A", entries[0].Type)
+		assert.Equal(t, "NOERROR", entries[0].ReturnCode)
+		assert.Equal(t, "A (123.122.121.120)", entries[0].Answer)
+		assert.InDelta(t, 300, float64(entries[0].RemainingTTLSec), 1)
+		assert.False(t, entries[0].Stale)
+		assert.Empty(t, entries[0].Group)
+		assert.Equal(t, "A", entries[1].Type)
+		assert.Equal(t, "kids", entries[1].Group)
+		assert.Equal(t, "AAAA", entries[2].Type)
+		assert.True(t, entries[2].Stale)
+		assert.Zero(t, entries[2].RemainingTTLSec)
+
+		entries = LookupCache(chain, "sub.example.com")
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "NXDOMAIN", entries[0].ReturnCode)
+
+		assert.Empty(t, LookupCache(chain, "unknown.com"))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Equal(t, 0, DeleteFromCache(chain, "unknown.com", true))
+		assert.Equal(t, 3, DeleteFromCache(chain, "example.com", false))
+		assert.Equal(t, 2, caching.cache.ItemCount())
+
+		// subdomains only, not "notexample.com"
+		assert.Equal(t, 1, DeleteFromCache(chain, "example.com", true))
+		assert.Equal(t, 1, caching.cache.ItemCount())
+		_, found := caching.cache.Get("notexample.com IN A")
+		assert.True(t, found)
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		FlushCaches(chain, false, true)
+		assert.Equal(t, 1, caching.cache.ItemCount())
+		assert.Equal(t, 0, clientNames.cache.ItemCount())
+
+		FlushCaches(chain, true, true)
+		assert.Equal(t, 0, caching.cache.ItemCount())
+	})
+}
@@ -0,0 +1,277 @@
+package resolver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/patrickmn/go-cache"
+)
+
+// version of the snapshot file format, must be increased on incompatible changes
+const cacheSnapshotVersion = 1
+
+// cacheSnapshot contains the entries of the DNS and client name caches with their expiration time
+type cacheSnapshot struct {
+	Version     int                        `json:"version"`
+	Created     time.Time                  `json:"created"`
+	DNS         []dnsCacheSnapshotEntry    `json:"dns"`
+	ClientNames []clientNamesSnapshotEntry `json:"clientNames"`
+}
+
+// dnsCacheSnapshotEntry is a cached DNS response, records are in zone file notation. Expires is the end of the TTL
+type dnsCacheSnapshotEntry struct {
+	Key     string    `json:"key"`
+	QType   uint16    `json:"qType"`
+	Rcode   int       `json:"rcode"`
+	TTLSec  int64     `json:"ttlSec"`
+	Expires time.Time `json:"expires"`
+	Answer  []string  `json:"answer,omitempty"`
+	Ns      []string  `json:"ns,omitempty"`
+}
+
+// clientNamesSnapshotEntry contains the resolved names of a client IP address
+type clientNamesSnapshotEntry struct {
+	IP      string    `json:"ip"`
+	Names   []string  `json:"names"`
+	Expires time.Time `json:"expires"`
+}
+
+// calls fn for each resolver of the chain
+func forEachResolver(chain Resolver, fn func(Resolver)) {
+	for r := chain; r != nil; {
+		fn(r)
+
+		c, ok := r.(ChainedResolver)
+		if !ok {
+			return
+		}
+
+		r = c.GetNext()
+	}
+}
+
+// SaveCacheSnapshot writes the entries of the DNS and client name caches of the resolver chain to the file.
+// The file will be replaced atomically
+func SaveCacheSnapshot(file string, chain Resolver) (int, error) {
+	snapshot := cacheSnapshot{Version: cacheSnapshotVersion, Created: time.Now()}
+
+	forEachResolver(chain, func(r Resolver) {
+		switch v := r.(type) {
+		case *CachingResolver:
+			snapshot.DNS = append(snapshot.DNS, v.snapshotEntries()...)
+		case *ClientNamesResolver:
+			snapshot.ClientNames = append(snapshot.ClientNames, v.snapshotEntries()...)
+		}
+	})
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return 0, fmt.Errorf("can't create snapshot file: %v", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if err := writeCacheSnapshot(tmp, snapshot); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("can't write snapshot file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return 0, fmt.Errorf("can't write snapshot file: %v", err)
+	}
+
+	return len(snapshot.DNS) + len(snapshot.ClientNames), nil
+}
+
+func writeCacheSnapshot(w io.Writer, snapshot cacheSnapshot) error {
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return fmt.Errorf("can't write snapshot: %v", err)
+	}
+
+	return nil
+}
+
+// RestoreCacheSnapshot restores the not expired entries of the DNS and client name caches from the file.
+// Returns the count of restored entries, a missing file is not an error
+func RestoreCacheSnapshot(file string, chain Resolver) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("can't open snapshot file: %v", err)
+	}
+	defer f.Close()
+
+	snapshot, err := readCacheSnapshot(f)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	forEachResolver(chain, func(r Resolver) {
+		switch v := r.(type) {
+		case *CachingResolver:
+			count += v.restoreEntries(snapshot.DNS)
+		case *ClientNamesResolver:
+			count += v.restoreEntries(snapshot.ClientNames)
+		}
+	})
+
+	return count, nil
+}
+
+func readCacheSnapshot(r io.Reader) (snapshot cacheSnapshot, err error) {
+	if err = json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return snapshot, fmt.Errorf("can't read snapshot: %v", err)
+	}
+
+	if snapshot.Version != cacheSnapshotVersion {
+		return snapshot, fmt.Errorf("unsupported snapshot version %d, expected %d", snapshot.Version,
+			cacheSnapshotVersion)
+	}
+
+	return snapshot, nil
+}
+
+// returns the not expired items of the cache
+func notExpiredItems(c *cache.Cache) map[string]cache.Item {
+	now := time.Now().UnixNano()
+	result := make(map[string]cache.Item)
+
+	for key, item := range c.Items() {
+		if item.Expiration > now {
+			result[key] = item
+		}
+	}
+
+	return result
+}
+
+// returns the snapshot entries of the DNS cache
+func (r *CachingResolver) snapshotEntries() (result []dnsCacheSnapshotEntry) {
+	for key, item := range notExpiredItems(r.cache) {
+		entry, ok := item.Object.(*cacheEntry)
+		if !ok {
+			continue
+		}
+
+		result = append(result, dnsCacheSnapshotEntry{
+			Key:     key,
+			QType:   entry.qType,
+			Rcode:   entry.rcode,
+			TTLSec:  int64(entry.ttl.Seconds()),
+			Expires: entry.expires,
+			Answer:  recordsToStrings(entry.answer),
+			Ns:      recordsToStrings(entry.ns),
+		})
+	}
+
+	return
+}
+
+// restores the not expired entries in the DNS cache, returns the count of restored entries
+func (r *CachingResolver) restoreEntries(entries []dnsCacheSnapshotEntry) (count int) {
+	if r.maxCacheTimeSec < 0 {
+		return 0
+	}
+
+	for _, e := range entries {
+		answer, err := parseRecords(e.Answer)
+		if err != nil {
+			logger("caching_resolver").Warnf("can't restore cache entry '%s': %v", e.Key, err)
+			continue
+		}
+
+		ns, err := parseRecords(e.Ns)
+		if err != nil {
+			logger("caching_resolver").Warnf("can't restore cache entry '%s': %v", e.Key, err)
+			continue
+		}
+
+		// expired entries are restored only within the stale period
+		if r.store(e.Key, &cacheEntry{
+			qType:   e.QType,
+			rcode:   e.Rcode,
+			ttl:     time.Duration(e.TTLSec) * time.Second,
+			expires: e.Expires,
+			answer:  answer,
+			ns:      ns,
+		}) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// returns the snapshot entries of the client name cache
+func (r *ClientNamesResolver) snapshotEntries() (result []clientNamesSnapshotEntry) {
+	for ip, item := range notExpiredItems(r.cache) {
+		if names, ok := item.Object.([]string); ok {
+			result = append(result, clientNamesSnapshotEntry{
+				IP:      ip,
+				Names:   names,
+				Expires: time.Unix(0, item.Expiration),
+			})
+		}
+	}
+
+	return
+}
+
+// restores the not expired entries in the client name cache, returns the count of restored entries
+func (r *ClientNamesResolver) restoreEntries(entries []clientNamesSnapshotEntry) (count int) {
+	for _, e := range entries {
+		if remaining := time.Until(e.Expires); remaining > 0 {
+			r.cache.Set(e.IP, e.Names, remaining)
+			count++
+		}
+	}
+
+	return count
+}
+
+func recordsToStrings(records []dns.RR) []string {
+	if len(records) == 0 {
+		return nil
+	}
+
+	result := make([]string, len(records))
+	for i, rr := range records {
+		result[i] = rr.String()
+	}
+
+	return result
+}
+
+func parseRecords(values []string) ([]dns.RR, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	result := make([]dns.RR, len(values))
+
+	for i, v := range values {
+		rr, err := dns.NewRR(v)
+		if err != nil || rr == nil {
+			return nil, fmt.Errorf("invalid record '%s': %v", v, err)
+		}
+
+		result[i] = rr
+	}
+
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package resolver
+
+import (
+	"blocky/config"
+	"blocky/util"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_CacheSnapshot_SaveRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocky")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "cache.json")
+
+	createChain := func(m *resolverMock) (*ClientNamesResolver, *CachingResolver, Resolver) {
+		clientNames := NewClientNamesResolver(config.ClientLookupConfig{}).(*ClientNamesResolver)
+		caching := NewCachingResolver(config.CachingConfig{}).(*CachingResolver)
+
+		return clientNames, caching, Chain(clientNames, caching, m)
+	}
+
+	mockResp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	m := &resolverMock{}
+	m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil)
+	clientNames, caching, chain := createChain(m)
+
+	_, err = chain.Resolve(&Request{
+		ClientIP: net.ParseIP("192.168.178.25"),
+		Req:      util.NewMsgWithQuestion("example.com.", dns.TypeA),
+		Log:      logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+
+	// expired entry will not be saved
+	caching.cache.Set("expired.com IN A", &cacheEntry{qType: dns.TypeA}, time.Nanosecond)
+
+	time.Sleep(time.Millisecond)
+
+	count, err := SaveCacheSnapshot(file, chain)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// restore in new chain
+	m = &resolverMock{}
+	clientNames, caching, chain = createChain(m)
+
+	count, err = RestoreCacheSnapshot(file, chain)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 1, caching.cache.ItemCount())
+	assert.Equal(t, 1, clientNames.cache.ItemCount())
+
+	request := &Request{
+		ClientIP: net.ParseIP("192.168.178.25"),
+		Req:      util.NewMsgWithQuestion("example.com.", dns.TypeA),
+		Log:      logrus.NewEntry(logrus.New()),
+	}
+	resp, err := chain.Resolve(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "CACHED", resp.Reason)
+	assert.Equal(t, "123.122.121.120", resp.Res.Answer[0].(*dns.A).A.String())
+	assert.InDelta(t, 300, resp.Res.Answer[0].Header().Ttl, 1)
+	assert.Equal(t, []string{"192.168.178.25"}, request.ClientNames)
+	m.AssertNotCalled(t, "Resolve", mock.Anything)
+}
+
+func Test_CacheSnapshot_Restore_Errors(t *testing.T) {
+	chain := NewCachingResolver(config.CachingConfig{})
+
+	// missing file
+	count, err := RestoreCacheSnapshot("/wrong/path/cache.json", chain)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	// unsupported version
+	_, err = readCacheSnapshot(strings.NewReader(`{"version": 99}`))
+	assert.EqualError(t, err, "unsupported snapshot version 99, expected 1")
+
+	// malformed file
+	_, err = readCacheSnapshot(strings.NewReader("malformed"))
+	assert.Error(t, err)
+
+	// invalid record will be skipped, expired entry will be ignored
+	caching := chain.(*CachingResolver)
+	count = caching.restoreEntries([]dnsCacheSnapshotEntry{
+		{Key: "invalid IN A", QType: dns.TypeA, Expires: time.Now().Add(time.Hour), Answer: []string{"wrong"}},
+		{Key: "expired IN A", QType: dns.TypeA, Expires: time.Now().Add(-time.Hour),
+			Answer: []string{"expired. 300 IN A 1.1.1.1"}},
+		{Key: "valid IN A", QType: dns.TypeA, Expires: time.Now().Add(time.Hour),
+			Answer: []string{"valid. 300 IN A 1.1.1.1"}},
+	})
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,169 @@
+package resolver
+
+import (
+	"blocky/config"
+	"blocky/metrics"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultPrefetchExpires   = 2 * time.Hour
+	defaultPrefetchThreshold = 5
+	// entries will be prefetched within the last part (1/prefetchMarginDivisor) of their TTL
+	prefetchMarginDivisor = 10
+)
+
+// prefetching counts the queries per cache key. Popular entries (more queries than the threshold within
+// the time window) will be refreshed asynchronously, if they are queried shortly before they expire
+type prefetching struct {
+	expires   time.Duration
+	threshold int
+	// max count of prefetched entries within the time window, 0: unlimited
+	maxItems int
+	// cacheKey -> count of queries within the time window
+	hits *cache.Cache
+	// cache keys, which were prefetched within the time window
+	prefetchedKeys *cache.Cache
+	// cache keys with running prefetch
+	running sync.Map
+	metrics *prefetchMetrics
+}
+
+// prefetchMetrics contains prometheus counters for prefetching
+type prefetchMetrics struct {
+	prefetches prometheus.Counter
+	hits       prometheus.Counter
+}
+
+func newPrefetching(cfg config.CachingConfig) *prefetching {
+	if !cfg.Prefetching {
+		return nil
+	}
+
+	expires := cfg.PrefetchExpires
+	if expires == 0 {
+		expires = defaultPrefetchExpires
+	}
+
+	threshold := cfg.PrefetchThreshold
+	if threshold == 0 {
+		threshold = defaultPrefetchThreshold
+	}
+
+	return &prefetching{
+		expires:   expires,
+		threshold: threshold,
+		maxItems:  cfg.PrefetchMaxItemsCount,
+		hits:      cache.New(expires, time.Minute),
+		metrics:   newPrefetchMetrics(),
+
+		prefetchedKeys: cache.New(expires, time.Minute),
+	}
+}
+
+// returns the prefetch counters, nil if metrics are disabled
+func newPrefetchMetrics() *prefetchMetrics {
+	if !metrics.IsEnabled() {
+		return nil
+	}
+
+	m := &prefetchMetrics{
+		prefetches: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "blocky_prefetch_count",
+			Help: "Number of prefetched cache entries",
+		}),
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "blocky_prefetch_hit_count",
+			Help: "Number of cache hits of prefetched entries",
+		}),
+	}
+
+	metrics.RegisterMetric(m.prefetches)
+	metrics.RegisterMetric(m.hits)
+
+	return m
+}
+
+func (p *prefetching) configuration() []string {
+	maxItems := "unlimited"
+	if p.maxItems > 0 {
+		maxItems = fmt.Sprint(p.maxItems)
+	}
+
+	return []string{
+		fmt.Sprintf("prefetching: threshold = %d, time window = %s, max items = %s", p.threshold, p.expires, maxItems),
+		fmt.Sprintf("prefetch tracked items count = %d", p.hits.ItemCount()),
+		fmt.Sprintf("prefetched items count = %d", p.prefetchedKeys.ItemCount()),
+	}
+}
+
+// counts the query of the key
+func (p *prefetching) countQuery(key string) {
+	if _, err := p.hits.IncrementInt(key, 1); err == nil {
+		return
+	}
+
+	// time window starts with the first query
+	_ = p.hits.Add(key, 1, cache.DefaultExpiration)
+}
+
+// returns true if the key was queried often enough and the entry expires soon
+func (p *prefetching) shouldPrefetch(key string, ttl, remaining time.Duration) bool {
+	if remaining > ttl/prefetchMarginDivisor {
+		return false
+	}
+
+	count, found := p.hits.Get(key)
+
+	return found && count.(int) > p.threshold
+}
+
+// runs the prefetch function asynchronously, if no prefetch is running for this key and the max count of
+// prefetched entries is not reached. fn returns true, if the entry was prefetched
+func (p *prefetching) prefetch(key string, fn func() bool) {
+	if !p.canPrefetch(key) {
+		return
+	}
+
+	if _, running := p.running.LoadOrStore(key, true); running {
+		return
+	}
+
+	go func() {
+		defer p.running.Delete(key)
+
+		if fn() {
+			p.prefetchedKeys.Set(key, true, cache.DefaultExpiration)
+		}
+	}()
+}
+
+// returns true if the key was already prefetched within the time window or the max count is not reached
+func (p *prefetching) canPrefetch(key string) bool {
+	if p.maxItems <= 0 {
+		return true
+	}
+
+	if _, found := p.prefetchedKeys.Get(key); found {
+		return true
+	}
+
+	return p.prefetchedKeys.ItemCount() < p.maxItems
+}
+
+func (p *prefetching) prefetched() {
+	if p.metrics != nil {
+		p.metrics.prefetches.Inc()
+	}
+}
+
+func (p *prefetching) prefetchHit() {
+	if p.metrics != nil {
+		p.metrics.hits.Inc()
+	}
+}
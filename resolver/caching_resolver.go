@@ -4,36 +4,94 @@ import (
 	"blocky/config"
 	"blocky/util"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/patrickmn/go-cache"
+	"github.com/sirupsen/logrus"
 )
 
-// caches answers from dns queries with their TTL time, to avoid external resolver calls for recurrent queries
+// caches answers from dns queries with their TTL time, to avoid external resolver calls for recurrent queries.
+// Responses of all query types are cached by name, type and class. Negative responses (NXDOMAIN and NODATA)
+// are cached with the TTL of the SOA record (RFC 2308). Optionally, expired entries will be returned, if the next
+// resolver fails (serve-stale, RFC 8767)
 type CachingResolver struct {
 	NextResolver
 	minCacheTimeSec, maxCacheTimeSec int
-	cachesPerType                    map[uint16]*cache.Cache
+	// cacheKey -> *cacheEntry
+	cache *cache.Cache
+	// nil if prefetching is disabled
+	prefetching *prefetching
+	// expired entries are kept for this duration, 0: serve-stale is disabled
+	stalePeriod time.Duration
+	// max wait time for the next resolver, before a stale entry will be returned
+	staleResponseTimeout time.Duration
+	// cache keys, which failed to resolve recently. Their stale entries are returned without resolution
+	failedKeys *cache.Cache
+}
+
+// cacheEntry is a cached response
+type cacheEntry struct {
+	qType uint16
+	rcode int
+	// cache time of the entry
+	ttl time.Duration
+	// end of the TTL, the entry is stale afterwards
+	expires time.Time
+	// true if the entry was stored by prefetching
+	prefetched bool
+	// answer section of positive responses
+	answer []dns.RR
+	// authority section (SOA) of negative responses
+	ns []dns.RR
+}
+
+func (e *cacheEntry) isNegative() bool {
+	return e.rcode != dns.RcodeSuccess || len(e.answer) == 0
 }
 
 const (
+	// TTL of negative responses without SOA record in the authority section
 	cacheTimeNegative = 30 * time.Minute
+	// TTL of stale answers (RFC 8767)
+	staleAnswerTTL = 30
+	// client response timeout for stale answers (RFC 8767)
+	defaultStaleResponseTimeout = 1800 * time.Millisecond
+	// failure recheck time (RFC 8767): after a failed resolution, stale entries are returned without resolution
+	staleFailureRecheckTime = 30 * time.Second
 )
 
 func NewCachingResolver(cfg config.CachingConfig) ChainedResolver {
 	return &CachingResolver{
 		minCacheTimeSec: 60 * cfg.MinCachingTime,
 		maxCacheTimeSec: 60 * cfg.MaxCachingTime,
-		cachesPerType: map[uint16]*cache.Cache{
-			dns.TypeA:    cache.New(15*time.Minute, 5*time.Minute),
-			dns.TypeAAAA: cache.New(15*time.Minute, 5*time.Minute),
-		},
+		cache:           cache.New(15*time.Minute, 5*time.Minute),
+		prefetching:     newPrefetching(cfg),
+
+		stalePeriod:          cfg.ServeStale,
+		staleResponseTimeout: defaultStaleResponseTimeout,
+		failedKeys:           cache.New(staleFailureRecheckTime, time.Minute),
 	}
 }
 
-func (r *CachingResolver) getCache(queryType uint16) *cache.Cache {
-	return r.cachesPerType[queryType]
+// returns the key of the question: name, class and type ("example.com IN A")
+func cacheKey(question dns.Question) string {
+	return fmt.Sprintf("%s %s %s", util.ExtractDomain(question), dns.Class(question.Qclass), dns.Type(question.Qtype))
+}
+
+// returns the cache key of the request. Responses of upstream groups other than "default" are cached separately,
+// since each group can return different answers ("example.com IN A kids")
+func (r *CachingResolver) requestCacheKey(request *Request) string {
+	key := cacheKey(request.Req.Question[0])
+
+	if selector, ok := r.GetNext().(UpstreamGroupSelector); ok {
+		if group := selector.UpstreamGroup(request); group != config.UpstreamDefaultGroup {
+			return key + " " + group
+		}
+	}
+
+	return key
 }
 
 func (r *CachingResolver) Configuration() (result []string) {
@@ -46,79 +104,321 @@ func (r *CachingResolver) Configuration() (result []string) {
 
 	result = append(result, fmt.Sprintf("maxCacheTimeSec = %d", r.maxCacheTimeSec))
 
-	for t, cache := range r.cachesPerType {
-		result = append(result, fmt.Sprintf("%s cache items count = %d", dns.TypeToString[t], cache.ItemCount()))
+	result = append(result, fmt.Sprintf("cache items count = %d", r.cache.ItemCount()))
+
+	counts := r.itemCountPerType()
+
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	for _, t := range types {
+		result = append(result, fmt.Sprintf("%s cache items count = %d", t, counts[t]))
+	}
+
+	if r.prefetching != nil {
+		result = append(result, r.prefetching.configuration()...)
+	}
+
+	if r.stalePeriod > 0 {
+		result = append(result, fmt.Sprintf("serve stale = %s", r.stalePeriod))
 	}
 
 	return
 }
 
+// returns the count of cached items per query type
+func (r *CachingResolver) itemCountPerType() map[string]int {
+	result := make(map[string]int)
+
+	for _, item := range r.cache.Items() {
+		if e, ok := item.Object.(*cacheEntry); ok {
+			result[dns.Type(e.qType).String()]++
+		}
+	}
+
+	return result
+}
+
 func (r *CachingResolver) Resolve(request *Request) (response *Response, err error) {
 	logger := withPrefix(request.Log, "caching_resolver")
 
-	if r.maxCacheTimeSec < 0 {
+	if r.maxCacheTimeSec < 0 || len(request.Req.Question) != 1 {
 		logger.Debug("skip cache")
-		return r.next.Resolve(request)
+		return r.GetNext().Resolve(request)
 	}
 
-	resp := new(dns.Msg)
-	resp.SetReply(request.Req)
-
-	for _, question := range request.Req.Question {
-		domain := util.ExtractDomain(question)
-		logger := logger.WithField("domain", domain)
+	question := request.Req.Question[0]
+	key := r.requestCacheKey(request)
+	logger = logger.WithField("domain", util.ExtractDomain(question))
 
-		// we can cache only A and AAAA queries
-		if question.Qtype == dns.TypeA || question.Qtype == dns.TypeAAAA {
-			val, expiresAt, found := r.getCache(question.Qtype).GetWithExpiration(domain)
+	if r.prefetching != nil {
+		r.prefetching.countQuery(key)
+	}
 
-			if found {
-				logger.Debug("domain is cached")
+	if val, found := r.cache.Get(key); found {
+		entry := val.(*cacheEntry)
 
-				// calculate remaining TTL
-				remainingTTL := uint32(time.Until(expiresAt).Seconds())
+		if remaining := time.Until(entry.expires); remaining > 0 {
+			logger.Debug("domain is cached")
 
-				v, ok := val.([]dns.RR)
-				if ok {
-					// Answer from successful request
-					resp.Answer = v
-					for _, rr := range resp.Answer {
-						rr.Header().Ttl = remainingTTL
-					}
+			r.handlePrefetch(request, key, entry, remaining)
 
-					return &Response{Res: resp, RType: CACHED, Reason: "CACHED"}, nil
-				}
-				// Answer with response code != OK
-				resp.Rcode = val.(int)
+			// calculate remaining TTL
+			resp := entryResponse(request, entry, uint32(remaining.Seconds()))
 
+			if entry.isNegative() {
 				return &Response{Res: resp, RType: CACHED, Reason: "CACHED NEGATIVE"}, nil
 			}
 
-			logger.WithField("next_resolver", Name(r.next)).Debug("not in cache: go to next resolver")
-			response, err = r.next.Resolve(request)
+			return &Response{Res: resp, RType: CACHED, Reason: "CACHED"}, nil
+		}
 
-			if err == nil {
-				r.putInCache(response, domain, question.Qtype)
-			}
-		} else {
-			logger.Debugf("not A/AAAA: go to next %s", r.next)
-			return r.next.Resolve(request)
+		if r.stalePeriod > 0 {
+			return r.resolveStale(logger, request, key, entry)
 		}
 	}
 
+	logger.WithField("next_resolver", Name(r.GetNext())).Debug("not in cache: go to next resolver")
+	response, err = r.GetNext().Resolve(request)
+
+	if err == nil {
+		r.putInCache(response, key, question.Qtype, false)
+	}
+
 	return response, err
 }
 
-func (r *CachingResolver) putInCache(response *Response, domain string, qType uint16) {
-	answer := response.Res.Answer
+// creates the response for the request from the cache entry
+func entryResponse(request *Request, entry *cacheEntry, ttl uint32) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(request.Req)
+
+	resp.Rcode = entry.rcode
+	resp.Answer = copyWithTTL(entry.answer, ttl)
+	resp.Ns = copyWithTTL(entry.ns, ttl)
+
+	return resp
+}
+
+// resolves the request with the next resolver. The expired entry will be returned, if the next resolver fails
+// or doesn't respond within the stale response timeout. The resolution will be finished in the background
+// and updates the cache. After a failure, the expired entry will be returned without resolution until the
+// failure recheck time is over
+func (r *CachingResolver) resolveStale(logger *logrus.Entry, request *Request, key string,
+	entry *cacheEntry) (*Response, error) {
+	if _, failed := r.failedKeys.Get(key); failed {
+		logger.Debug("next resolver failed recently, returning stale entry")
 
-	if response.Res.Rcode == dns.RcodeSuccess {
-		// put value into cache
-		r.getCache(qType).Set(domain, answer, time.Duration(r.adjustTTLs(answer))*time.Second)
-	} else if response.Res.Rcode == dns.RcodeNameError {
-		// put return code if NXDOMAIN
-		r.getCache(qType).Set(domain, response.Res.Rcode, cacheTimeNegative)
+		return staleResponse(request, entry), nil
 	}
+
+	logger.WithField("next_resolver", Name(r.GetNext())).Debug("cache entry is stale: go to next resolver")
+
+	ch := make(chan requestResponse, 1)
+
+	go func() {
+		response, err := r.GetNext().Resolve(request)
+		err = resolveError(response, err)
+
+		if err == nil {
+			r.failedKeys.Delete(key)
+			r.putInCache(response, key, entry.qType, false)
+		} else {
+			r.failedKeys.SetDefault(key, true)
+		}
+
+		ch <- requestResponse{response: response, err: err}
+	}()
+
+	select {
+	case result := <-ch:
+		if result.err == nil {
+			return result.response, nil
+		}
+
+		logger.Debug("next resolver failed, returning stale entry: ", result.err)
+	case <-time.After(r.staleResponseTimeout):
+		r.failedKeys.SetDefault(key, true)
+		logger.Debug("next resolver timed out, returning stale entry")
+	}
+
+	return staleResponse(request, entry), nil
+}
+
+// returns an error if the resolution failed: error of the resolver or return code other than NOERROR and NXDOMAIN
+func resolveError(response *Response, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if rcode := response.Res.Rcode; rcode != dns.RcodeSuccess && rcode != dns.RcodeNameError {
+		return fmt.Errorf("return code %s", dns.RcodeToString[rcode])
+	}
+
+	return nil
+}
+
+// creates the response with the stale entry
+func staleResponse(request *Request, entry *cacheEntry) *Response {
+	resp := entryResponse(request, entry, staleAnswerTTL)
+
+	if entry.isNegative() {
+		return &Response{Res: resp, RType: STALE, Reason: "STALE NEGATIVE"}
+	}
+
+	return &Response{Res: resp, RType: STALE, Reason: "STALE"}
+}
+
+// counts hits of prefetched entries and starts the prefetch of popular entries, which expire soon
+func (r *CachingResolver) handlePrefetch(request *Request, key string, entry *cacheEntry, remaining time.Duration) {
+	if r.prefetching == nil {
+		return
+	}
+
+	if entry.prefetched {
+		r.prefetching.prefetchHit()
+	}
+
+	if r.prefetching.shouldPrefetch(key, entry.ttl, remaining) {
+		question := request.Req.Question[0]
+
+		r.prefetching.prefetch(key, func() bool {
+			return r.prefetch(request, key, question)
+		})
+	}
+}
+
+// resolves the question with the next resolver and updates the cache entry. The client of the request is kept,
+// so the next resolvers (e.g. upstream groups) resolve the question like for the client. Returns true on success
+func (r *CachingResolver) prefetch(request *Request, key string, question dns.Question) bool {
+	logger := logger("caching_resolver").WithField("domain", util.ExtractDomain(question))
+
+	req := new(dns.Msg)
+	req.SetQuestion(question.Name, question.Qtype)
+	req.Question[0].Qclass = question.Qclass
+
+	logger.Debug("prefetching")
+
+	response, err := r.GetNext().Resolve(&Request{
+		ClientIP:    request.ClientIP,
+		ClientNames: request.ClientNames,
+		Req:         req,
+		Log:         logger,
+		RequestTS:   time.Now(),
+	})
+	if err != nil {
+		logger.Warn("prefetching failed: ", err)
+		return false
+	}
+
+	r.putInCache(response, key, question.Qtype, true)
+	r.prefetching.prefetched()
+
+	return true
+}
+
+// returns copies of the records with the TTL
+func copyWithTTL(records []dns.RR, ttl uint32) []dns.RR {
+	if len(records) == 0 {
+		return nil
+	}
+
+	result := make([]dns.RR, len(records))
+
+	for i, rr := range records {
+		result[i] = dns.Copy(rr)
+		result[i].Header().Ttl = ttl
+	}
+
+	return result
+}
+
+func (r *CachingResolver) putInCache(response *Response, key string, qType uint16, prefetched bool) {
+	res := response.Res
+
+	if res.Truncated {
+		return
+	}
+
+	var (
+		entry    *cacheEntry
+		duration time.Duration
+	)
+
+	switch {
+	case res.Rcode == dns.RcodeSuccess && len(res.Answer) > 0:
+		ttl := r.adjustTTLs(res.Answer)
+		entry = &cacheEntry{qType: qType, rcode: res.Rcode, answer: copyWithTTL(res.Answer, ttl)}
+		duration = time.Duration(ttl) * time.Second
+
+	case res.Rcode == dns.RcodeNameError || res.Rcode == dns.RcodeSuccess:
+		// NXDOMAIN or NODATA
+		entry = &cacheEntry{qType: qType, rcode: res.Rcode, ns: copyWithTTL(soaRecords(res.Ns), 0)}
+		duration = r.negativeCacheTime(res.Ns)
+
+	default:
+		return
+	}
+
+	// TTL 0: response must not be cached
+	if duration > 0 {
+		entry.ttl = duration
+		entry.expires = time.Now().Add(duration)
+		entry.prefetched = prefetched
+		r.store(key, entry)
+	}
+}
+
+// stores the entry in the cache. Expired entries are kept for the stale period
+func (r *CachingResolver) store(key string, entry *cacheEntry) bool {
+	duration := time.Until(entry.expires) + r.stalePeriod
+	if duration <= 0 {
+		return false
+	}
+
+	r.cache.Set(key, entry, duration)
+
+	return true
+}
+
+// returns the SOA records of the authority section
+func soaRecords(ns []dns.RR) (result []dns.RR) {
+	for _, rr := range ns {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			result = append(result, rr)
+		}
+	}
+
+	return
+}
+
+// returns the cache time of a negative response: minimum of the SOA TTL and the SOA MINIMUM field (RFC 2308).
+// Capped by maxCacheTime
+func (r *CachingResolver) negativeCacheTime(ns []dns.RR) time.Duration {
+	result := cacheTimeNegative
+
+	for _, rr := range ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+
+			result = time.Duration(ttl) * time.Second
+
+			break
+		}
+	}
+
+	if r.maxCacheTimeSec > 0 && result > time.Duration(r.maxCacheTimeSec)*time.Second {
+		result = time.Duration(r.maxCacheTimeSec) * time.Second
+	}
+
+	return result
 }
 
 func (r *CachingResolver) adjustTTLs(answer []dns.RR) (maxTTL uint32) {
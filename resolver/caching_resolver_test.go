@@ -3,6 +3,8 @@ package resolver
 import (
 	"blocky/config"
 	"blocky/util"
+	"errors"
+	"net"
 	"testing"
 	"time"
 
@@ -236,6 +238,445 @@ func Test_Resolve_MX(t *testing.T) {
 	assert.Equal(t, 1, len(m.Calls))
 }
 
+func Test_Resolve_OtherTypes_Cached(t *testing.T) {
+	sut := NewCachingResolver(config.CachingConfig{})
+	m := &resolverMock{}
+	for qType, answer := range map[uint16]string{
+		dns.TypeMX:  "google.de.\t180\tIN\tMX\t20\talt1.aspmx.l.google.com.",
+		dns.TypeTXT: "google.de.\t300\tIN\tTXT\t\"v=spf1 -all\"",
+	} {
+		qType := qType
+		resp, err := util.NewMsgWithAnswer(answer)
+		assert.NoError(t, err)
+
+		m.On("Resolve", mock.MatchedBy(func(req *Request) bool {
+			return req.Req.Question[0].Qtype == qType
+		})).Return(&Response{Res: resp}, nil)
+	}
+
+	sut.Next(m)
+
+	resolve := func(qType uint16) *Response {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion("google.de.", qType),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+
+		return resp
+	}
+
+	assert.Equal(t, "google.de.\t180\tIN\tMX\t20 alt1.aspmx.l.google.com.", resolve(dns.TypeMX).Res.Answer[0].String())
+	assert.Equal(t, "google.de.\t300\tIN\tTXT\t\"v=spf1 -all\"", resolve(dns.TypeTXT).Res.Answer[0].String())
+	assert.Len(t, m.Calls, 2)
+
+	// cached by name and type
+	resp := resolve(dns.TypeMX)
+	assert.Equal(t, "CACHED", resp.Reason)
+	assert.Equal(t, dns.TypeMX, resp.Res.Answer[0].Header().Rrtype)
+	resp = resolve(dns.TypeTXT)
+	assert.Equal(t, "CACHED", resp.Reason)
+	assert.Equal(t, dns.TypeTXT, resp.Res.Answer[0].Header().Rrtype)
+	assert.Len(t, m.Calls, 2)
+
+	assert.Contains(t, sut.Configuration(), "MX cache items count = 1")
+	assert.Contains(t, sut.Configuration(), "TXT cache items count = 1")
+}
+
+func Test_Resolve_NegativeCache_SOA(t *testing.T) {
+	soa := func(ttl, minTTL uint32) dns.RR {
+		return &dns.SOA{
+			Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+			Ns:     "ns.example.com.",
+			Mbox:   "admin.example.com.",
+			Minttl: minTTL,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		rcode    int
+		ns       []dns.RR
+		cached   bool
+		cacheTTL time.Duration
+	}{
+		{"NXDOMAIN with SOA minimum", dns.RcodeNameError, []dns.RR{soa(3600, 300)}, true, 300 * time.Second},
+		{"NXDOMAIN with SOA TTL", dns.RcodeNameError, []dns.RR{soa(60, 300)}, true, 60 * time.Second},
+		{"NODATA with SOA", dns.RcodeSuccess, []dns.RR{soa(3600, 120)}, true, 120 * time.Second},
+		{"NODATA without SOA", dns.RcodeSuccess, nil, true, cacheTimeNegative},
+		{"SOA with TTL 0", dns.RcodeNameError, []dns.RR{soa(3600, 0)}, false, 0},
+		{"SERVFAIL", dns.RcodeServerFailure, nil, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewCachingResolver(config.CachingConfig{})
+			m := &resolverMock{}
+
+			mockResp := new(dns.Msg)
+			mockResp.Rcode = tt.rcode
+			mockResp.Ns = tt.ns
+
+			m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil)
+			sut.Next(m)
+
+			request := &Request{
+				Req: util.NewMsgWithQuestion("example.com.", dns.TypeAAAA),
+				Log: logrus.NewEntry(logrus.New()),
+			}
+
+			_, err := sut.Resolve(request)
+			assert.NoError(t, err)
+
+			val, found := sut.(*CachingResolver).cache.Get(cacheKey(request.Req.Question[0]))
+			assert.Equal(t, tt.cached, found)
+
+			if !tt.cached {
+				return
+			}
+
+			assert.InDelta(t, tt.cacheTTL.Seconds(), time.Until(val.(*cacheEntry).expires).Seconds(), 1)
+
+			resp, err := sut.Resolve(request)
+			assert.NoError(t, err)
+			assert.Equal(t, "CACHED NEGATIVE", resp.Reason)
+			assert.Equal(t, tt.rcode, resp.Res.Rcode)
+			assert.Len(t, resp.Res.Answer, 0)
+			assert.Len(t, resp.Res.Ns, len(tt.ns))
+			assert.Len(t, m.Calls, 1)
+		})
+	}
+}
+
+func Test_Resolve_Prefetching(t *testing.T) {
+	sut := NewCachingResolver(config.CachingConfig{Prefetching: true, PrefetchThreshold: 2}).(*CachingResolver)
+	m := &resolverMock{}
+	mockResp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil)
+	sut.Next(m)
+
+	resolve := func(domain string) *Response {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion(domain, dns.TypeA),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+
+		return resp
+	}
+
+	entry := func(domain string) *cacheEntry {
+		val, found := sut.cache.Get(cacheKey(dns.Question{Name: domain, Qtype: dns.TypeA, Qclass: dns.ClassINET}))
+		assert.True(t, found)
+
+		return val.(*cacheEntry)
+	}
+
+	// expires soon: remaining time is less than 10% of TTL
+	expireSoon := func(domain string) {
+		key := cacheKey(dns.Question{Name: domain, Qtype: dns.TypeA, Qclass: dns.ClassINET})
+		e := *entry(domain)
+		e.expires = time.Now().Add(10 * time.Second)
+		sut.cache.Set(key, &e, 10*time.Second)
+	}
+
+	// popular entry: 3 queries
+	for i := 0; i < 3; i++ {
+		resolve("example.com.")
+	}
+
+	// not popular: 1 query
+	resolve("other.com.")
+
+	expireSoon("example.com.")
+	expireSoon("other.com.")
+
+	assert.Equal(t, "CACHED", resolve("example.com.").Reason)
+	assert.Equal(t, "CACHED", resolve("other.com.").Reason)
+
+	assert.Eventually(t, func() bool {
+		return entry("example.com.").prefetched
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 300*time.Second, entry("example.com.").ttl)
+	assert.False(t, entry("other.com.").prefetched)
+
+	assert.Contains(t, sut.Configuration(), "prefetching: threshold = 2, time window = 2h0m0s, max items = unlimited")
+}
+
+func Test_Prefetching_MaxItems(t *testing.T) {
+	p := newPrefetching(config.CachingConfig{Prefetching: true, PrefetchMaxItemsCount: 2})
+
+	prefetched := make(chan string, 1)
+	prefetch := func(key string) {
+		p.prefetch(key, func() bool {
+			prefetched <- key
+			return true
+		})
+	}
+
+	prefetch("a")
+	assert.Equal(t, "a", <-prefetched)
+	prefetch("b")
+	assert.Equal(t, "b", <-prefetched)
+
+	assert.Eventually(t, func() bool {
+		return p.prefetchedKeys.ItemCount() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// max count reached: no prefetch of new entries
+	prefetch("c")
+	_, running := p.running.Load("c")
+	assert.False(t, running)
+
+	// already prefetched entries will be prefetched again
+	prefetch("a")
+	assert.Equal(t, "a", <-prefetched)
+
+	// query counting is not limited
+	p.countQuery("a")
+	p.countQuery("b")
+	p.countQuery("c")
+	assert.Equal(t, 3, p.hits.ItemCount())
+
+	assert.Nil(t, newPrefetching(config.CachingConfig{}))
+}
+
+func Test_Resolve_Prefetching_UpstreamGroup(t *testing.T) {
+	upstream := func(answer string) config.Upstream {
+		return TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+			response, err := util.NewMsgWithAnswer("example.com. 300 IN A " + answer)
+
+			assert.NoError(t, err)
+			return response
+		})
+	}
+
+	sut := NewCachingResolver(config.CachingConfig{Prefetching: true, PrefetchThreshold: 2}).(*CachingResolver)
+	sut.Next(NewUpstreamGroupsResolver(config.UpstreamConfig{
+		ExternalResolvers: []config.Upstream{upstream("123.122.121.120")},
+		Groups:            map[string][]config.Upstream{"kids": {upstream("123.122.121.121")}},
+		ClientGroups:      map[string]string{"kid-laptop": "kids"},
+	}))
+
+	resolve := func() {
+		_, err := sut.Resolve(&Request{
+			ClientNames: []string{"kid-laptop"},
+			ClientIP:    net.ParseIP("192.168.178.25"),
+			Req:         util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			Log:         logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		resolve()
+	}
+
+	// expires soon: prefetch on next query
+	key := "example.com IN A kids"
+	val, _ := sut.cache.Get(key)
+	e := *val.(*cacheEntry)
+	e.expires = time.Now().Add(10 * time.Second)
+	sut.cache.Set(key, &e, 10*time.Second)
+
+	resolve()
+
+	// the entry of the client's group is prefetched with the answer of the group's upstream
+	assert.Eventually(t, func() bool {
+		val, _ := sut.cache.Get(key)
+		return val.(*cacheEntry).prefetched
+	}, time.Second, 10*time.Millisecond)
+
+	val, _ = sut.cache.Get(key)
+	assert.Equal(t, "123.122.121.121", val.(*cacheEntry).answer[0].(*dns.A).A.String())
+	assert.Equal(t, 1, sut.cache.ItemCount())
+}
+
+func Test_Resolve_ServeStale(t *testing.T) {
+	mockResp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	newResp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.121")
+	assert.NoError(t, err)
+
+	request := func() *Request {
+		return &Request{
+			Req: util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			Log: logrus.NewEntry(logrus.New()),
+		}
+	}
+
+	// resolves and caches the response, the entry is expired afterwards
+	setup := func(cfg config.CachingConfig, m *resolverMock) *CachingResolver {
+		sut := NewCachingResolver(cfg).(*CachingResolver)
+		sut.staleResponseTimeout = 50 * time.Millisecond
+		sut.Next(m)
+
+		_, err := sut.Resolve(request())
+		assert.NoError(t, err)
+
+		key := cacheKey(request().Req.Question[0])
+		val, found := sut.cache.Get(key)
+		assert.True(t, found)
+
+		e := *val.(*cacheEntry)
+		e.expires = time.Now().Add(-time.Minute)
+
+		// without serve-stale, expired entries are removed
+		if !sut.store(key, &e) {
+			sut.cache.Delete(key)
+		}
+
+		return sut
+	}
+
+	t.Run("next resolver fails", func(t *testing.T) {
+		m := &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil).Once()
+		m.On("Resolve", mock.Anything).Return(nil, errors.New("upstream error"))
+
+		sut := setup(config.CachingConfig{ServeStale: time.Hour}, m)
+
+		resp, err := sut.Resolve(request())
+		assert.NoError(t, err)
+		assert.Equal(t, STALE, resp.RType)
+		assert.Equal(t, "STALE", resp.Reason)
+		assert.Equal(t, "example.com.	30	IN	A	123.122.121.120", resp.Res.Answer[0].String())
+		assert.Contains(t, sut.Configuration(), "serve stale = 1h0m0s")
+
+		// within the failure recheck time, the stale entry is returned without resolution
+		resp, err = sut.Resolve(request())
+		assert.NoError(t, err)
+		assert.Equal(t, "STALE", resp.Reason)
+		m.AssertNumberOfCalls(t, "Resolve", 2)
+
+		// after the failure recheck time, the next resolver is asked again
+		sut.failedKeys.Flush()
+
+		resp, err = sut.Resolve(request())
+		assert.NoError(t, err)
+		assert.Equal(t, "STALE", resp.Reason)
+		m.AssertNumberOfCalls(t, "Resolve", 3)
+	})
+
+	t.Run("next resolver returns SERVFAIL", func(t *testing.T) {
+		servFail := new(dns.Msg)
+		servFail.SetRcode(util.NewMsgWithQuestion("example.com.", dns.TypeA), dns.RcodeServerFailure)
+
+		m := &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil).Once()
+		m.On("Resolve", mock.Anything).Return(&Response{Res: servFail, Reason: "RESOLVED"}, nil)
+
+		sut := setup(config.CachingConfig{ServeStale: time.Hour}, m)
+
+		resp, err := sut.Resolve(request())
+		assert.NoError(t, err)
+		assert.Equal(t, "STALE", resp.Reason)
+		assert.Equal(t, "example.com.	30	IN	A	123.122.121.120", resp.Res.Answer[0].String())
+	})
+
+	t.Run("next resolver timeout", func(t *testing.T) {
+		release := make(chan time.Time)
+
+		m := &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil).Once()
+		m.On("Resolve", mock.Anything).Return(&Response{Res: newResp, Reason: "RESOLVED"}, nil).
+			WaitUntil(release)
+
+		sut := setup(config.CachingConfig{ServeStale: time.Hour}, m)
+
+		resp, err := sut.Resolve(request())
+		assert.NoError(t, err)
+		assert.Equal(t, "STALE", resp.Reason)
+		assert.Equal(t, "example.com.	30	IN	A	123.122.121.120", resp.Res.Answer[0].String())
+
+		// resolution is still running: stale entry without further resolution
+		resp, err = sut.Resolve(request())
+		assert.NoError(t, err)
+		assert.Equal(t, "STALE", resp.Reason)
+
+		// response of the next resolver updates the cache
+		close(release)
+
+		assert.Eventually(t, func() bool {
+			resp, err := sut.Resolve(request())
+			return err == nil && resp.Reason == "CACHED"
+		}, time.Second, 10*time.Millisecond)
+
+		resp, err = sut.Resolve(request())
+		assert.NoError(t, err)
+		assert.Equal(t, "123.122.121.121", resp.Res.Answer[0].(*dns.A).A.String())
+		m.AssertNumberOfCalls(t, "Resolve", 2)
+	})
+
+	t.Run("next resolver succeeds", func(t *testing.T) {
+		m := &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil).Once()
+		m.On("Resolve", mock.Anything).Return(&Response{Res: newResp, Reason: "RESOLVED"}, nil)
+
+		sut := setup(config.CachingConfig{ServeStale: time.Hour}, m)
+
+		resp, err := sut.Resolve(request())
+		assert.NoError(t, err)
+		assert.Equal(t, "RESOLVED", resp.Reason)
+		assert.Equal(t, "example.com.	300	IN	A	123.122.121.121", resp.Res.Answer[0].String())
+	})
+
+	t.Run("serve stale disabled", func(t *testing.T) {
+		m := &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: mockResp}, nil).Once()
+		m.On("Resolve", mock.Anything).Return(nil, errors.New("upstream error"))
+
+		sut := setup(config.CachingConfig{}, m)
+
+		_, err := sut.Resolve(request())
+		assert.Error(t, err)
+	})
+}
+
+func Test_CacheKey(t *testing.T) {
+	assert.Equal(t, "example.com IN A", cacheKey(dns.Question{Name: "Example.com.", Qtype: dns.TypeA,
+		Qclass: dns.ClassINET}))
+	assert.Equal(t, "example.com CH TXT", cacheKey(dns.Question{Name: "example.com.", Qtype: dns.TypeTXT,
+		Qclass: dns.ClassCHAOS}))
+	assert.Equal(t, "example.com IN TYPE65", cacheKey(dns.Question{Name: "example.com.", Qtype: 65,
+		Qclass: dns.ClassINET}))
+}
+
+// resolver mock, which selects the upstream group by the client IP
+type groupSelectorMock struct {
+	resolverMock
+}
+
+func (r *groupSelectorMock) UpstreamGroup(req *Request) string {
+	if req.ClientIP.Equal(net.ParseIP("192.168.178.2")) {
+		return "kids"
+	}
+
+	return config.UpstreamDefaultGroup
+}
+
+func Test_RequestCacheKey(t *testing.T) {
+	request := func(ip string) *Request {
+		return &Request{
+			ClientIP: net.ParseIP(ip),
+			Req:      util.NewMsgWithQuestion("example.com.", dns.TypeA),
+		}
+	}
+
+	sut := NewCachingResolver(config.CachingConfig{}).(*CachingResolver)
+
+	// next resolver without upstream groups
+	sut.Next(&resolverMock{})
+	assert.Equal(t, "example.com IN A", sut.requestCacheKey(request("192.168.178.2")))
+
+	sut.Next(&groupSelectorMock{})
+	assert.Equal(t, "example.com IN A kids", sut.requestCacheKey(request("192.168.178.2")))
+	assert.Equal(t, "example.com IN A", sut.requestCacheKey(request("192.168.178.3")))
+}
+
 func Test_Configuration_CachingResolver(t *testing.T) {
 	sut := NewCachingResolver(config.CachingConfig{})
 	c := sut.Configuration()
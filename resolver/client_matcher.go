@@ -0,0 +1,164 @@
+package resolver
+
+import (
+	"net"
+	"path"
+	"sort"
+	"strings"
+)
+
+const defaultClientKey = "default"
+
+// clientMatcher finds the configuration keys for a client. Keys can be client names, wildcard names ("laptop-*"),
+// IP addresses and CIDR notations ("192.168.178.0/24", "fd00::/8"). Precedence: client name, wildcard name,
+// IP address, CIDR (most specific first), "default"
+type clientMatcher struct {
+	names      map[string]bool
+	wildcards  []string
+	ips        map[string]string
+	cidrs      []*net.IPNet
+	cidrKeys   []string
+	hasDefault bool
+}
+
+func newClientMatcher(keys []string) *clientMatcher {
+	m := &clientMatcher{
+		names: make(map[string]bool),
+		ips:   make(map[string]string),
+	}
+
+	type cidrKey struct {
+		key   string
+		ipNet *net.IPNet
+	}
+
+	var cidrs []cidrKey
+
+	for _, key := range keys {
+		if key == defaultClientKey {
+			m.hasDefault = true
+			continue
+		}
+
+		if ip := net.ParseIP(key); ip != nil {
+			m.ips[ip.String()] = key
+			continue
+		}
+
+		if _, ipNet, err := net.ParseCIDR(key); err == nil {
+			cidrs = append(cidrs, cidrKey{key: key, ipNet: ipNet})
+			continue
+		}
+
+		if isWildcard(key) {
+			m.wildcards = append(m.wildcards, key)
+			continue
+		}
+
+		m.names[key] = true
+	}
+
+	sort.Strings(m.wildcards)
+
+	// most specific network first
+	sort.SliceStable(cidrs, func(i, j int) bool {
+		oi, _ := cidrs[i].ipNet.Mask.Size()
+		oj, _ := cidrs[j].ipNet.Mask.Size()
+
+		return oi > oj
+	})
+
+	for _, c := range cidrs {
+		m.cidrs = append(m.cidrs, c.ipNet)
+		m.cidrKeys = append(m.cidrKeys, c.key)
+	}
+
+	return m
+}
+
+// returns true if the key is a wildcard name like "laptop-*"
+func isWildcard(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// match returns the keys with the highest precedence for the client: all matching client names, all matching
+// wildcard names, the IP address, the most specific CIDR or "default" (if defined)
+func (m *clientMatcher) match(clientNames []string, clientIP net.IP) (keys []string) {
+	for _, name := range clientNames {
+		if m.names[name] {
+			keys = append(keys, name)
+		}
+	}
+
+	if len(keys) > 0 {
+		return keys
+	}
+
+	for _, pattern := range m.wildcards {
+		for _, name := range clientNames {
+			if matched, _ := path.Match(pattern, name); matched {
+				keys = append(keys, pattern)
+				break
+			}
+		}
+	}
+
+	if len(keys) > 0 {
+		return keys
+	}
+
+	if clientIP != nil {
+		if key, found := m.ips[clientIP.String()]; found {
+			return []string{key}
+		}
+
+		for i, ipNet := range m.cidrs {
+			if ipNet.Contains(clientIP) {
+				return []string{m.cidrKeys[i]}
+			}
+		}
+	}
+
+	if m.hasDefault {
+		return []string{defaultClientKey}
+	}
+
+	return nil
+}
+
+// matchAll returns all keys matching the client: client names, wildcard names, the IP address and all CIDRs
+// containing it. "default" (if defined) will be returned only if no other key matches
+func (m *clientMatcher) matchAll(clientNames []string, clientIP net.IP) (keys []string) {
+	for _, name := range clientNames {
+		if m.names[name] {
+			keys = append(keys, name)
+		}
+	}
+
+	for _, pattern := range m.wildcards {
+		for _, name := range clientNames {
+			if matched, _ := path.Match(pattern, name); matched {
+				keys = append(keys, pattern)
+				break
+			}
+		}
+	}
+
+	if clientIP != nil {
+		if key, found := m.ips[clientIP.String()]; found {
+			keys = append(keys, key)
+		}
+
+		for i, ipNet := range m.cidrs {
+			if ipNet.Contains(clientIP) {
+				keys = append(keys, m.cidrKeys[i])
+			}
+		}
+	}
+
+	if len(keys) == 0 && m.hasDefault {
+		return []string{defaultClientKey}
+	}
+
+	return keys
+}
@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClientMatcher_Precedence(t *testing.T) {
+	sut := newClientMatcher([]string{
+		"default",
+		"laptop",
+		"laptop-*",
+		"*.fritz.box",
+		"192.168.178.55",
+		"192.168.178.0/24",
+		"192.168.0.0/16",
+		"fd00::/8",
+		"fd00:1::/32",
+	})
+
+	tests := []struct {
+		name        string
+		clientNames []string
+		clientIP    string
+		expected    []string
+	}{
+		{"client name", []string{"laptop"}, "192.168.178.55", []string{"laptop"}},
+		{"wildcard name", []string{"laptop-kid"}, "192.168.178.55", []string{"laptop-*"}},
+		{"all wildcard names", []string{"laptop-kid.fritz.box", "laptop-kid"}, "", []string{"*.fritz.box", "laptop-*"}},
+		{"exact IP", []string{"unknown"}, "192.168.178.55", []string{"192.168.178.55"}},
+		{"most specific CIDR", []string{"unknown"}, "192.168.178.56", []string{"192.168.178.0/24"}},
+		{"less specific CIDR", []string{"unknown"}, "192.168.1.1", []string{"192.168.0.0/16"}},
+		{"IPv6 CIDR", nil, "fd00:1::1", []string{"fd00:1::/32"}},
+		{"IPv6 less specific CIDR", nil, "fd12::1", []string{"fd00::/8"}},
+		{"default", []string{"unknown"}, "10.0.0.1", []string{"default"}},
+		{"no IP", nil, "", []string{"default"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sut.match(tt.clientNames, net.ParseIP(tt.clientIP)))
+		})
+	}
+}
+
+func Test_ClientMatcher_WithoutDefault(t *testing.T) {
+	sut := newClientMatcher([]string{"laptop"})
+
+	assert.Nil(t, sut.match([]string{"unknown"}, net.ParseIP("192.168.178.55")))
+	assert.Equal(t, []string{"laptop"}, sut.match([]string{"unknown", "laptop"}, nil))
+}
+
+func Test_ClientMatcher_MatchAll(t *testing.T) {
+	sut := newClientMatcher([]string{
+		"default",
+		"laptop",
+		"laptop-*",
+		"192.168.178.55",
+		"192.168.178.0/24",
+		"192.168.0.0/16",
+	})
+
+	tests := []struct {
+		name        string
+		clientNames []string
+		clientIP    string
+		expected    []string
+	}{
+		{"name, wildcard, IP and CIDRs", []string{"laptop", "laptop-kid"}, "192.168.178.55",
+			[]string{"laptop", "laptop-*", "192.168.178.55", "192.168.178.0/24", "192.168.0.0/16"}},
+		{"name and CIDRs", []string{"laptop"}, "192.168.178.56", []string{"laptop", "192.168.178.0/24", "192.168.0.0/16"}},
+		{"CIDR", []string{"unknown"}, "192.168.1.1", []string{"192.168.0.0/16"}},
+		{"default", []string{"unknown"}, "10.0.0.1", []string{"default"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sut.matchAll(tt.clientNames, net.ParseIP(tt.clientIP)))
+		})
+	}
+}
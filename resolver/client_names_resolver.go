@@ -52,7 +52,7 @@ func (r *ClientNamesResolver) Resolve(request *Request) (*Response, error) {
 	request.ClientNames = clientNames
 	request.Log = request.Log.WithField("client_names", strings.Join(clientNames, "; "))
 
-	return r.next.Resolve(request)
+	return r.GetNext().Resolve(request)
 }
 
 // returns names of client
@@ -72,8 +72,16 @@ func (r *ClientNamesResolver) getClientNames(request *Request) []string {
 	return names
 }
 
-// performs reverse DNS lookup
+// performs reverse DNS lookup. Names of custom DNS entries will be used, if the IP address is defined there
 func (r *ClientNamesResolver) resolveClientNames(ip net.IP, logger *logrus.Entry) (result []string) {
+	if names := r.customDNSNames(ip); len(names) > 0 {
+		result = r.selectNames(names)
+
+		logger.WithField("client_names", strings.Join(result, "; ")).Debug("resolved client name(s) from custom DNS")
+
+		return result
+	}
+
 	if r.externalResolver != nil {
 		reverse, err := dns.ReverseAddr(ip.String())
 
@@ -105,17 +113,7 @@ func (r *ClientNamesResolver) resolveClientNames(ip net.IP, logger *logrus.Entry
 			clientNames = []string{ip.String()}
 		}
 
-		// optional: if singleNameOrder is set, use only one name in the defined order
-		if len(r.singleNameOrder) > 0 {
-			for _, i := range r.singleNameOrder {
-				if i > 0 && int(i) <= len(clientNames) {
-					result = []string{clientNames[i-1]}
-					break
-				}
-			}
-		} else {
-			result = clientNames
-		}
+		result = r.selectNames(clientNames)
 
 		logger.WithField("client_names", strings.Join(result, "; ")).Debug("resolved client name(s)")
 	} else {
@@ -125,6 +123,39 @@ func (r *ClientNamesResolver) resolveClientNames(ip net.IP, logger *logrus.Entry
 	return result
 }
 
+// optional: if singleNameOrder is set, use only one name in the defined order
+func (r *ClientNamesResolver) selectNames(clientNames []string) (result []string) {
+	if len(r.singleNameOrder) == 0 {
+		return clientNames
+	}
+
+	for _, i := range r.singleNameOrder {
+		if i > 0 && int(i) <= len(clientNames) {
+			return []string{clientNames[i-1]}
+		}
+	}
+
+	return result
+}
+
+// returns the names of the IP address from the custom DNS resolver in the chain
+func (r *ClientNamesResolver) customDNSNames(ip net.IP) []string {
+	for next := r.GetNext(); next != nil; {
+		if c, ok := next.(*CustomDNSResolver); ok {
+			return c.reverseNames(ip)
+		}
+
+		chained, ok := next.(ChainedResolver)
+		if !ok {
+			return nil
+		}
+
+		next = chained.GetNext()
+	}
+
+	return nil
+}
+
 // reset client name cache
 func (r *ClientNamesResolver) FlushCache() {
 	r.cache.Flush()
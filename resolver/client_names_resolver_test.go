@@ -259,6 +259,32 @@ func TestClientInfoWithoutUpstream(t *testing.T) {
 	assert.Equal(t, "192.168.178.25", request.ClientNames[0])
 }
 
+func TestClientInfoFromCustomDNS(t *testing.T) {
+	sut := NewClientNamesResolver(config.ClientLookupConfig{})
+	customDNS := NewCustomDNSResolver(config.CustomDNSConfig{
+		Mapping: map[string]config.CustomDNSEntry{"nas.lan": {IPs: []net.IP{net.ParseIP("192.168.178.3")}}}})
+	m := &resolverMock{}
+	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+	Chain(sut, customDNS, m)
+
+	request := &Request{ClientIP: net.ParseIP("192.168.178.3"),
+		Req: util.NewMsgWithQuestion("google.de.", dns.TypeA),
+		Log: logrus.NewEntry(logrus.New())}
+	_, err := sut.Resolve(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"nas.lan"}, request.ClientNames)
+
+	// IP address is not defined in custom DNS
+	request = &Request{ClientIP: net.ParseIP("192.168.178.4"),
+		Req: util.NewMsgWithQuestion("google.de.", dns.TypeA),
+		Log: logrus.NewEntry(logrus.New())}
+	_, err = sut.Resolve(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.168.178.4"}, request.ClientNames)
+}
+
 func Test_Configuration_ClientNamesResolver(t *testing.T) {
 	sut := NewClientNamesResolver(config.ClientLookupConfig{
 		Upstream:        config.Upstream{Net: "tcp", Host: "host"},
@@ -4,30 +4,92 @@ import (
 	"blocky/config"
 	"blocky/util"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
-// ConditionalUpstreamResolver delegates DNS question to other DNS resolver dependent on domain name in question
+// ConditionalUpstreamResolver delegates DNS question to other DNS resolver dependent on domain name in question.
+// Each domain can have multiple upstreams, which are used with the configured upstream strategy.
+// CIDR keys (192.168.178.0/24) are used for reverse lookups (in-addr.arpa and ip6.arpa) of the network
 type ConditionalUpstreamResolver struct {
 	NextResolver
 	mapping map[string]Resolver
+	// reverse zones, most specific network first
+	networks    []conditionalNetwork
+	upstreams   map[string]config.UpstreamList
+	strategy    string
+	fallThrough bool
+}
+
+// conditionalNetwork is a reverse zone defined by CIDR
+type conditionalNetwork struct {
+	network  *net.IPNet
+	resolver Resolver
 }
 
 func NewConditionalUpstreamResolver(cfg config.ConditionalUpstreamConfig) ChainedResolver {
-	m := make(map[string]Resolver)
-	for domain, upstream := range cfg.Mapping {
-		m[strings.ToLower(domain)] = NewUpstreamResolver(upstream)
+	m := make(map[string]Resolver, len(cfg.Mapping))
+	upstreams := make(map[string]config.UpstreamList, len(cfg.Mapping))
+
+	var networks []conditionalNetwork
+
+	for domain, u := range cfg.Mapping {
+		r := NewUpstreamStrategyResolver(config.UpstreamConfig{
+			ExternalResolvers: u,
+			Strategy:          cfg.Strategy,
+		})
+
+		if _, network, err := net.ParseCIDR(domain); err == nil {
+			networks = append(networks, conditionalNetwork{network: network, resolver: r})
+			upstreams[network.String()] = u
+
+			continue
+		}
+
+		domain = strings.ToLower(domain)
+		m[domain] = r
+		upstreams[domain] = u
 	}
 
-	return &ConditionalUpstreamResolver{mapping: m}
+	sort.Slice(networks, func(i, j int) bool {
+		iOnes, _ := networks[i].network.Mask.Size()
+		jOnes, _ := networks[j].network.Mask.Size()
+
+		return iOnes > jOnes
+	})
+
+	return &ConditionalUpstreamResolver{
+		mapping:     m,
+		networks:    networks,
+		upstreams:   upstreams,
+		strategy:    cfg.Strategy,
+		fallThrough: cfg.FallThrough,
+	}
 }
 
 func (r *ConditionalUpstreamResolver) Configuration() (result []string) {
-	if len(r.mapping) > 0 {
-		for key, val := range r.mapping {
-			result = append(result, fmt.Sprintf("%s = \"%s\"", key, val))
+	if len(r.upstreams) > 0 {
+		domains := make([]string, 0, len(r.upstreams))
+		for domain := range r.upstreams {
+			domains = append(domains, domain)
+		}
+
+		sort.Strings(domains)
+
+		for _, domain := range domains {
+			result = append(result, fmt.Sprintf("%s = \"%s\"", domain, r.upstreams[domain]))
+		}
+
+		if r.strategy != "" {
+			result = append(result, fmt.Sprintf("strategy = %s", r.strategy))
+		}
+
+		if r.fallThrough {
+			result = append(result, "fall through to next resolver if all upstreams fail")
 		}
 	} else {
 		result = []string{"deactivated"}
@@ -39,27 +101,19 @@ func (r *ConditionalUpstreamResolver) Configuration() (result []string) {
 func (r *ConditionalUpstreamResolver) Resolve(request *Request) (*Response, error) {
 	logger := withPrefix(request.Log, "conditional_resolver")
 
-	if len(r.mapping) > 0 {
+	if len(r.upstreams) > 0 {
 		for _, question := range request.Req.Question {
 			domain := util.ExtractDomain(question)
 
+			if network, upstream := r.networkForReverseName(domain); upstream != nil {
+				return r.resolveConditional(logger, request, upstream, network)
+			}
+
 			// try with domain with and without sub-domains
 			for len(domain) > 0 {
-				r, found := r.mapping[domain]
+				upstream, found := r.mapping[domain]
 				if found {
-					response, err := r.Resolve(request)
-					if err == nil {
-						response.Reason = "CONDITIONAL"
-						response.RType = CONDITIONAL
-					}
-
-					logger.WithFields(logrus.Fields{
-						"answer":   util.AnswerToString(response.Res.Answer),
-						"domain":   domain,
-						"upstream": r,
-					}).Debugf("received response from conditional upstream")
-
-					return response, err
+					return r.resolveConditional(logger, request, upstream, domain)
 				}
 
 				if i := strings.Index(domain, "."); i >= 0 {
@@ -71,7 +125,111 @@ func (r *ConditionalUpstreamResolver) Resolve(request *Request) (*Response, erro
 		}
 	}
 
-	logger.WithField("next_resolver", Name(r.next)).Trace("go to next resolver")
+	logger.WithField("next_resolver", Name(r.GetNext())).Trace("go to next resolver")
+
+	return r.GetNext().Resolve(request)
+}
+
+// delegates the request to the upstream of the domain or network (key)
+func (r *ConditionalUpstreamResolver) resolveConditional(logger *logrus.Entry, request *Request,
+	upstream Resolver, key string) (*Response, error) {
+	response, err := upstream.Resolve(request)
+	if err == nil {
+		response.Reason = "CONDITIONAL"
+		response.RType = CONDITIONAL
+
+		logger.WithFields(logrus.Fields{
+			"answer":   util.AnswerToString(response.Res.Answer),
+			"domain":   key,
+			"upstream": r.upstreams[key],
+		}).Debugf("received response from conditional upstream")
+
+		return response, nil
+	}
+
+	if !r.fallThrough {
+		return nil, err
+	}
+
+	logger.WithField("domain", key).Warn("all conditional upstreams failed, fall through to next resolver: ", err)
+
+	return r.GetNext().Resolve(request)
+}
+
+// returns the most specific network (CIDR key) and its upstream, which contains the reverse name
+// (4.178.168.192.in-addr.arpa or 178.168.192.in-addr.arpa). Returns nil, if the domain is not a reverse name
+// or no network matches
+func (r *ConditionalUpstreamResolver) networkForReverseName(domain string) (string, Resolver) {
+	if len(r.networks) == 0 {
+		return "", nil
+	}
+
+	ip, prefixLen, ok := parseReverseName(domain)
+	if !ok {
+		return "", nil
+	}
+
+	for _, n := range r.networks {
+		if ones, _ := n.network.Mask.Size(); ones <= prefixLen && n.network.Contains(ip) {
+			return n.network.String(), n.resolver
+		}
+	}
+
+	return "", nil
+}
+
+// parses a complete or partial reverse name (in-addr.arpa or ip6.arpa) and returns the IP address
+// (missing parts are zero) and the count of defined bits
+func parseReverseName(domain string) (ip net.IP, prefixLen int, ok bool) {
+	const (
+		ipv4Suffix = ".in-addr.arpa"
+		ipv6Suffix = ".ip6.arpa"
+	)
+
+	switch {
+	case strings.HasSuffix(domain, ipv4Suffix):
+		labels := strings.Split(strings.TrimSuffix(domain, ipv4Suffix), ".")
+		if len(labels) > net.IPv4len {
+			return nil, 0, false
+		}
+
+		ip = make(net.IP, net.IPv4len)
+
+		for i, label := range labels {
+			b, err := strconv.ParseUint(label, 10, 8)
+			if err != nil {
+				return nil, 0, false
+			}
+
+			ip[len(labels)-1-i] = byte(b)
+		}
+
+		return ip, len(labels) * 8, true
+
+	case strings.HasSuffix(domain, ipv6Suffix):
+		labels := strings.Split(strings.TrimSuffix(domain, ipv6Suffix), ".")
+		if len(labels) > 2*net.IPv6len {
+			return nil, 0, false
+		}
+
+		ip = make(net.IP, net.IPv6len)
+
+		for i, label := range labels {
+			nibble, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return nil, 0, false
+			}
+
+			pos := len(labels) - 1 - i
+			if pos%2 == 0 {
+				ip[pos/2] |= byte(nibble) << 4
+			} else {
+				ip[pos/2] |= byte(nibble)
+			}
+		}
+
+		return ip, len(labels) * 4, true
+	}
 
-	return r.next.Resolve(request)
+	return nil, 0, false
 }
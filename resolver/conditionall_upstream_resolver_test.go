@@ -14,17 +14,17 @@ import (
 
 func setup() (sut ChainedResolver, next *resolverMock) {
 	sut = NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{
-		Mapping: map[string]config.Upstream{
-			"fritz.box": TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+		Mapping: map[string]config.UpstreamList{
+			"fritz.box": {TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
 				response, _ = util.NewMsgWithAnswer(fmt.Sprintf("%s 123 IN A 123.124.122.122", request.Question[0].Name))
 
 				return response
-			}),
-			"other.box": TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+			})},
+			"other.box": {TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
 				response, _ = util.NewMsgWithAnswer(fmt.Sprintf("%s 250 IN A 192.192.192.192", request.Question[0].Name))
 
 				return response
-			}),
+			})},
 		},
 	})
 
@@ -104,3 +104,146 @@ func Test_Configuration_ConditionalResolver_Disabled(t *testing.T) {
 	c := sut.Configuration()
 	assert.Equal(t, []string{"deactivated"}, c)
 }
+
+func Test_Resolve_Conditional_MultipleUpstreams_Fallback(t *testing.T) {
+	second := TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+		response, _ = util.NewMsgWithAnswer(fmt.Sprintf("%s 123 IN A 123.124.122.123", request.Question[0].Name))
+
+		return response
+	})
+
+	sut := NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{
+		Mapping:  map[string]config.UpstreamList{"fritz.box": {{Host: "wrong"}, second}},
+		Strategy: "strict",
+	})
+	nextResolver := &resolverMock{}
+	sut.Next(nextResolver)
+
+	resp, err := sut.Resolve(&Request{
+		Req: util.NewMsgWithQuestion("host.fritz.box.", dns.TypeA),
+		Log: logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "CONDITIONAL", resp.Reason)
+	assert.Equal(t, "host.fritz.box.	123	IN	A	123.124.122.123", resp.Res.Answer[0].String())
+	nextResolver.AssertNotCalled(t, "Resolve", mock.Anything)
+	assert.Contains(t, sut.Configuration(), "strategy = strict")
+}
+
+func Test_Resolve_Conditional_AllUpstreamsFail(t *testing.T) {
+	cfg := config.ConditionalUpstreamConfig{
+		Mapping: map[string]config.UpstreamList{"fritz.box": {{Host: "wrong"}, {Host: "wrong2"}}},
+	}
+
+	request := func() *Request {
+		return &Request{
+			Req: util.NewMsgWithQuestion("host.fritz.box.", dns.TypeA),
+			Log: logrus.NewEntry(logrus.New()),
+		}
+	}
+
+	// without fall through: error
+	sut := NewConditionalUpstreamResolver(cfg)
+	nextResolver := &resolverMock{}
+	sut.Next(nextResolver)
+
+	_, err := sut.Resolve(request())
+	assert.Error(t, err)
+	nextResolver.AssertNotCalled(t, "Resolve", mock.Anything)
+
+	// with fall through: next resolver
+	cfg.FallThrough = true
+	sut = NewConditionalUpstreamResolver(cfg)
+	nextResolver = &resolverMock{}
+	nextResolver.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+	sut.Next(nextResolver)
+
+	resp, err := sut.Resolve(request())
+	assert.NoError(t, err)
+	assert.Equal(t, "RESOLVED", resp.Reason)
+	nextResolver.AssertExpectations(t)
+	assert.Contains(t, sut.Configuration(), "fall through to next resolver if all upstreams fail")
+}
+
+func Test_Resolve_Conditional_ReverseCIDR(t *testing.T) {
+	upstream := func(name string) config.Upstream {
+		return TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+			response, _ = util.NewMsgWithAnswer(fmt.Sprintf("%s 123 IN PTR %s.", request.Question[0].Name, name))
+
+			return response
+		})
+	}
+
+	sut := NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{
+		Mapping: map[string]config.UpstreamList{
+			"192.168.178.0/24":   {upstream("router")},
+			"192.168.178.128/25": {upstream("upper")},
+			"fd00:1234::/32":     {upstream("ipv6")},
+		},
+	})
+	nextResolver := &resolverMock{}
+	nextResolver.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+	sut.Next(nextResolver)
+
+	resolve := func(query string) *Response {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion(query, dns.TypePTR),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+
+		return resp
+	}
+
+	ptr := func(resp *Response) string {
+		assert.Equal(t, "CONDITIONAL", resp.Reason)
+		assert.Len(t, resp.Res.Answer, 1)
+
+		return resp.Res.Answer[0].(*dns.PTR).Ptr
+	}
+
+	assert.Equal(t, "router.", ptr(resolve("5.178.168.192.in-addr.arpa.")))
+	// non-octet-aligned prefix, most specific network wins
+	assert.Equal(t, "upper.", ptr(resolve("200.178.168.192.in-addr.arpa.")))
+	// partial reverse name of the network
+	assert.Equal(t, "router.", ptr(resolve("178.168.192.in-addr.arpa.")))
+	assert.Equal(t, "ipv6.",
+		ptr(resolve("1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.4.3.2.1.0.0.d.f.ip6.arpa.")))
+
+	// not in network: next resolver
+	assert.Equal(t, "RESOLVED", resolve("5.179.168.192.in-addr.arpa.").Reason)
+	assert.Equal(t, "RESOLVED", resolve("168.192.in-addr.arpa.").Reason)
+	assert.Equal(t, "RESOLVED", resolve("192.168.178.5.").Reason)
+
+	assert.Len(t, sut.Configuration(), 3)
+}
+
+func Test_ParseReverseName(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		prefixLen int
+		ok        bool
+	}{
+		{"4.178.168.192.in-addr.arpa", "192.168.178.4", 32, true},
+		{"168.192.in-addr.arpa", "192.168.0.0", 16, true},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", "2001:db8::1", 128, true},
+		{"d.f.ip6.arpa", "fd00::", 8, true},
+		{"256.178.168.192.in-addr.arpa", "", 0, false},
+		{"1.2.3.4.5.in-addr.arpa", "", 0, false},
+		{"10.d.f.ip6.arpa", "", 0, false},
+		{"example.com", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, prefixLen, ok := parseReverseName(tt.name)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.prefixLen, prefixLen)
+
+			if tt.ok {
+				assert.Equal(t, tt.ip, ip.String())
+			}
+		})
+	}
+}
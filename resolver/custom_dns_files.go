@@ -0,0 +1,114 @@
+package resolver
+
+import (
+	"blocky/util"
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// reads a file in /etc/hosts format: "IP name [aliases...]", comments start with '#'
+func readHostsFile(file string, entries map[string]*customDNSEntry) (count int, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return parseHosts(f, entries)
+}
+
+func parseHosts(r io.Reader, entries map[string]*customDNSEntry) (count int, err error) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+
+		for _, name := range fields[1:] {
+			entry := entryFor(entries, name)
+			entry.ips = append(entry.ips, ip)
+			count++
+		}
+	}
+
+	return count, scanner.Err()
+}
+
+// reads a RFC 1035 zone file. A and AAAA records will be added as IP addresses, SOA and NS records are ignored
+func readZoneFile(file string, entries map[string]*customDNSEntry) (count int, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return parseZone(f, file, entries)
+}
+
+func parseZone(r io.Reader, file string, entries map[string]*customDNSEntry) (count int, err error) {
+	zp := dns.NewZoneParser(r, zoneOrigin(file), file)
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr.(type) {
+		case *dns.SOA, *dns.NS:
+			continue
+		}
+
+		entry := entryFor(entries, rr.Header().Name)
+
+		switch v := rr.(type) {
+		case *dns.A:
+			entry.ips = append(entry.ips, v.A)
+		case *dns.AAAA:
+			entry.ips = append(entry.ips, v.AAAA)
+		default:
+			entry.records = append(entry.records, rr)
+		}
+
+		count++
+	}
+
+	return count, zp.Err()
+}
+
+// returns the origin for relative names of zone files without $ORIGIN: the file name without ".zone" suffix
+// ("lab.lan.zone" -> "lab.lan."). Empty for other file names, relative names require $ORIGIN then
+func zoneOrigin(file string) string {
+	name := filepath.Base(file)
+	if !strings.HasSuffix(name, ".zone") {
+		return ""
+	}
+
+	return dns.Fqdn(strings.TrimSuffix(name, ".zone"))
+}
+
+// returns the entry for the name, creates a new one if not existing
+func entryFor(entries map[string]*customDNSEntry, name string) *customDNSEntry {
+	name = util.ExtractDomainOnly(name)
+
+	entry, found := entries[name]
+	if !found {
+		entry = &customDNSEntry{}
+		entries[name] = entry
+	}
+
+	return entry
+}
@@ -0,0 +1,85 @@
+package resolver
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseHosts(t *testing.T) {
+	entries := make(map[string]*customDNSEntry)
+
+	count, err := parseHosts(strings.NewReader(`# comment
+127.0.0.1	localhost
+192.168.178.3  printer.lan printer   # with alias
+fd00::3 printer.lan
+wrong line
+192.168.178.300 invalid.lan
+`), entries)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.178.3"), net.ParseIP("fd00::3")}, entries["printer.lan"].ips)
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.178.3")}, entries["printer"].ips)
+	assert.Equal(t, []net.IP{net.ParseIP("127.0.0.1")}, entries["localhost"].ips)
+}
+
+func Test_parseZone(t *testing.T) {
+	entries := make(map[string]*customDNSEntry)
+
+	count, err := parseZone(strings.NewReader(`$ORIGIN lab.lan.
+$TTL 3600
+@       IN SOA ns.lab.lan. admin.lab.lan. 1 7200 3600 1209600 3600
+        IN NS  ns.lab.lan.
+        IN MX  10 mail
+ns      IN A   192.168.10.1
+mail    IN A   192.168.10.2
+        IN AAAA fd00::2
+www     IN CNAME mail
+`), "lab.zone", entries)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+	assert.Equal(t, "lab.lan.	3600	IN	MX	10 mail.lab.lan.", entries["lab.lan"].records[0].String())
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.10.2"), net.ParseIP("fd00::2")}, entries["mail.lab.lan"].ips)
+	assert.Equal(t, "www.lab.lan.	3600	IN	CNAME	mail.lab.lan.", entries["www.lab.lan"].records[0].String())
+
+	_, err = parseZone(strings.NewReader("wrong zone"), "wrong.zone", entries)
+	assert.Error(t, err)
+}
+
+func Test_parseZone_RelativeNames(t *testing.T) {
+	zone := `$TTL 3600
+@       IN SOA ns admin 1 7200 3600 1209600 3600
+        IN NS  ns
+ns      IN A   192.168.10.1
+www     IN CNAME ns
+`
+
+	// origin from the file name
+	entries := make(map[string]*customDNSEntry)
+	count, err := parseZone(strings.NewReader(zone), "/etc/blocky/lab.lan.zone", entries)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.10.1")}, entries["ns.lab.lan"].ips)
+	assert.Equal(t, "www.lab.lan.	3600	IN	CNAME	ns.lab.lan.", entries["www.lab.lan"].records[0].String())
+
+	// no entry for the zone apex with SOA and NS records only
+	assert.NotContains(t, entries, "lab.lan")
+	assert.Len(t, entries, 2)
+
+	// $ORIGIN wins over the file name
+	entries = make(map[string]*customDNSEntry)
+	_, err = parseZone(strings.NewReader("$ORIGIN home.lan.\n"+zone), "lab.lan.zone", entries)
+
+	assert.NoError(t, err)
+	assert.Contains(t, entries, "ns.home.lan")
+
+	// relative names without origin
+	_, err = parseZone(strings.NewReader(zone), "zones.txt", make(map[string]*customDNSEntry))
+	assert.Error(t, err)
+}
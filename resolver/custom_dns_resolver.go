@@ -5,39 +5,216 @@ import (
 	"blocky/util"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
 )
 
-const customDNSTTL = 60 * 60
+const (
+	customDNSTTL = 60 * 60
 
-// CustomDNSResolver resolves passed domain name to ip address defined in domain-IP map
+	defaultCustomDNSRefreshPeriod = time.Hour
+)
+
+// customDNSEntry contains the IP addresses and parsed records of a custom DNS name
+type customDNSEntry struct {
+	ips     []net.IP
+	records []dns.RR
+}
+
+// customDNSMapping contains all custom DNS names (from config and files) and the reverse names of their IP addresses
+type customDNSMapping struct {
+	entries map[string]*customDNSEntry
+	// reverse name (4.178.168.192.in-addr.arpa.) -> names
+	reverse map[string][]string
+	// count of entries per file
+	fileCounts map[string]int
+}
+
+// CustomDNSResolver resolves passed domain name to ip addresses and records defined in domain-records map
+// and in hosts and zone files
 type CustomDNSResolver struct {
 	NextResolver
-	mapping map[string]net.IP
+	cfg config.CustomDNSConfig
+	// contains *customDNSMapping, will be replaced completely on refresh. Readers don't need any lock
+	mapping       atomic.Value
+	refreshMutex  sync.Mutex
+	ttl           uint32
+	refreshPeriod time.Duration
+	stopChan      chan struct{}
 }
 
 func NewCustomDNSResolver(cfg config.CustomDNSConfig) ChainedResolver {
-	m := make(map[string]net.IP)
-	for url, ip := range cfg.Mapping {
-		m[strings.ToLower(url)] = ip
+	ttl := uint32(customDNSTTL)
+	if cfg.TTL > 0 {
+		ttl = uint32(cfg.TTL.Seconds())
+	}
+
+	refreshPeriod := time.Duration(cfg.RefreshPeriod) * time.Minute
+	if cfg.RefreshPeriod == 0 {
+		refreshPeriod = defaultCustomDNSRefreshPeriod
+	}
+
+	r := &CustomDNSResolver{
+		cfg:           cfg,
+		ttl:           ttl,
+		refreshPeriod: refreshPeriod,
+		stopChan:      make(chan struct{}),
+	}
+
+	r.refresh()
+
+	if len(cfg.HostsFiles)+len(cfg.ZoneFiles) > 0 && refreshPeriod > 0 {
+		go r.periodicUpdate()
+	}
+
+	return r
+}
+
+// triggers periodical reload of hosts and zone files
+func (r *CustomDNSResolver) periodicUpdate() {
+	ticker := time.NewTicker(r.refreshPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// Close stops the periodical reload of hosts and zone files
+func (r *CustomDNSResolver) Close() error {
+	close(r.stopChan)
+
+	return nil
+}
+
+// creates the mapping from config and files
+func (r *CustomDNSResolver) refresh() {
+	r.refreshMutex.Lock()
+	defer r.refreshMutex.Unlock()
+
+	logger := logger("custom_dns_resolver")
+
+	m := &customDNSMapping{
+		entries:    make(map[string]*customDNSEntry),
+		reverse:    make(map[string][]string),
+		fileCounts: make(map[string]int),
 	}
 
-	return &CustomDNSResolver{mapping: m}
+	for url, e := range r.cfg.Mapping {
+		entry := entryFor(m.entries, url)
+		entry.ips = append(entry.ips, e.IPs...)
+
+		for _, record := range e.Records {
+			rr, err := dns.NewRR(fmt.Sprintf(". 0 IN %s", record))
+			if err != nil || rr == nil {
+				logger.Errorf("invalid record '%s' for '%s': %v", record, url, err)
+				continue
+			}
+
+			entry.records = append(entry.records, rr)
+		}
+	}
+
+	fileEntries := make(map[string]*customDNSEntry)
+
+	for _, file := range r.cfg.HostsFiles {
+		r.readFile(logger, file, readHostsFile, fileEntries, m)
+	}
+
+	for _, file := range r.cfg.ZoneFiles {
+		r.readFile(logger, file, readZoneFile, fileEntries, m)
+	}
+
+	for name, e := range fileEntries {
+		entry := entryFor(m.entries, name)
+		entry.ips = append(entry.ips, e.ips...)
+		entry.records = append(entry.records, e.records...)
+	}
+
+	// reverse lookup for all IP addresses
+	for name, entry := range m.entries {
+		for _, ip := range entry.ips {
+			reverse, err := dns.ReverseAddr(ip.String())
+			if err != nil {
+				continue
+			}
+
+			// same IP address can be defined more than once for a name
+			if names := m.reverse[reverse]; len(names) == 0 || names[len(names)-1] != name {
+				m.reverse[reverse] = append(names, name)
+			}
+		}
+	}
+
+	for _, names := range m.reverse {
+		sort.Strings(names)
+	}
+
+	r.mapping.Store(m)
+}
+
+func (r *CustomDNSResolver) readFile(logger *logrus.Entry, file string,
+	read func(string, map[string]*customDNSEntry) (int, error),
+	entries map[string]*customDNSEntry, m *customDNSMapping) {
+	count, err := read(file, entries)
+	if err != nil {
+		logger.WithField("file", file).Error("can't read file: ", err)
+	}
+
+	m.fileCounts[file] = count
+
+	logger.WithFields(logrus.Fields{
+		"file":  file,
+		"count": count,
+	}).Debug("custom DNS file import finished")
+}
+
+func (r *CustomDNSResolver) currentMapping() *customDNSMapping {
+	return r.mapping.Load().(*customDNSMapping)
 }
 
 func (r *CustomDNSResolver) Configuration() (result []string) {
-	if len(r.mapping) > 0 {
-		for key, val := range r.mapping {
-			result = append(result, fmt.Sprintf("%s = \"%s\"", key, val))
+	m := r.currentMapping()
+
+	if len(m.entries) == 0 {
+		return []string{"deactivated"}
+	}
+
+	for key, val := range r.cfg.Mapping {
+		result = append(result, fmt.Sprintf("%s = \"%s\"", key, val))
+	}
+
+	if len(m.fileCounts) > 0 {
+		result = append(result, "files:")
+		for _, files := range [][]string{r.cfg.HostsFiles, r.cfg.ZoneFiles} {
+			for _, file := range files {
+				result = append(result, fmt.Sprintf("  %s: %d entries", file, m.fileCounts[file]))
+			}
+		}
+
+		if r.refreshPeriod > 0 {
+			result = append(result, fmt.Sprintf("refresh period: %d minutes", r.refreshPeriod/time.Minute))
+		} else {
+			result = append(result, "refresh: disabled")
 		}
-	} else {
-		result = []string{"deactivated"}
 	}
 
-	return
+	if r.ttl != customDNSTTL {
+		result = append(result, fmt.Sprintf("ttl = %s", time.Duration(r.ttl)*time.Second))
+	}
+
+	return result
 }
 
 func isSupportedType(ip net.IP, question dns.Question) bool {
@@ -45,36 +222,117 @@ func isSupportedType(ip net.IP, question dns.Question) bool {
 		(strings.Contains(ip.String(), ":") && question.Qtype == dns.TypeAAAA)
 }
 
+// returns a copy of the record with the name and TTL of the answer
+func (r *CustomDNSResolver) recordWithName(rr dns.RR, name string) dns.RR {
+	result := dns.Copy(rr)
+	result.Header().Name = name
+	result.Header().Ttl = r.ttl
+
+	return result
+}
+
+// returns the answer records of the entry for the question. A CNAME record will be followed, if the target is
+// also a custom DNS name
+func (r *CustomDNSResolver) answer(m *customDNSMapping, entry *customDNSEntry, question dns.Question,
+	depth int) ([]dns.RR, error) {
+	var result []dns.RR
+
+	for _, ip := range entry.ips {
+		if isSupportedType(ip, question) {
+			rr, err := util.CreateAnswerFromQuestion(question, ip, r.ttl)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, rr)
+		}
+	}
+
+	for _, rr := range entry.records {
+		switch {
+		case rr.Header().Rrtype == question.Qtype:
+			result = append(result, r.recordWithName(rr, question.Name))
+
+		case rr.Header().Rrtype == dns.TypeCNAME:
+			cname := r.recordWithName(rr, question.Name)
+			result = append(result, cname)
+
+			target := cname.(*dns.CNAME).Target
+			if next, found := m.entries[util.ExtractDomainOnly(target)]; found && depth < 10 {
+				targetAnswer, err := r.answer(m, next, dns.Question{Name: target, Qtype: question.Qtype,
+					Qclass: question.Qclass}, depth+1)
+				if err != nil {
+					return nil, err
+				}
+
+				result = append(result, targetAnswer...)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// returns the custom DNS names of the IP address
+func (r *CustomDNSResolver) reverseNames(ip net.IP) []string {
+	reverse, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return nil
+	}
+
+	return r.currentMapping().reverse[reverse]
+}
+
+// returns PTR records for a reverse lookup of a custom DNS IP address
+func (r *CustomDNSResolver) reverseAnswer(m *customDNSMapping, question dns.Question) (result []dns.RR) {
+	for _, name := range m.reverse[strings.ToLower(question.Name)] {
+		result = append(result, &dns.PTR{
+			Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: r.ttl},
+			Ptr: dns.Fqdn(name),
+		})
+	}
+
+	return
+}
+
 func (r *CustomDNSResolver) Resolve(request *Request) (*Response, error) {
 	logger := withPrefix(request.Log, "custom_dns_resolver")
 
-	if len(r.mapping) > 0 {
+	m := r.currentMapping()
+
+	if len(m.entries) > 0 {
 		for _, question := range request.Req.Question {
-			domain := util.ExtractDomain(question)
-			for len(domain) > 0 {
-				ip, found := r.mapping[domain]
-				if found {
+			if question.Qtype == dns.TypePTR {
+				if answer := r.reverseAnswer(m, question); len(answer) > 0 {
 					response := new(dns.Msg)
 					response.SetReply(request.Req)
+					response.Answer = answer
 
-					if isSupportedType(ip, question) {
-						rr, err := util.CreateAnswerFromQuestion(question, ip, customDNSTTL)
-
-						if err == nil {
-							response.Answer = append(response.Answer, rr)
+					logger.WithField("answer", util.AnswerToString(answer)).Debugf("returning custom dns PTR entry")
 
-							logger.WithFields(logrus.Fields{
-								"answer": util.AnswerToString(response.Answer),
-								"domain": domain,
-							}).Debugf("returning custom dns entry")
+					return &Response{Res: response, RType: CUSTOMDNS, Reason: "CUSTOM DNS"}, nil
+				}
+			}
 
-							return &Response{Res: response, RType: CUSTOMDNS, Reason: "CUSTOM DNS"}, nil
-						}
+			domain := util.ExtractDomain(question)
+			for len(domain) > 0 {
+				entry, found := m.entries[domain]
+				if found {
+					response := new(dns.Msg)
+					response.SetReply(request.Req)
 
+					answer, err := r.answer(m, entry, question, 0)
+					if err != nil {
 						return nil, err
 					}
 
-					response.Rcode = dns.RcodeNameError
+					// the name exists: without records of the query type, the answer is empty (NODATA)
+					response.Answer = answer
+
+					logger.WithFields(logrus.Fields{
+						"answer": util.AnswerToString(response.Answer),
+						"domain": domain,
+					}).Debugf("returning custom dns entry")
 
 					return &Response{Res: response, RType: CUSTOMDNS, Reason: "CUSTOM DNS"}, nil
 				}
@@ -88,7 +346,7 @@ func (r *CustomDNSResolver) Resolve(request *Request) (*Response, error) {
 		}
 	}
 
-	logger.WithField("resolver", Name(r.next)).Trace("go to next resolver")
+	logger.WithField("resolver", Name(r.GetNext())).Trace("go to next resolver")
 
-	return r.next.Resolve(request)
+	return r.GetNext().Resolve(request)
 }
@@ -2,9 +2,14 @@ package resolver
 
 import (
 	"blocky/config"
+	"blocky/helpertest"
 	"blocky/util"
+	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
@@ -14,7 +19,7 @@ import (
 
 func Test_Resolve_Custom_Name_Ip4_A(t *testing.T) {
 	sut := NewCustomDNSResolver(config.CustomDNSConfig{
-		Mapping: map[string]net.IP{"custom.domain": net.ParseIP("192.168.143.123")}})
+		Mapping: map[string]config.CustomDNSEntry{"custom.domain": {IPs: []net.IP{net.ParseIP("192.168.143.123")}}}})
 	m := &resolverMock{}
 	sut.Next(m)
 
@@ -32,7 +37,7 @@ func Test_Resolve_Custom_Name_Ip4_A(t *testing.T) {
 
 func Test_Resolve_Custom_Name_Ip4_AAAA(t *testing.T) {
 	sut := NewCustomDNSResolver(config.CustomDNSConfig{
-		Mapping: map[string]net.IP{"custom.domain": net.ParseIP("192.168.143.123")}})
+		Mapping: map[string]config.CustomDNSEntry{"custom.domain": {IPs: []net.IP{net.ParseIP("192.168.143.123")}}}})
 	m := &resolverMock{}
 	sut.Next(m)
 
@@ -43,13 +48,14 @@ func Test_Resolve_Custom_Name_Ip4_AAAA(t *testing.T) {
 
 	resp, err := sut.Resolve(request)
 	assert.NoError(t, err)
-	assert.Equal(t, dns.RcodeNameError, resp.Res.Rcode)
+	assert.Equal(t, dns.RcodeSuccess, resp.Res.Rcode)
+	assert.Empty(t, resp.Res.Answer)
 	m.AssertNotCalled(t, "Resolve", mock.Anything)
 }
 
 func Test_Resolve_Custom_Name_Ip6_AAAA(t *testing.T) {
 	sut := NewCustomDNSResolver(config.CustomDNSConfig{
-		Mapping: map[string]net.IP{"custom.domain": net.ParseIP("2001:0db8:85a3:0000:0000:8a2e:0370:7334")}})
+		Mapping: map[string]config.CustomDNSEntry{"custom.domain": {IPs: []net.IP{net.ParseIP("2001:0db8:85a3:0000:0000:8a2e:0370:7334")}}}})
 	m := &resolverMock{}
 	sut.Next(m)
 
@@ -66,7 +72,7 @@ func Test_Resolve_Custom_Name_Ip6_AAAA(t *testing.T) {
 
 func Test_Resolve_Custom_Name_Subdomain(t *testing.T) {
 	sut := NewCustomDNSResolver(config.CustomDNSConfig{
-		Mapping: map[string]net.IP{"custom.domain": net.ParseIP("192.168.143.123")}})
+		Mapping: map[string]config.CustomDNSEntry{"custom.domain": {IPs: []net.IP{net.ParseIP("192.168.143.123")}}}})
 	m := &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
 	sut.Next(m)
@@ -85,7 +91,7 @@ func Test_Resolve_Custom_Name_Subdomain(t *testing.T) {
 
 func Test_Resolve_Delegate_Next(t *testing.T) {
 	sut := NewCustomDNSResolver(config.CustomDNSConfig{
-		Mapping: map[string]net.IP{"custom.domain": net.ParseIP("192.168.143.123")}})
+		Mapping: map[string]config.CustomDNSEntry{"custom.domain": {IPs: []net.IP{net.ParseIP("192.168.143.123")}}}})
 	m := &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
 	sut.Next(m)
@@ -102,7 +108,7 @@ func Test_Resolve_Delegate_Next(t *testing.T) {
 
 func Test_Configuration_CustomDNSResolver_WithConfig(t *testing.T) {
 	sut := NewCustomDNSResolver(config.CustomDNSConfig{
-		Mapping: map[string]net.IP{"custom.domain": net.ParseIP("192.168.143.123")}})
+		Mapping: map[string]config.CustomDNSEntry{"custom.domain": {IPs: []net.IP{net.ParseIP("192.168.143.123")}}}})
 	c := sut.Configuration()
 	assert.Len(t, c, 1)
 }
@@ -112,3 +118,218 @@ func Test_Configuration_CustomDNSResolver__Disabled(t *testing.T) {
 	c := sut.Configuration()
 	assert.Equal(t, []string{"deactivated"}, c)
 }
+
+//nolint:funlen
+func Test_Resolve_Custom_Records(t *testing.T) {
+	entry := func(values ...string) config.CustomDNSEntry {
+		e, err := config.ParseCustomDNSEntry(values)
+		assert.NoError(t, err)
+
+		return e
+	}
+
+	sut := NewCustomDNSResolver(config.CustomDNSConfig{
+		Mapping: map[string]config.CustomDNSEntry{
+			"multi.lan":   entry("192.168.178.3", "192.168.178.4", "fd00::3"),
+			"printer.lan": entry("CNAME multi.lan"),
+			"mail.lan":    entry("192.168.178.5", "MX 10 mx.mail.lan", "TXT \"v=spf1 -all\""),
+			"_sip._udp":   entry("SRV 0 5 5060 sip.lan"),
+			"ext.lan":     entry("CNAME example.com"),
+		},
+		TTL: 5 * time.Minute,
+	})
+	m := &resolverMock{}
+	sut.Next(m)
+
+	resolve := func(name string, qType uint16) *Response {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion(name, qType),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, CUSTOMDNS, resp.RType)
+
+		return resp
+	}
+
+	answer := func(resp *Response) (result []string) {
+		for _, rr := range resp.Res.Answer {
+			result = append(result, rr.String())
+		}
+
+		return
+	}
+
+	// multiple IPs
+	assert.Equal(t, []string{
+		"multi.lan.	300	IN	A	192.168.178.3",
+		"multi.lan.	300	IN	A	192.168.178.4",
+	}, answer(resolve("multi.lan.", dns.TypeA)))
+	assert.Equal(t, []string{"multi.lan.	300	IN	AAAA	fd00::3"}, answer(resolve("multi.lan.", dns.TypeAAAA)))
+
+	// CNAME with custom target
+	assert.Equal(t, []string{
+		"printer.lan.	300	IN	CNAME	multi.lan.",
+		"multi.lan.	300	IN	AAAA	fd00::3",
+	}, answer(resolve("printer.lan.", dns.TypeAAAA)))
+	assert.Equal(t, []string{"printer.lan.	300	IN	CNAME	multi.lan."}, answer(resolve("printer.lan.", dns.TypeCNAME)))
+
+	// CNAME with external target
+	assert.Equal(t, []string{"ext.lan.	300	IN	CNAME	example.com."}, answer(resolve("ext.lan.", dns.TypeA)))
+
+	// MX and TXT
+	assert.Equal(t, []string{"mail.lan.	300	IN	MX	10 mx.mail.lan."}, answer(resolve("mail.lan.", dns.TypeMX)))
+	assert.Equal(t, []string{"mail.lan.	300	IN	TXT	\"v=spf1 -all\""}, answer(resolve("mail.lan.", dns.TypeTXT)))
+
+	// SRV
+	assert.Equal(t, []string{"_sip._udp.	300	IN	SRV	0 5 5060 sip.lan."}, answer(resolve("_sip._udp.", dns.TypeSRV)))
+
+	// sub domain
+	assert.Equal(t, []string{"www.mail.lan.	300	IN	MX	10 mx.mail.lan."}, answer(resolve("www.mail.lan.", dns.TypeMX)))
+
+	// no record with the query type (NODATA)
+	assert.Equal(t, dns.RcodeSuccess, resolve("mail.lan.", dns.TypeSRV).Res.Rcode)
+	assert.Empty(t, answer(resolve("mail.lan.", dns.TypeSRV)))
+
+	m.AssertNotCalled(t, "Resolve", mock.Anything)
+
+	assert.Contains(t, sut.Configuration(), "ttl = 5m0s")
+}
+
+func Test_Resolve_Custom_NoData(t *testing.T) {
+	entry, err := config.ParseCustomDNSEntry([]string{"MX 10 mx.mail.lan"})
+	assert.NoError(t, err)
+
+	sut := NewCustomDNSResolver(config.CustomDNSConfig{
+		Mapping: map[string]config.CustomDNSEntry{"mail.lan": entry}})
+	m := &resolverMock{}
+	sut.Next(m)
+
+	resp, err := sut.Resolve(&Request{
+		Req: util.NewMsgWithQuestion("mail.lan.", dns.TypeA),
+		Log: logrus.NewEntry(logrus.New()),
+	})
+
+	// name exists, but without A record: NOERROR with empty answer
+	assert.NoError(t, err)
+	assert.Equal(t, CUSTOMDNS, resp.RType)
+	assert.Equal(t, dns.RcodeSuccess, resp.Res.Rcode)
+	assert.Empty(t, resp.Res.Answer)
+	m.AssertNotCalled(t, "Resolve", mock.Anything)
+}
+
+//nolint:funlen
+func Test_Resolve_Custom_Files(t *testing.T) {
+	hosts := helpertest.TempFile("192.168.178.3 printer.lan\nfd00::3 printer.lan\n")
+	defer os.Remove(hosts.Name())
+
+	zone := helpertest.TempFile("$ORIGIN lab.lan.\n$TTL 60\nmail IN A 192.168.10.2\nwww IN CNAME mail\n")
+	defer os.Remove(zone.Name())
+
+	sut := NewCustomDNSResolver(config.CustomDNSConfig{
+		HostsFiles: []string{hosts.Name()},
+		ZoneFiles:  []string{zone.Name(), "/non/existing.zone"},
+	}).(*CustomDNSResolver)
+	defer sut.Close()
+
+	m := &resolverMock{}
+	sut.Next(m)
+
+	resolve := func(name string, qType uint16) []string {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion(name, qType),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, CUSTOMDNS, resp.RType)
+
+		result := make([]string, len(resp.Res.Answer))
+		for i, rr := range resp.Res.Answer {
+			result[i] = rr.String()
+		}
+
+		return result
+	}
+
+	assert.Equal(t, []string{"printer.lan.	3600	IN	A	192.168.178.3"}, resolve("printer.lan.", dns.TypeA))
+	assert.Equal(t, []string{"printer.lan.	3600	IN	AAAA	fd00::3"}, resolve("printer.lan.", dns.TypeAAAA))
+	assert.Equal(t, []string{
+		"www.lab.lan.	3600	IN	CNAME	mail.lab.lan.",
+		"mail.lab.lan.	3600	IN	A	192.168.10.2",
+	}, resolve("www.lab.lan.", dns.TypeA))
+
+	// PTR
+	assert.Equal(t, []string{"3.178.168.192.in-addr.arpa.	3600	IN	PTR	printer.lan."},
+		resolve("3.178.168.192.in-addr.arpa.", dns.TypePTR))
+	assert.Equal(t, []string{"2.10.168.192.in-addr.arpa.	3600	IN	PTR	mail.lab.lan."},
+		resolve("2.10.168.192.in-addr.arpa.", dns.TypePTR))
+	assert.Len(t, resolve("3.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", dns.TypePTR), 1)
+
+	m.AssertNotCalled(t, "Resolve", mock.Anything)
+
+	c := sut.Configuration()
+	assert.Contains(t, c, fmt.Sprintf("  %s: 2 entries", hosts.Name()))
+	assert.Contains(t, c, "  /non/existing.zone: 0 entries")
+
+	// reload changed file
+	assert.NoError(t, ioutil.WriteFile(hosts.Name(), []byte("192.168.178.4 printer.lan\n"), 0600))
+	sut.refresh()
+
+	assert.Equal(t, []string{"printer.lan.	3600	IN	A	192.168.178.4"}, resolve("printer.lan.", dns.TypeA))
+}
+
+func Test_Resolve_Custom_PTR_Unknown(t *testing.T) {
+	hosts := helpertest.TempFile("192.168.178.3 printer.lan\n")
+	defer os.Remove(hosts.Name())
+
+	sut := NewCustomDNSResolver(config.CustomDNSConfig{
+		HostsFiles:    []string{hosts.Name()},
+		RefreshPeriod: -1,
+	})
+
+	m := &resolverMock{}
+	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+	sut.Next(m)
+
+	_, err := sut.Resolve(&Request{
+		Req: util.NewMsgWithQuestion("4.178.168.192.in-addr.arpa.", dns.TypePTR),
+		Log: logrus.NewEntry(logrus.New()),
+	})
+	assert.NoError(t, err)
+	m.AssertExpectations(t)
+	assert.Contains(t, sut.Configuration(), "refresh: disabled")
+}
+
+func Test_Resolve_Custom_PTR_Mapping(t *testing.T) {
+	sut := NewCustomDNSResolver(config.CustomDNSConfig{
+		Mapping: map[string]config.CustomDNSEntry{
+			"nas.lan":    {IPs: []net.IP{net.ParseIP("192.168.178.3"), net.ParseIP("2001:db8::3")}},
+			"backup.lan": {IPs: []net.IP{net.ParseIP("192.168.178.3")}},
+		}})
+	m := &resolverMock{}
+	sut.Next(m)
+
+	resolve := func(query string) (result []string) {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion(query, dns.TypePTR),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, dns.RcodeSuccess, resp.Res.Rcode)
+
+		for _, rr := range resp.Res.Answer {
+			result = append(result, rr.String())
+		}
+
+		return
+	}
+
+	assert.Equal(t, []string{
+		"3.178.168.192.in-addr.arpa.	3600	IN	PTR	backup.lan.",
+		"3.178.168.192.in-addr.arpa.	3600	IN	PTR	nas.lan.",
+	}, resolve("3.178.168.192.in-addr.arpa."))
+	assert.Equal(t, []string{
+		"3.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.	3600	IN	PTR	nas.lan.",
+	}, resolve("3.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."))
+	m.AssertNotCalled(t, "Resolve", mock.Anything)
+}
@@ -0,0 +1,35 @@
+package resolver
+
+import (
+	"blocky/config"
+	"sort"
+)
+
+// FastestResolver delegates the DNS message to the upstream resolver with the lowest average response time.
+// Resolvers which were not used yet will be tried first. The next fastest resolver will be used if it fails
+type FastestResolver struct {
+	resolvers []*upstreamHealth
+}
+
+func NewFastestResolver(cfg config.UpstreamConfig) Resolver {
+	return &FastestResolver{resolvers: createUpstreamHealths(cfg.ExternalResolvers)}
+}
+
+func (r *FastestResolver) Configuration() (result []string) {
+	return upstreamsConfiguration("upstream resolvers (fastest):", r.resolvers)
+}
+
+func (r *FastestResolver) Resolve(request *Request) (*Response, error) {
+	return resolveSequential(request, r.sortByLatency(), "fastest_resolver")
+}
+
+// returns the available resolvers sorted by latency, followed by the excluded ones
+func (r *FastestResolver) sortByLatency() []*upstreamHealth {
+	available, excluded := partitionAvailable(r.resolvers)
+
+	sort.SliceStable(available, func(i, j int) bool {
+		return available[i].latency() < available[j].latency()
+	})
+
+	return append(available, excluded...)
+}
@@ -0,0 +1,63 @@
+package resolver
+
+import (
+	"blocky/config"
+	"blocky/util"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Resolve_Fastest(t *testing.T) {
+	slow := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.122")
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	fast := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.123")
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	sut := NewFastestResolver(config.UpstreamConfig{ExternalResolvers: []config.Upstream{slow, fast}})
+
+	// measure both resolvers
+	sut.(*FastestResolver).resolvers[0].record(50*time.Millisecond, nil)
+	sut.(*FastestResolver).resolvers[1].record(5*time.Millisecond, nil)
+
+	for i := 0; i < 5; i++ {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "example.com.	123	IN	A	123.124.122.123", resp.Res.Answer[0].String())
+	}
+}
+
+func Test_SortByLatency_Fastest(t *testing.T) {
+	sut := NewFastestResolver(config.UpstreamConfig{
+		ExternalResolvers: []config.Upstream{
+			{Host: "host1"},
+			{Host: "host2"},
+			{Host: "host3"},
+			{Host: "host4"}}}).(*FastestResolver)
+
+	sut.resolvers[0].avgLatencyMs = 5
+	sut.resolvers[0].disabledUntil = time.Now().Add(time.Minute)
+	sut.resolvers[1].avgLatencyMs = 50
+	sut.resolvers[2].avgLatencyMs = 20
+
+	// not measured resolver first, excluded resolver last
+	assert.Equal(t, []*upstreamHealth{sut.resolvers[3], sut.resolvers[2], sut.resolvers[1], sut.resolvers[0]},
+		sut.sortByLatency())
+}
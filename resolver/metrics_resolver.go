@@ -23,7 +23,7 @@ type MetricsResolver struct {
 
 // Resolve resolves the passed request
 func (m *MetricsResolver) Resolve(request *Request) (*Response, error) {
-	response, err := m.next.Resolve(request)
+	response, err := m.GetNext().Resolve(request)
 
 	if m.cfg.Enable {
 		m.totalQueries.With(prometheus.Labels{
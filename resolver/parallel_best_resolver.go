@@ -4,14 +4,14 @@ import (
 	"blocky/config"
 	"blocky/util"
 	"fmt"
-	"math/rand"
 
 	"github.com/sirupsen/logrus"
 )
 
-// ParallelBestResolver delegates the DNS message to 2 upstream resolvers and returns the fastest answer
+// ParallelBestResolver delegates the DNS message to 2 upstream resolvers and returns the fastest answer.
+// Upstreams are picked weighted by their latency and error rate, failing upstreams will be excluded temporarily
 type ParallelBestResolver struct {
-	resolvers []Resolver
+	resolvers []*upstreamHealth
 }
 
 type requestResponse struct {
@@ -20,22 +20,11 @@ type requestResponse struct {
 }
 
 func NewParallelBestResolver(cfg config.UpstreamConfig) Resolver {
-	resolvers := make([]Resolver, len(cfg.ExternalResolvers))
-
-	for i, u := range cfg.ExternalResolvers {
-		resolvers[i] = NewUpstreamResolver(u)
-	}
-
-	return &ParallelBestResolver{resolvers: resolvers}
+	return &ParallelBestResolver{resolvers: createUpstreamHealths(cfg.ExternalResolvers)}
 }
 
 func (r *ParallelBestResolver) Configuration() (result []string) {
-	result = append(result, "upstream resolvers:")
-	for _, res := range r.resolvers {
-		result = append(result, fmt.Sprintf("- %s", res))
-	}
-
-	return
+	return upstreamsConfiguration("upstream resolvers:", r.resolvers)
 }
 
 func (r *ParallelBestResolver) Resolve(request *Request) (*Response, error) {
@@ -81,11 +70,11 @@ func (r *ParallelBestResolver) Resolve(request *Request) (*Response, error) {
 	return nil, fmt.Errorf("resolution was not successful, errors: %v", collectedErrors)
 }
 
-// pick 2 different random resolvers from the resolver pool
+// pick 2 different random resolvers from the resolver pool, weighted by their health
 func (r *ParallelBestResolver) pickRandom() (resolver1, resolver2 Resolver) {
-	randomInd := rand.Perm(len(r.resolvers))
+	picked := pickWeighted(r.resolvers, 2)
 
-	return r.resolvers[randomInd[0]], r.resolvers[randomInd[1]]
+	return picked[0], picked[1]
 }
 
 func resolve(req *Request, resolver Resolver, ch chan<- requestResponse) {
@@ -120,3 +120,35 @@ func Test_PickRandom(t *testing.T) {
 
 	assert.NotEqual(t, r1, r2)
 }
+
+func Test_Resolve_Excludes_Failing_Upstream(t *testing.T) {
+	withError := config.Upstream{Host: "wrong"}
+
+	upstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.122")
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	sut := NewParallelBestResolver(config.UpstreamConfig{ExternalResolvers: []config.Upstream{withError, upstream}})
+
+	for i := 0; i < failuresBeforeBackoff; i++ {
+		_, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+	}
+
+	// wait for the failing resolver, its result can come after the response
+	time.Sleep(50 * time.Millisecond)
+
+	resolvers := sut.(*ParallelBestResolver).resolvers
+	assert.False(t, resolvers[0].available())
+	assert.True(t, resolvers[1].available())
+
+	c := sut.Configuration()
+	assert.Contains(t, c[1], "excluded for")
+	assert.Contains(t, c[2], "available")
+}
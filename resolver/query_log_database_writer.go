@@ -0,0 +1,237 @@
+package resolver
+
+import (
+	"blocky/api"
+	"blocky/util"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// database driver for the query log, SQLite driver is included with build tag "sqlite"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/miekg/dns"
+)
+
+const queryLogColumns = "request_ts, client_ip, client_name, duration_ms, reason, response_type, " +
+	"question_type, question_name, answer, response_code"
+
+// nolint:gochecknoglobals
+var (
+	queryLogDrivers = map[string]string{
+		queryLogTypeSqlite: "sqlite3",
+		queryLogTypeMysql:  "mysql",
+	}
+
+	// escape character for LIKE patterns (a single backslash), MySQL needs an escaped backslash in string literals
+	queryLogLikeEscape = map[string]string{
+		queryLogTypeSqlite: `'\'`,
+		queryLogTypeMysql:  `'\\'`,
+	}
+
+	// escapes the wildcards of LIKE patterns
+	likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+	queryLogTableStatements = map[string][]string{
+		queryLogTypeSqlite: {
+			`CREATE TABLE IF NOT EXISTS log_entries (
+				request_ts DATETIME NOT NULL,
+				client_ip VARCHAR(50) NOT NULL,
+				client_name VARCHAR(255) NOT NULL,
+				duration_ms INTEGER NOT NULL,
+				reason VARCHAR(255) NOT NULL,
+				response_type VARCHAR(20) NOT NULL,
+				question_type VARCHAR(20) NOT NULL,
+				question_name VARCHAR(255) NOT NULL,
+				answer TEXT NOT NULL,
+				response_code VARCHAR(20) NOT NULL)`,
+			`CREATE INDEX IF NOT EXISTS idx_log_entries_request_ts ON log_entries (request_ts)`,
+		},
+		queryLogTypeMysql: {
+			`CREATE TABLE IF NOT EXISTS log_entries (
+				request_ts DATETIME NOT NULL,
+				client_ip VARCHAR(50) NOT NULL,
+				client_name VARCHAR(255) NOT NULL,
+				duration_ms INTEGER NOT NULL,
+				reason VARCHAR(255) NOT NULL,
+				response_type VARCHAR(20) NOT NULL,
+				question_type VARCHAR(20) NOT NULL,
+				question_name VARCHAR(255) NOT NULL,
+				answer TEXT NOT NULL,
+				response_code VARCHAR(20) NOT NULL,
+				INDEX idx_log_entries_request_ts (request_ts))`,
+		},
+	}
+)
+
+// databaseWriter inserts entries in the table "log_entries" of a SQLite or MySQL database
+type databaseWriter struct {
+	db               *sql.DB
+	logType          string
+	logRetentionDays uint64
+}
+
+// creates a new writer for the database type (sqlite or mysql). Target is the database file (sqlite)
+// or the data source name (mysql). The table will be created if it does not exist
+func newDatabaseWriter(logType string, target string, logRetentionDays uint64) (*databaseWriter, error) {
+	if logType == queryLogTypeSqlite && !sqliteSupported {
+		return nil, errors.New("sqlite is not supported by this binary, please build blocky with CGO_ENABLED=1 " +
+			"and '-tags sqlite'")
+	}
+
+	db, err := sql.Open(queryLogDrivers[logType], target)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range queryLogTableStatements[logType] {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+
+			return nil, fmt.Errorf("can't create table: %v", err)
+		}
+	}
+
+	return &databaseWriter{
+		db:               db,
+		logType:          logType,
+		logRetentionDays: logRetentionDays,
+	}, nil
+}
+
+// inserts all entries with one statement
+func (w *databaseWriter) Write(entries []*queryLogEntry) {
+	placeholders := make([]string, len(entries))
+	args := make([]interface{}, 0, len(entries)*10)
+
+	for i, logEntry := range entries {
+		placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+		var questionType, questionName string
+
+		if q := logEntry.request.Req.Question; len(q) > 0 {
+			questionType = dns.TypeToString[q[0].Qtype]
+			questionName = util.ExtractDomain(q[0])
+		}
+
+		args = append(args,
+			logEntry.start.UTC(),
+			logEntry.request.ClientIP.String(),
+			strings.Join(logEntry.request.ClientNames, "; "),
+			logEntry.durationMs,
+			logEntry.response.Reason,
+			logEntry.response.RType.String(),
+			questionType,
+			questionName,
+			util.AnswerToString(logEntry.response.Res.Answer),
+			dns.RcodeToString[logEntry.response.Res.Rcode])
+	}
+
+	query := fmt.Sprintf("INSERT INTO log_entries (%s) VALUES %s", queryLogColumns, strings.Join(placeholders, ", "))
+
+	if _, err := w.db.Exec(query, args...); err != nil {
+		logger(queryLoggingResolverPrefix).Error("can't insert query log entries: ", err)
+	}
+}
+
+// deletes entries which are older than the retention time
+func (w *databaseWriter) CleanUp() {
+	if w.logRetentionDays == 0 {
+		return
+	}
+
+	logger := logger(queryLoggingResolverPrefix)
+
+	deadline := time.Now().UTC().AddDate(0, 0, -int(w.logRetentionDays))
+
+	res, err := w.db.Exec("DELETE FROM log_entries WHERE request_ts < ?", deadline)
+	if err != nil {
+		logger.Error("can't delete old query log entries: ", err)
+		return
+	}
+
+	if count, err := res.RowsAffected(); err == nil && count > 0 {
+		logger.Infof("%d query log entries are older than retention time and were deleted", count)
+	}
+}
+
+// selects matching entries, newest first
+func (w *databaseWriter) Read(filter queryLogFilter) ([]api.QueryLogEntry, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	escape := queryLogLikeEscape[w.logType]
+
+	if filter.client != "" {
+		conditions = append(conditions, "(client_ip = ? OR LOWER(client_name) LIKE ? ESCAPE "+escape+")")
+		args = append(args, filter.client, containsPattern(strings.ToLower(filter.client)))
+	}
+
+	if filter.domain != "" {
+		conditions = append(conditions, "question_name LIKE ? ESCAPE "+escape)
+		args = append(args, containsPattern(filter.domain))
+	}
+
+	if filter.responseType != "" {
+		conditions = append(conditions, "response_type = ?")
+		args = append(args, filter.responseType)
+	}
+
+	if !filter.from.IsZero() {
+		conditions = append(conditions, "request_ts >= ?")
+		args = append(args, filter.from.UTC())
+	}
+
+	if !filter.to.IsZero() {
+		conditions = append(conditions, "request_ts <= ?")
+		args = append(args, filter.to.UTC())
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM log_entries", queryLogColumns)
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY request_ts DESC LIMIT ? OFFSET ?"
+
+	args = append(args, filter.limit, filter.offset)
+
+	rows, err := w.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("can't select query log entries: %v", err)
+	}
+
+	defer rows.Close()
+
+	var result []api.QueryLogEntry
+
+	for rows.Next() {
+		var e api.QueryLogEntry
+
+		err := rows.Scan(&e.Time, &e.ClientIP, &e.ClientName, &e.DurationMs, &e.Reason, &e.ResponseType,
+			&e.QuestionType, &e.QuestionName, &e.Answer, &e.ReturnCode)
+		if err != nil {
+			return nil, fmt.Errorf("can't read query log entry: %v", err)
+		}
+
+		e.Time = e.Time.Local()
+
+		result = append(result, e)
+	}
+
+	return result, rows.Err()
+}
+
+// returns the LIKE pattern for values containing the search string, wildcards in the search string are escaped
+func containsPattern(search string) string {
+	return "%" + likeEscaper.Replace(search) + "%"
+}
+
+// Close closes the database connection
+func (w *databaseWriter) Close() error {
+	return w.db.Close()
+}
@@ -0,0 +1,242 @@
+//go:build sqlite
+// +build sqlite
+
+package resolver
+
+import (
+	"blocky/config"
+	"blocky/util"
+	"database/sql"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_Resolve_WithLoggingSqlite(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "queryLoggingResolver")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	dbFile := filepath.Join(tmpDir, "querylog.db")
+
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{
+		Type:   "sqlite",
+		Target: dbFile,
+	})
+	assert.NoError(t, err)
+
+	defer sut.(*QueryLoggingResolver).Close()
+
+	m := &resolverMock{}
+	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	m.On("Resolve", mock.Anything).Return(&Response{Res: resp, Reason: "reason", RType: CACHED}, nil)
+	sut.Next(m)
+
+	for _, client := range []string{"client1", "client2"} {
+		_, err = sut.Resolve(&Request{
+			ClientIP:    net.ParseIP("192.168.178.25"),
+			ClientNames: []string{client},
+			Req:         util.NewMsgWithQuestion("google.de.", dns.TypeA),
+			Log:         logrus.NewEntry(logrus.New())})
+		assert.NoError(t, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	m.AssertExpectations(t)
+
+	db, err := sql.Open("sqlite3", dbFile)
+	assert.NoError(t, err)
+
+	defer db.Close()
+
+	rows, err := db.Query("SELECT client_ip, client_name, reason, response_type, question_type, question_name, answer, " +
+		"response_code FROM log_entries ORDER BY client_name")
+	assert.NoError(t, err)
+
+	defer rows.Close()
+
+	var result [][]string
+
+	for rows.Next() {
+		row := make([]string, 8)
+		err = rows.Scan(&row[0], &row[1], &row[2], &row[3], &row[4], &row[5], &row[6], &row[7])
+		assert.NoError(t, err)
+
+		result = append(result, row)
+	}
+
+	assert.Equal(t, [][]string{
+		{"192.168.178.25", "client1", "reason", "CACHED", "A", "google.de", "A (123.122.121.120)", "NOERROR"},
+		{"192.168.178.25", "client2", "reason", "CACHED", "A", "google.de", "A (123.122.121.120)", "NOERROR"},
+	}, result)
+}
+
+func Test_DatabaseWriter_CleanUp(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "queryLoggingResolver")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	sut, err := newDatabaseWriter("sqlite", filepath.Join(tmpDir, "querylog.db"), 7)
+	assert.NoError(t, err)
+
+	defer sut.Close()
+
+	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	// 2 entries, 6 and 8 days old
+	var entries []*queryLogEntry
+	for _, days := range []int{-6, -8} {
+		entries = append(entries, &queryLogEntry{
+			request: &Request{
+				ClientIP:    net.ParseIP("192.168.178.25"),
+				ClientNames: []string{"client1"},
+				Req:         util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			},
+			response: &Response{Res: resp, Reason: "reason"},
+			start:    time.Now().AddDate(0, 0, days),
+		})
+	}
+
+	sut.Write(entries)
+
+	var count int
+
+	err = sut.db.QueryRow("SELECT COUNT(*) FROM log_entries").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	sut.CleanUp()
+
+	// entry older than 7 days was deleted
+	err = sut.db.QueryRow("SELECT COUNT(*) FROM log_entries").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func Test_NewDatabaseWriter_WrongTarget(t *testing.T) {
+	_, err := newDatabaseWriter("sqlite", "/notExists/querylog.db", 0)
+	assert.Error(t, err)
+}
+
+func Test_Configuration_QueryLoggingResolver_Database(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "queryLoggingResolver")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{
+		Type:             "sqlite",
+		Target:           filepath.Join(tmpDir, "querylog.db"),
+		LogRetentionDays: 7,
+	})
+	assert.NoError(t, err)
+
+	defer sut.(*QueryLoggingResolver).Close()
+
+	assert.Equal(t, []string{"type = \"sqlite\"", "logRetentionDays= 7"}, sut.Configuration())
+}
+
+func Test_DatabaseWriter_Read(t *testing.T) {
+	sut, err := newDatabaseWriter("sqlite", ":memory:", 0)
+	assert.NoError(t, err)
+
+	defer sut.Close()
+
+	// in-memory database exists only for one connection
+	sut.db.SetMaxOpenConns(1)
+
+	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	var entries []*queryLogEntry
+
+	for i, domain := range []string{"google.de.", "ads.example.com.", "example.com."} {
+		entries = append(entries, &queryLogEntry{
+			request: &Request{
+				ClientIP:    net.ParseIP("192.168.178.25"),
+				ClientNames: []string{"client1"},
+				Req:         util.NewMsgWithQuestion(domain, dns.TypeA),
+			},
+			response: &Response{Res: resp, Reason: "reason", RType: BLOCKED},
+			start:    time.Now().Add(time.Duration(i-3) * time.Hour),
+		})
+	}
+
+	sut.Write(entries)
+
+	result, err := sut.Read(queryLogFilter{domain: "example", client: "Client1", responseType: "BLOCKED", limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	// newest first
+	assert.Equal(t, "example.com", result[0].QuestionName)
+	assert.Equal(t, "ads.example.com", result[1].QuestionName)
+
+	result, err = sut.Read(queryLogFilter{client: "192.168.178.25", from: time.Now().Add(-150 * time.Minute), limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	result, err = sut.Read(queryLogFilter{limit: 1, offset: 2})
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "google.de", result[0].QuestionName)
+}
+
+func Test_DatabaseWriter_Read_Wildcards(t *testing.T) {
+	sut, err := newDatabaseWriter("sqlite", ":memory:", 0)
+	assert.NoError(t, err)
+
+	defer sut.Close()
+
+	// in-memory database exists only for one connection
+	sut.db.SetMaxOpenConns(1)
+
+	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	var entries []*queryLogEntry
+
+	for _, name := range []string{"my_host", "myXhost", "my%host"} {
+		entries = append(entries, &queryLogEntry{
+			request: &Request{
+				ClientIP:    net.ParseIP("192.168.178.25"),
+				ClientNames: []string{name},
+				Req:         util.NewMsgWithQuestion(name+".lan.", dns.TypeA),
+			},
+			response: &Response{Res: resp, Reason: "reason", RType: RESOLVED},
+			start:    time.Now(),
+		})
+	}
+
+	sut.Write(entries)
+
+	for _, search := range []string{"my_host", "my%host"} {
+		result, err := sut.Read(queryLogFilter{client: search, limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, result, 1)
+		assert.Equal(t, search, result[0].ClientName)
+
+		result, err = sut.Read(queryLogFilter{domain: search, limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, result, 1)
+		assert.Equal(t, search+".lan", result[0].QuestionName)
+	}
+}
+
+func Test_ContainsPattern(t *testing.T) {
+	assert.Equal(t, `%my\_host\%\\%`, containsPattern(`my_host%\`))
+}
@@ -0,0 +1,11 @@
+//go:build sqlite
+// +build sqlite
+
+package resolver
+
+import (
+	// SQLite driver needs cgo, it is only included with build tag "sqlite"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSupported = true
@@ -0,0 +1,303 @@
+package resolver
+
+import (
+	"blocky/api"
+	"blocky/util"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queryLogTypeConsole = "console"
+	queryLogTypeCsv     = "csv"
+	queryLogTypeSqlite  = "sqlite"
+	queryLogTypeMysql   = "mysql"
+)
+
+// queryLogWriter is the target of the query log
+type queryLogWriter interface {
+	// writes passed entries
+	Write(entries []*queryLogEntry)
+
+	// deletes entries which are older than the retention time
+	CleanUp()
+}
+
+// queryLogReader is implemented by query log targets which can be searched
+type queryLogReader interface {
+	// returns entries matching the filter, newest first
+	Read(filter queryLogFilter) ([]api.QueryLogEntry, error)
+}
+
+// consoleWriter logs each entry as log message
+type consoleWriter struct{}
+
+func (w *consoleWriter) Write(entries []*queryLogEntry) {
+	for _, logEntry := range entries {
+		logEntry.logger.WithFields(
+			logrus.Fields{
+				"response_reason": logEntry.response.Reason,
+				"response_code":   dns.RcodeToString[logEntry.response.Res.Rcode],
+				"answer":          util.AnswerToString(logEntry.response.Res.Answer),
+				"duration_ms":     logEntry.durationMs,
+			},
+		).Infof("query resolved")
+	}
+}
+
+func (w *consoleWriter) CleanUp() {
+}
+
+// fileWriter writes entries as tab separated rows in daily csv files (one file per client or one file for all)
+type fileWriter struct {
+	logDir           string
+	perClient        bool
+	logRetentionDays uint64
+}
+
+func newFileWriter(logDir string, perClient bool, logRetentionDays uint64) *fileWriter {
+	return &fileWriter{
+		logDir:           logDir,
+		perClient:        perClient,
+		logRetentionDays: logRetentionDays,
+	}
+}
+
+func (w *fileWriter) Write(entries []*queryLogEntry) {
+	var fileNames []string
+
+	rows := make(map[string][][]string)
+
+	for _, logEntry := range entries {
+		var clientPrefix string
+
+		dateString := logEntry.start.Format("2006-01-02")
+
+		if w.perClient {
+			clientPrefix = strings.Join(logEntry.request.ClientNames, "-")
+		} else {
+			clientPrefix = "ALL"
+		}
+
+		fileName := fmt.Sprintf("%s_%s.log", dateString, escape(clientPrefix))
+
+		if _, ok := rows[fileName]; !ok {
+			fileNames = append(fileNames, fileName)
+		}
+
+		rows[fileName] = append(rows[fileName], createQueryLogRow(logEntry))
+	}
+
+	for _, fileName := range fileNames {
+		w.writeFile(filepath.Join(w.logDir, fileName), rows[fileName])
+	}
+}
+
+func (w *fileWriter) writeFile(writePath string, rows [][]string) {
+	logger := logger(queryLoggingResolverPrefix).WithField("file_name", writePath)
+
+	file, err := os.OpenFile(writePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		logger.Error("can't create/open file", err)
+		return
+	}
+
+	defer file.Close()
+
+	// WriteAll flushes the writer
+	if err := createCsvWriter(file).WriteAll(rows); err != nil {
+		logger.Error("can't write to file", err)
+	}
+}
+
+// deletes old log files
+func (w *fileWriter) CleanUp() {
+	logger := logger(queryLoggingResolverPrefix)
+
+	files, err := ioutil.ReadDir(w.logDir)
+	if err != nil {
+		logger.WithField("log_dir", w.logDir).Error("can't list log directory: ", err)
+	}
+
+	// search for log files, which names starts with date
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".log") && len(f.Name()) > 10 {
+			t, err := time.Parse("2006-01-02", f.Name()[:10])
+			if err == nil {
+				differenceDays := uint64(time.Since(t).Hours() / 24)
+				if w.logRetentionDays > 0 && differenceDays > w.logRetentionDays {
+					logger.WithFields(logrus.Fields{
+						"file":             f.Name(),
+						"ageInDays":        differenceDays,
+						"logRetentionDays": w.logRetentionDays,
+					}).Info("existing log file is older than retention time and will be deleted")
+
+					err := os.Remove(filepath.Join(w.logDir, f.Name()))
+					if err != nil {
+						logger.WithField("file", f.Name()).Error("can't remove file: ", err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// reads all log files in the time range of the filter and returns matching entries
+func (w *fileWriter) Read(filter queryLogFilter) ([]api.QueryLogEntry, error) {
+	files, err := ioutil.ReadDir(w.logDir)
+	if err != nil {
+		return nil, fmt.Errorf("can't list log directory: %v", err)
+	}
+
+	var result []api.QueryLogEntry
+
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".log") || len(f.Name()) <= 10 {
+			continue
+		}
+
+		day, err := time.ParseInLocation("2006-01-02", f.Name()[:10], time.Local)
+		if err != nil {
+			continue
+		}
+
+		// skip files outside of the time range
+		if (!filter.from.IsZero() && !day.AddDate(0, 0, 1).After(filter.from)) ||
+			(!filter.to.IsZero() && day.After(filter.to)) {
+			continue
+		}
+
+		entries, err := readQueryLogFile(filepath.Join(w.logDir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range entries {
+			if filter.matches(&entries[i]) {
+				result = append(result, entries[i])
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.After(result[j].Time)
+	})
+
+	if filter.offset >= len(result) {
+		return nil, nil
+	}
+
+	result = result[filter.offset:]
+
+	if len(result) > filter.limit {
+		result = result[:filter.limit]
+	}
+
+	return result, nil
+}
+
+func readQueryLogFile(fileName string) ([]api.QueryLogEntry, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("can't open log file: %v", err)
+	}
+
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	// files written by older versions don't have the response type column
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("can't read log file '%s': %v", fileName, err)
+	}
+
+	result := make([]api.QueryLogEntry, 0, len(rows))
+
+	for _, row := range rows {
+		if entry, ok := parseQueryLogRow(row); ok {
+			result = append(result, entry)
+		}
+	}
+
+	return result, nil
+}
+
+// creates the entry from a row, which was created with createQueryLogRow
+func parseQueryLogRow(row []string) (entry api.QueryLogEntry, ok bool) {
+	if len(row) < 8 {
+		return entry, false
+	}
+
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", row[0], time.Local)
+	if err != nil {
+		return entry, false
+	}
+
+	duration, _ := strconv.ParseInt(row[3], 10, 64)
+
+	entry = api.QueryLogEntry{
+		Time:       t,
+		ClientIP:   row[1],
+		ClientName: row[2],
+		DurationMs: duration,
+		Reason:     row[4],
+		Answer:     row[6],
+		ReturnCode: row[7],
+	}
+
+	// question has format "A (example.com.)"
+	if parts := strings.SplitN(row[5], " (", 2); len(parts) == 2 {
+		entry.QuestionType = parts[0]
+		entry.QuestionName = util.ExtractDomainOnly(strings.SplitN(parts[1], ")", 2)[0])
+	}
+
+	if len(row) > 8 {
+		entry.ResponseType = row[8]
+	}
+
+	return entry, true
+}
+
+func escape(file string) string {
+	reg := regexp.MustCompile("[^a-zA-Z0-9-_]+")
+	return reg.ReplaceAllString(file, "_")
+}
+
+func createCsvWriter(file io.Writer) *csv.Writer {
+	writer := csv.NewWriter(file)
+	writer.Comma = '\t'
+
+	return writer
+}
+
+func createQueryLogRow(logEntry *queryLogEntry) []string {
+	request := logEntry.request
+	response := logEntry.response
+
+	return []string{
+		logEntry.start.Format("2006-01-02 15:04:05"),
+		request.ClientIP.String(),
+		strings.Join(request.ClientNames, "; "),
+		fmt.Sprintf("%d", logEntry.durationMs),
+		response.Reason,
+		util.QuestionToString(request.Req.Question),
+		util.AnswerToString(response.Res.Answer),
+		dns.RcodeToString[response.Res.Rcode],
+		response.RType.String(),
+	}
+}
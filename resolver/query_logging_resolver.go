@@ -1,19 +1,18 @@
 package resolver
 
 import (
+	"blocky/api"
 	"blocky/config"
-	"blocky/util"
-	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-	"regexp"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/miekg/dns"
+	"github.com/go-chi/chi"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
@@ -22,16 +21,23 @@ const (
 	cleanUpRunPeriod           = 12 * time.Hour
 	queryLoggingResolverPrefix = "query_logging_resolver"
 	logChanCap                 = 1000
+	logBatchSize               = 50
+	defaultQueryLogLimit       = 100
 )
 
 // QueryLoggingResolver writes query information (question, answer, duration, ...) into
-// log file or as log entry (if log directory is not configured)
+// log file, database or as log entry (if log directory is not configured)
 type QueryLoggingResolver struct {
 	NextResolver
+	logType          string
 	logDir           string
 	perClient        bool
 	logRetentionDays uint64
+	writer           queryLogWriter
 	logChan          chan *queryLogEntry
+	stopChan         chan struct{}
+	// will be closed after the log writer has written the waiting entries
+	doneChan chan struct{}
 }
 
 type queryLogEntry struct {
@@ -42,18 +48,47 @@ type queryLogEntry struct {
 	logger     *logrus.Entry
 }
 
-func NewQueryLoggingResolver(cfg config.QueryLogConfig) ChainedResolver {
-	if cfg.Dir != "" && unix.Access(cfg.Dir, unix.W_OK) != nil {
-		logger(queryLoggingResolverPrefix).Fatalf("query log directory '%s' does not exist or is not writable", cfg.Dir)
+func NewQueryLoggingResolver(cfg config.QueryLogConfig) (ChainedResolver, error) {
+	logType := strings.ToLower(cfg.Type)
+	if logType == "" {
+		logType = queryLogTypeConsole
+
+		if cfg.Dir != "" {
+			logType = queryLogTypeCsv
+		}
+	}
+
+	var writer queryLogWriter
+
+	switch logType {
+	case queryLogTypeCsv:
+		if unix.Access(cfg.Dir, unix.W_OK) != nil {
+			return nil, fmt.Errorf("query log directory '%s' does not exist or is not writable", cfg.Dir)
+		}
+
+		writer = newFileWriter(cfg.Dir, cfg.PerClient, cfg.LogRetentionDays)
+	case queryLogTypeSqlite, queryLogTypeMysql:
+		dbWriter, err := newDatabaseWriter(logType, cfg.Target, cfg.LogRetentionDays)
+		if err != nil {
+			return nil, fmt.Errorf("can't open query log database: %v", err)
+		}
+
+		writer = dbWriter
+	default:
+		writer = &consoleWriter{}
 	}
 
 	logChan := make(chan *queryLogEntry, logChanCap)
 
 	resolver := QueryLoggingResolver{
+		logType:          logType,
 		logDir:           cfg.Dir,
 		perClient:        cfg.PerClient,
 		logRetentionDays: cfg.LogRetentionDays,
+		writer:           writer,
 		logChan:          logChan,
+		stopChan:         make(chan struct{}),
+		doneChan:         make(chan struct{}),
 	}
 
 	go resolver.writeLog()
@@ -62,52 +97,167 @@ func NewQueryLoggingResolver(cfg config.QueryLogConfig) ChainedResolver {
 		go resolver.periodicCleanUp()
 	}
 
-	return &resolver
+	return &resolver, nil
+}
+
+// RegisterQueryLogAPIEndpoints registers the REST endpoints of the query logging resolver. The handlers call the
+// resolver returned by current, so the endpoints are registered only once and use the new resolver after
+// a config reload
+func RegisterQueryLogAPIEndpoints(router chi.Router, current func() *QueryLoggingResolver) {
+	router.Get(api.QueryLogPath, func(rw http.ResponseWriter, req *http.Request) {
+		current().apiQueryLog(rw, req)
+	})
+}
+
+// apiQueryLog is the http endpoint to search the query log
+// @Summary Search query log
+// @Description returns matching query log entries, newest first. Not available for query log type console
+// @Tags querylog
+// @Produce  json
+// @Param client query string false "client name (part of) or client IP"
+// @Param domain query string false "queried domain (part of)"
+// @Param responseType query string false "response type (RESOLVED, CACHED, BLOCKED, CONDITIONAL, CUSTOMDNS, STALE)"
+// @Param from query string false "only entries after this time (RFC 3339)" Format(date-time)
+// @Param to query string false "only entries before this time (RFC 3339)" Format(date-time)
+// @Param limit query int false "max count of entries (default 100)"
+// @Param offset query int false "count of entries to skip (pagination)"
+// @Success 200 {array} api.QueryLogEntry "Returns matching query log entries"
+// @Failure 400   "Wrong parameter format"
+// @Failure 501   "Query log can't be searched"
+// @Router /querylog [get]
+func (r *QueryLoggingResolver) apiQueryLog(rw http.ResponseWriter, req *http.Request) {
+	logger := logger(queryLoggingResolverPrefix)
+
+	reader, ok := r.writer.(queryLogReader)
+	if !ok {
+		http.Error(rw, fmt.Sprintf("query log type '%s' can't be searched", r.logType), http.StatusNotImplemented)
+		return
+	}
+
+	filter, err := newQueryLogFilter(req.URL.Query())
+	if err != nil {
+		logger.Warn("wrong query log filter: ", err)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	entries, err := reader.Read(filter)
+	if err != nil {
+		logger.Error("can't read query log: ", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	if entries == nil {
+		entries = []api.QueryLogEntry{}
+	}
+
+	response, _ := json.Marshal(entries)
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if _, err = rw.Write(response); err != nil {
+		logger.Error("unable to write response ", err)
+	}
+}
+
+// queryLogFilter contains the search criteria for the query log
+type queryLogFilter struct {
+	client       string
+	domain       string
+	responseType string
+	from         time.Time
+	to           time.Time
+	limit        int
+	offset       int
+}
+
+// creates the filter from http query parameters
+func newQueryLogFilter(values url.Values) (filter queryLogFilter, err error) {
+	filter.client = strings.TrimSpace(values.Get("client"))
+	filter.domain = strings.ToLower(strings.TrimSpace(values.Get("domain")))
+	filter.responseType = strings.ToUpper(strings.TrimSpace(values.Get("responseType")))
+	filter.limit = defaultQueryLogLimit
+
+	if v := values.Get("from"); v != "" {
+		if filter.from, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("wrong 'from' format: %v", err)
+		}
+	}
+
+	if v := values.Get("to"); v != "" {
+		if filter.to, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("wrong 'to' format: %v", err)
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		if filter.limit, err = strconv.Atoi(v); err != nil || filter.limit <= 0 {
+			return filter, fmt.Errorf("wrong 'limit' value '%s'", v)
+		}
+	}
+
+	if v := values.Get("offset"); v != "" {
+		if filter.offset, err = strconv.Atoi(v); err != nil || filter.offset < 0 {
+			return filter, fmt.Errorf("wrong 'offset' value '%s'", v)
+		}
+	}
+
+	return filter, nil
 }
 
-// triggers periodically cleanup of old log files
+// returns true if the entry matches all criteria of the filter (without pagination)
+func (f *queryLogFilter) matches(entry *api.QueryLogEntry) bool {
+	if f.client != "" && entry.ClientIP != f.client &&
+		!strings.Contains(strings.ToLower(entry.ClientName), strings.ToLower(f.client)) {
+		return false
+	}
+
+	if f.domain != "" && !strings.Contains(entry.QuestionName, f.domain) {
+		return false
+	}
+
+	if f.responseType != "" && entry.ResponseType != f.responseType {
+		return false
+	}
+
+	if !f.from.IsZero() && entry.Time.Before(f.from) {
+		return false
+	}
+
+	return f.to.IsZero() || !entry.Time.After(f.to)
+}
+
+// triggers periodically cleanup of old log entries
 func (r *QueryLoggingResolver) periodicCleanUp() {
 	ticker := time.NewTicker(cleanUpRunPeriod)
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
-		r.doCleanUp()
+		select {
+		case <-ticker.C:
+			r.doCleanUp()
+		case <-r.stopChan:
+			return
+		}
 	}
 }
 
-// deletes old log files
-func (r *QueryLoggingResolver) doCleanUp() {
-	logger := logger(queryLoggingResolverPrefix)
+// Close stops the periodical clean up and the log writer, after the waiting entries were written
+func (r *QueryLoggingResolver) Close() error {
+	close(r.stopChan)
+	<-r.doneChan
 
-	logger.Trace("starting clean up")
+	return nil
+}
 
-	files, err := ioutil.ReadDir(r.logDir)
-	if err != nil {
-		logger.WithField("log_dir", r.logDir).Error("can't list log directory: ", err)
-	}
-
-	// search for log files, which names starts with date
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".log") && len(f.Name()) > 10 {
-			t, err := time.Parse("2006-01-02", f.Name()[:10])
-			if err == nil {
-				differenceDays := uint64(time.Since(t).Hours() / 24)
-				if r.logRetentionDays > 0 && differenceDays > r.logRetentionDays {
-					logger.WithFields(logrus.Fields{
-						"file":             f.Name(),
-						"ageInDays":        differenceDays,
-						"logRetentionDays": r.logRetentionDays,
-					}).Info("existing log file is older than retention time and will be deleted")
-
-					err := os.Remove(filepath.Join(r.logDir, f.Name()))
-					if err != nil {
-						logger.WithField("file", f.Name()).Error("can't remove file: ", err)
-					}
-				}
-			}
-		}
-	}
+// deletes log entries which are older than the retention time
+func (r *QueryLoggingResolver) doCleanUp() {
+	logger(queryLoggingResolverPrefix).Trace("starting clean up")
+
+	r.writer.CleanUp()
 }
 
 func (r *QueryLoggingResolver) Resolve(request *Request) (*Response, error) {
@@ -115,11 +265,19 @@ func (r *QueryLoggingResolver) Resolve(request *Request) (*Response, error) {
 
 	start := time.Now()
 
-	resp, err := r.next.Resolve(request)
+	resp, err := r.GetNext().Resolve(request)
 
 	duration := time.Since(start).Milliseconds()
 
 	if err == nil {
+		select {
+		case <-r.stopChan:
+			logger.Warn("query log writer was closed, log entry will be dropped")
+
+			return resp, err
+		default:
+		}
+
 		select {
 		case r.logChan <- &queryLogEntry{
 			request:    request,
@@ -135,100 +293,75 @@ func (r *QueryLoggingResolver) Resolve(request *Request) (*Response, error) {
 	return resp, err
 }
 
-// write entry: if log directory is configured, write to log file
+// reads entries from the log channel and passes them in batches to the writer
 func (r *QueryLoggingResolver) writeLog() {
-	for logEntry := range r.logChan {
-		if r.logDir != "" {
-			var clientPrefix string
+	defer close(r.doneChan)
 
-			start := time.Now()
-
-			dateString := logEntry.start.Format("2006-01-02")
+	for {
+		var entries []*queryLogEntry
 
-			if r.perClient {
-				clientPrefix = strings.Join(logEntry.request.ClientNames, "-")
-			} else {
-				clientPrefix = "ALL"
+		select {
+		case logEntry := <-r.logChan:
+			entries = append(entries, logEntry)
+		case <-r.stopChan:
+			// write the entries of requests, which were processed before the resolver was closed
+			for entries = r.waitingEntries(nil); len(entries) > 0; entries = r.waitingEntries(nil) {
+				r.writer.Write(entries)
 			}
 
-			fileName := fmt.Sprintf("%s_%s.log", dateString, escape(clientPrefix))
-			writePath := filepath.Join(r.logDir, fileName)
+			if c, ok := r.writer.(io.Closer); ok {
+				_ = c.Close()
+			}
 
-			file, err := os.OpenFile(writePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+			return
+		}
 
-			if err != nil {
-				logEntry.logger.WithField("file_name", writePath).Error("can't create/open file", err)
-			} else {
-				writer := createCsvWriter(file)
+		// take all waiting entries, they will be written together
+		entries = r.waitingEntries(entries)
 
-				err := writer.Write(createQueryLogRow(logEntry))
-				if err != nil {
-					logEntry.logger.WithField("file_name", writePath).Error("can't write to file", err)
-				}
-				writer.Flush()
+		start := time.Now()
 
-				file.Close()
-			}
+		r.writer.Write(entries)
 
-			halfCap := cap(r.logChan) / 2
+		halfCap := cap(r.logChan) / 2
 
-			// if log channel is > 50% full, this could be a problem with slow writer (external storage over network etc.)
-			if len(r.logChan) > halfCap {
-				logEntry.logger.WithField("channel_len",
-					len(r.logChan)).Warnf("query log writer is too slow, write duration: %d ms", time.Since(start).Milliseconds())
-			}
-		} else {
-			logEntry.logger.WithFields(
-				logrus.Fields{
-					"response_reason": logEntry.response.Reason,
-					"response_code":   dns.RcodeToString[logEntry.response.Res.Rcode],
-					"answer":          util.AnswerToString(logEntry.response.Res.Answer),
-					"duration_ms":     logEntry.durationMs,
-				},
-			).Infof("query resolved")
+		// if log channel is > 50% full, this could be a problem with slow writer (external storage over network etc.)
+		if len(r.logChan) > halfCap {
+			logger(queryLoggingResolverPrefix).WithField("channel_len",
+				len(r.logChan)).Warnf("query log writer is too slow, write duration: %d ms", time.Since(start).Milliseconds())
 		}
 	}
 }
 
-func escape(file string) string {
-	reg := regexp.MustCompile("[^a-zA-Z0-9-_]+")
-	return reg.ReplaceAllString(file, "_")
-}
-
-func createCsvWriter(file io.Writer) *csv.Writer {
-	writer := csv.NewWriter(file)
-	writer.Comma = '\t'
-
-	return writer
-}
-
-func createQueryLogRow(logEntry *queryLogEntry) []string {
-	request := logEntry.request
-	response := logEntry.response
-
-	return []string{
-		logEntry.start.Format("2006-01-02 15:04:05"),
-		request.ClientIP.String(),
-		strings.Join(request.ClientNames, "; "),
-		fmt.Sprintf("%d", logEntry.durationMs),
-		response.Reason,
-		util.QuestionToString(request.Req.Question),
-		util.AnswerToString(response.Res.Answer),
-		dns.RcodeToString[response.Res.Rcode],
+// appends the entries waiting in the log channel (up to the batch size) without blocking
+func (r *QueryLoggingResolver) waitingEntries(entries []*queryLogEntry) []*queryLogEntry {
+	for len(entries) < logBatchSize {
+		select {
+		case logEntry := <-r.logChan:
+			entries = append(entries, logEntry)
+		default:
+			return entries
+		}
 	}
+
+	return entries
 }
 
 func (r *QueryLoggingResolver) Configuration() (result []string) {
-	if r.logDir != "" {
+	switch r.logType {
+	case queryLogTypeCsv:
 		result = append(result, fmt.Sprintf("logDir= \"%s\"", r.logDir))
 		result = append(result, fmt.Sprintf("perClient = %t", r.perClient))
-		result = append(result, fmt.Sprintf("logRetentionDays= %d", r.logRetentionDays))
+	case queryLogTypeSqlite, queryLogTypeMysql:
+		result = append(result, fmt.Sprintf("type = \"%s\"", r.logType))
+	default:
+		return []string{"deactivated"}
+	}
 
-		if r.logRetentionDays == 0 {
-			result = append(result, "log cleanup deactivated")
-		}
-	} else {
-		result = []string{"deactivated"}
+	result = append(result, fmt.Sprintf("logRetentionDays= %d", r.logRetentionDays))
+
+	if r.logRetentionDays == 0 {
+		result = append(result, "log cleanup deactivated")
 	}
 
 	return
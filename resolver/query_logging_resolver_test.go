@@ -1,15 +1,20 @@
 package resolver
 
 import (
+	"blocky/api"
 	"blocky/config"
 	"blocky/util"
 	"bufio"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
@@ -22,30 +27,15 @@ import (
 )
 
 func Test_New_LogDirNotExist(t *testing.T) {
-	defer func() { logrus.StandardLogger().ExitFunc = nil }()
+	_, err := NewQueryLoggingResolver(config.QueryLogConfig{Dir: "notExists"})
 
-	var fatal bool
-
-	logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
-	_ = NewQueryLoggingResolver(config.QueryLogConfig{Dir: "notExists"})
-
-	assert.True(t, fatal)
+	assert.Error(t, err)
 }
 
 func Test_doCleanUp_WrongDir(t *testing.T) {
-	defer func() { logrus.StandardLogger().ExitFunc = nil }()
+	sut := &QueryLoggingResolver{writer: newFileWriter("wrongDir", false, 7)}
 
-	var fatal bool
-
-	logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
-
-	sut := NewQueryLoggingResolver(config.QueryLogConfig{
-		Dir:              "wrongDir",
-		LogRetentionDays: 7,
-	})
-
-	sut.(*QueryLoggingResolver).doCleanUp()
-	assert.True(t, fatal)
+	assert.NotPanics(t, sut.doCleanUp)
 }
 
 func Test_doCleanUp(t *testing.T) {
@@ -63,10 +53,11 @@ func Test_doCleanUp(t *testing.T) {
 	f2, err := os.Create(filepath.Join(tmpDir, fmt.Sprintf("%s-test.log", dateBefore8Days.Format("2006-01-02"))))
 	assert.NoError(t, err)
 
-	sut := NewQueryLoggingResolver(config.QueryLogConfig{
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{
 		Dir:              tmpDir,
 		LogRetentionDays: 7,
 	})
+	assert.NoError(t, err)
 
 	sut.(*QueryLoggingResolver).doCleanUp()
 
@@ -81,7 +72,8 @@ func Test_doCleanUp(t *testing.T) {
 }
 
 func Test_Resolve_WithEmptyConfig(t *testing.T) {
-	sut := NewQueryLoggingResolver(config.QueryLogConfig{})
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{})
+	assert.NoError(t, err)
 	m := &resolverMock{}
 	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
 	assert.NoError(t, err)
@@ -103,10 +95,11 @@ func Test_Resolve_WithLoggingPerClient(t *testing.T) {
 
 	defer os.RemoveAll(tmpDir)
 
-	sut := NewQueryLoggingResolver(config.QueryLogConfig{
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{
 		Dir:       tmpDir,
 		PerClient: true,
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
@@ -162,10 +155,11 @@ func Test_Resolve_WithLoggingAll(t *testing.T) {
 
 	defer os.RemoveAll(tmpDir)
 
-	sut := NewQueryLoggingResolver(config.QueryLogConfig{
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{
 		Dir:       tmpDir,
 		PerClient: false,
 	})
+	assert.NoError(t, err)
 
 	m := &resolverMock{}
 	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
@@ -212,6 +206,66 @@ func Test_Resolve_WithLoggingAll(t *testing.T) {
 	assert.Equal(t, "A (123.122.121.120)", csvLines[1][6])
 }
 
+// queryLogWriterMock collects all written entries
+type queryLogWriterMock struct {
+	entries []*queryLogEntry
+}
+
+func (w *queryLogWriterMock) Write(entries []*queryLogEntry) {
+	w.entries = append(w.entries, entries...)
+}
+
+func (w *queryLogWriterMock) CleanUp() {}
+
+func Test_Close_WritesWaitingEntries(t *testing.T) {
+	writer := &queryLogWriterMock{}
+	sut := &QueryLoggingResolver{
+		writer:   writer,
+		logChan:  make(chan *queryLogEntry, logChanCap),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+
+	m := &resolverMock{}
+	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	m.On("Resolve", mock.Anything).Return(&Response{Res: resp, Reason: "reason"}, nil)
+	sut.Next(m)
+
+	request := &Request{
+		ClientIP: net.ParseIP("192.168.178.25"),
+		Req:      util.NewMsgWithQuestion("google.de.", dns.TypeA),
+		Log:      logrus.NewEntry(logrus.New())}
+
+	for i := 0; i < 3; i++ {
+		_, err = sut.Resolve(request)
+		assert.NoError(t, err)
+	}
+
+	go sut.writeLog()
+
+	// returns after the waiting entries were written
+	assert.NoError(t, sut.Close())
+	assert.Len(t, writer.entries, 3)
+
+	// requests after close will not be logged
+	_, err = sut.Resolve(request)
+	assert.NoError(t, err)
+	assert.Len(t, sut.logChan, 0)
+}
+
+func Test_NewDatabaseWriter_Sqlite(t *testing.T) {
+	sut, err := newDatabaseWriter(queryLogTypeSqlite, ":memory:", 0)
+
+	if sqliteSupported {
+		assert.NoError(t, err)
+		assert.NoError(t, sut.Close())
+	} else {
+		assert.Error(t, err)
+	}
+}
+
 func readCsv(file string) [][]string {
 	var result [][]string
 
@@ -243,17 +297,107 @@ func Test_Configuration_QueryLoggingResolver_WithConfig(t *testing.T) {
 
 	defer os.RemoveAll(tmpDir)
 
-	sut := NewQueryLoggingResolver(config.QueryLogConfig{
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{
 		Dir:              tmpDir,
 		PerClient:        true,
 		LogRetentionDays: 0,
 	})
+	assert.NoError(t, err)
 	c := sut.Configuration()
 	assert.Len(t, c, 4)
 }
 
 func Test_Configuration_QueryLoggingResolver_Disabled(t *testing.T) {
-	sut := NewQueryLoggingResolver(config.QueryLogConfig{})
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{})
+	assert.NoError(t, err)
 	c := sut.Configuration()
 	assert.Equal(t, []string{"deactivated"}, c)
 }
+
+func Test_ApiQueryLog_Csv(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "queryLoggingResolver")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{
+		Dir: tmpDir,
+	})
+	assert.NoError(t, err)
+
+	m := &resolverMock{}
+	resp, err := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+	assert.NoError(t, err)
+
+	m.On("Resolve", mock.Anything).Return(&Response{Res: resp, Reason: "reason", RType: BLOCKED}, nil)
+	sut.Next(m)
+
+	for _, domain := range []string{"google.de.", "ads.example.com.", "example.com."} {
+		_, err = sut.Resolve(&Request{
+			ClientIP:    net.ParseIP("192.168.178.25"),
+			ClientNames: []string{"client1"},
+			Req:         util.NewMsgWithQuestion(domain, dns.TypeA),
+			Log:         logrus.NewEntry(logrus.New())})
+		assert.NoError(t, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	entries := queryLogRequest(t, sut, "?domain=example&client=CLIENT1&responseType=blocked")
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "192.168.178.25", entries[0].ClientIP)
+	assert.Equal(t, "BLOCKED", entries[0].ResponseType)
+	assert.Equal(t, "A", entries[0].QuestionType)
+
+	entries = queryLogRequest(t, sut, "?limit=1&offset=2")
+	assert.Len(t, entries, 1)
+
+	entries = queryLogRequest(t, sut, "?client=client2")
+	assert.Len(t, entries, 0)
+
+	entries = queryLogRequest(t, sut, "?from="+url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)))
+	assert.Len(t, entries, 0)
+}
+
+func Test_ApiQueryLog_WrongParameter(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "queryLoggingResolver")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{Dir: tmpDir})
+	assert.NoError(t, err)
+
+	for _, query := range []string{"?from=yesterday", "?limit=-1", "?offset=abc"} {
+		r, _ := http.NewRequest("GET", api.QueryLogPath+query, nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(sut.(*QueryLoggingResolver).apiQueryLog).ServeHTTP(rr, r)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	}
+}
+
+func Test_ApiQueryLog_Console(t *testing.T) {
+	sut, err := NewQueryLoggingResolver(config.QueryLogConfig{})
+	assert.NoError(t, err)
+
+	r, _ := http.NewRequest("GET", api.QueryLogPath, nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(sut.(*QueryLoggingResolver).apiQueryLog).ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+}
+
+func queryLogRequest(t *testing.T, sut ChainedResolver, query string) (result []api.QueryLogEntry) {
+	r, _ := http.NewRequest("GET", api.QueryLogPath+query, nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(sut.(*QueryLoggingResolver).apiQueryLog).ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+
+	return result
+}
@@ -0,0 +1,35 @@
+package resolver
+
+import (
+	"blocky/config"
+	"math/rand"
+)
+
+// RandomResolver delegates the DNS message to one random upstream resolver.
+// Another random resolver will be used if it fails
+type RandomResolver struct {
+	resolvers []*upstreamHealth
+}
+
+func NewRandomResolver(cfg config.UpstreamConfig) Resolver {
+	return &RandomResolver{resolvers: createUpstreamHealths(cfg.ExternalResolvers)}
+}
+
+func (r *RandomResolver) Configuration() (result []string) {
+	return upstreamsConfiguration("upstream resolvers (random):", r.resolvers)
+}
+
+func (r *RandomResolver) Resolve(request *Request) (*Response, error) {
+	return resolveSequential(request, r.shuffle(), "random_resolver")
+}
+
+// returns the available resolvers in random order, followed by the excluded ones
+func (r *RandomResolver) shuffle() []*upstreamHealth {
+	available, excluded := partitionAvailable(r.resolvers)
+
+	rand.Shuffle(len(available), func(i, j int) {
+		available[i], available[j] = available[j], available[i]
+	})
+
+	return append(available, excluded...)
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"blocky/config"
+	"blocky/util"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Resolve_Random_Fallback(t *testing.T) {
+	withError := config.Upstream{Host: "wrong"}
+
+	upstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.123")
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	sut := NewRandomResolver(config.UpstreamConfig{ExternalResolvers: []config.Upstream{withError, upstream}})
+
+	for i := 0; i < 10; i++ {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "example.com.	123	IN	A	123.124.122.123", resp.Res.Answer[0].String())
+	}
+}
+
+func Test_Shuffle_Random(t *testing.T) {
+	sut := NewRandomResolver(config.UpstreamConfig{
+		ExternalResolvers: []config.Upstream{
+			{Host: "host1"},
+			{Host: "host2"},
+			{Host: "host3"}}}).(*RandomResolver)
+
+	sut.resolvers[0].disabledUntil = time.Now().Add(time.Minute)
+
+	first := make(map[*upstreamHealth]int)
+
+	for i := 0; i < 100; i++ {
+		shuffled := sut.shuffle()
+
+		assert.Len(t, shuffled, 3)
+
+		// excluded resolver is always the last one
+		assert.Equal(t, sut.resolvers[0], shuffled[2])
+
+		first[shuffled[0]]++
+	}
+
+	// both available resolvers were used as first one
+	assert.Len(t, first, 2)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
@@ -26,6 +27,7 @@ const (
 	BLOCKED
 	CONDITIONAL
 	CUSTOMDNS
+	STALE
 )
 
 func (r ResponseType) String() string {
@@ -34,7 +36,8 @@ func (r ResponseType) String() string {
 		"CACHED",
 		"BLOCKED",
 		"CONDITIONAL",
-		"CUSTOMDNS"}
+		"CUSTOMDNS",
+		"STALE"}
 
 	return names[r]
 }
@@ -55,16 +58,34 @@ type ChainedResolver interface {
 	GetNext() Resolver
 }
 
+// UpstreamGroupSelector is implemented by resolvers, which delegate the request to different upstream groups
+type UpstreamGroupSelector interface {
+	// returns the upstream group of the request
+	UpstreamGroup(req *Request) string
+}
+
+// NextResolver holds the next resolver of the chain. The next resolver can be replaced (on config reload)
+// while requests are processed
 type NextResolver struct {
-	next Resolver
+	// contains nextResolver
+	next atomic.Value
+}
+
+// wrapper with constant type for atomic.Value
+type nextResolver struct {
+	Resolver
 }
 
 func (r *NextResolver) Next(n Resolver) {
-	r.next = n
+	r.next.Store(nextResolver{n})
 }
 
 func (r *NextResolver) GetNext() Resolver {
-	return r.next
+	if n, ok := r.next.Load().(nextResolver); ok {
+		return n.Resolver
+	}
+
+	return nil
 }
 
 func logger(prefix string) *logrus.Entry {
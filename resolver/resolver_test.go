@@ -4,20 +4,37 @@ import (
 	"blocky/config"
 	"testing"
 
-	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
 )
 
 func Test_Chain(t *testing.T) {
-	ch := Chain(NewBlockingResolver(chi.NewRouter(),
-		config.BlockingConfig{}), NewClientNamesResolver(config.ClientLookupConfig{}))
+	blocking, err := NewBlockingResolver(config.BlockingConfig{})
+	assert.NoError(t, err)
+
+	ch := Chain(blocking, NewClientNamesResolver(config.ClientLookupConfig{}))
 	c, ok := ch.(ChainedResolver)
 	assert.True(t, ok)
 
 	next := c.GetNext()
 	assert.NotNil(t, next)
 }
+func Test_Chain_ReplaceNext(t *testing.T) {
+	sut := NewClientNamesResolver(config.ClientLookupConfig{})
+	assert.Nil(t, sut.GetNext())
+
+	first, second := &resolverMock{}, &resolverMock{}
+
+	Chain(sut, first)
+	assert.Equal(t, first, sut.GetNext())
+
+	Chain(sut, second)
+	assert.Equal(t, second, sut.GetNext())
+}
+
 func Test_Name(t *testing.T) {
-	name := Name(NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{}))
+	blocking, err := NewBlockingResolver(config.BlockingConfig{})
+	assert.NoError(t, err)
+
+	name := Name(blocking)
 	assert.Equal(t, "BlockingResolver", name)
 }
@@ -52,7 +52,7 @@ func (r *StatsResolver) collectStats() {
 }
 
 func (r *StatsResolver) Resolve(request *Request) (*Response, error) {
-	resp, err := r.next.Resolve(request)
+	resp, err := r.GetNext().Resolve(request)
 
 	if err == nil {
 		r.statsChan <- &statsEntry{
@@ -85,7 +85,7 @@ func NewStatsResolver() ChainedResolver {
 
 	go resolver.collectStats()
 
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGUSR2)
 
 	go func() {
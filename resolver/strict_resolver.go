@@ -0,0 +1,23 @@
+package resolver
+
+import (
+	"blocky/config"
+)
+
+// StrictResolver delegates the DNS message to the upstream resolvers in the configured order.
+// The next resolver will be used only if the previous one fails
+type StrictResolver struct {
+	resolvers []*upstreamHealth
+}
+
+func NewStrictResolver(cfg config.UpstreamConfig) Resolver {
+	return &StrictResolver{resolvers: createUpstreamHealths(cfg.ExternalResolvers)}
+}
+
+func (r *StrictResolver) Configuration() (result []string) {
+	return upstreamsConfiguration("upstream resolvers (strict order):", r.resolvers)
+}
+
+func (r *StrictResolver) Resolve(request *Request) (*Response, error) {
+	return resolveSequential(request, r.resolvers, "strict_resolver")
+}
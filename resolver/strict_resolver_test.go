@@ -0,0 +1,80 @@
+package resolver
+
+import (
+	"blocky/config"
+	"blocky/util"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Resolve_Strict_FirstResolver(t *testing.T) {
+	first := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.122")
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	second := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.123")
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	sut := NewStrictResolver(config.UpstreamConfig{ExternalResolvers: []config.Upstream{first, second}})
+
+	// slow first resolver is always used
+	for i := 0; i < 5; i++ {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "example.com.	123	IN	A	123.124.122.122", resp.Res.Answer[0].String())
+	}
+}
+
+func Test_Resolve_Strict_Fallback(t *testing.T) {
+	withError := config.Upstream{Host: "wrong"}
+
+	second := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.123")
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	sut := NewStrictResolver(config.UpstreamConfig{ExternalResolvers: []config.Upstream{withError, second}})
+
+	for i := 0; i < failuresBeforeBackoff+1; i++ {
+		resp, err := sut.Resolve(&Request{
+			Req: util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			Log: logrus.NewEntry(logrus.New()),
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "example.com.	123	IN	A	123.124.122.123", resp.Res.Answer[0].String())
+	}
+
+	// configured order is kept, failing first resolver is still tried on each request
+	assert.Equal(t, failuresBeforeBackoff+1, sut.(*StrictResolver).resolvers[0].consecutiveFailures)
+}
+
+func Test_Resolve_Strict_All_Error(t *testing.T) {
+	sut := NewStrictResolver(config.UpstreamConfig{ExternalResolvers: []config.Upstream{{Host: "wrong"}, {Host: "wrong"}}})
+
+	resp, err := sut.Resolve(&Request{
+		Req: util.NewMsgWithQuestion("example.com.", dns.TypeA),
+		Log: logrus.NewEntry(logrus.New()),
+	})
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+}
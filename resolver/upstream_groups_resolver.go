@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"blocky/config"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const upstreamGroupsResolverPrefix = "upstream_groups_resolver"
+
+// UpstreamGroupsResolver delegates the DNS message to the upstream group of the client.
+// Each group uses the configured upstream strategy
+type UpstreamGroupsResolver struct {
+	groups        map[string]Resolver
+	clientGroups  map[string]string
+	clientMatcher *clientMatcher
+}
+
+func NewUpstreamGroupsResolver(cfg config.UpstreamConfig) Resolver {
+	groups := make(map[string]Resolver, len(cfg.Groups)+1)
+
+	groups[config.UpstreamDefaultGroup] = NewUpstreamStrategyResolver(cfg)
+
+	for name, upstreams := range cfg.Groups {
+		groupCfg := cfg
+		groupCfg.ExternalResolvers = upstreams
+		groups[name] = NewUpstreamStrategyResolver(groupCfg)
+	}
+
+	keys := make([]string, 0, len(cfg.ClientGroups))
+	for key := range cfg.ClientGroups {
+		keys = append(keys, key)
+	}
+
+	return &UpstreamGroupsResolver{
+		groups:        groups,
+		clientGroups:  cfg.ClientGroups,
+		clientMatcher: newClientMatcher(keys),
+	}
+}
+
+func (r *UpstreamGroupsResolver) Configuration() (result []string) {
+	if len(r.groups) == 1 {
+		return r.groups[config.UpstreamDefaultGroup].Configuration()
+	}
+
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		result = append(result, fmt.Sprintf("group '%s':", name))
+		for _, c := range r.groups[name].Configuration() {
+			result = append(result, fmt.Sprintf("  %s", c))
+		}
+	}
+
+	if len(r.clientGroups) > 0 {
+		result = append(result, "clientGroups:")
+		for client, group := range r.clientGroups {
+			result = append(result, fmt.Sprintf("  %s = \"%s\"", client, group))
+		}
+	}
+
+	return
+}
+
+func (r *UpstreamGroupsResolver) Resolve(request *Request) (*Response, error) {
+	logger := withPrefix(request.Log, upstreamGroupsResolverPrefix)
+
+	group := r.UpstreamGroup(request)
+
+	logger.WithField("group", group).Debug("delegating to upstream group")
+
+	resp, err := r.groups[group].Resolve(request)
+
+	if err == nil && len(r.groups) > 1 {
+		resp.Reason = reasonWithGroup(resp.Reason, group)
+	}
+
+	return resp, err
+}
+
+// UpstreamGroup returns the upstream group of the client. Precedence of the client keys: client name,
+// wildcard name, IP address, CIDR (most specific first). Clients without mapping use the group "default"
+func (r *UpstreamGroupsResolver) UpstreamGroup(request *Request) string {
+	if keys := r.clientMatcher.match(request.ClientNames, request.ClientIP); len(keys) > 0 {
+		return r.clientGroups[keys[0]]
+	}
+
+	return config.UpstreamDefaultGroup
+}
+
+// adds the group name to the reason: "RESOLVED (upstream)" -> "RESOLVED (group: upstream)"
+func reasonWithGroup(reason, group string) string {
+	if i := strings.Index(reason, "("); i >= 0 {
+		return fmt.Sprintf("%s%s: %s", reason[:i+1], group, reason[i+1:])
+	}
+
+	return fmt.Sprintf("%s (%s)", reason, group)
+}
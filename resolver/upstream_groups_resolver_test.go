@@ -0,0 +1,155 @@
+package resolver
+
+import (
+	"blocky/config"
+	"blocky/util"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Resolve_UpstreamGroups(t *testing.T) {
+	defaultUpstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.122")
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	kidsUpstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.123")
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	sut := NewUpstreamGroupsResolver(config.UpstreamConfig{
+		ExternalResolvers: []config.Upstream{defaultUpstream},
+		Groups:            map[string][]config.Upstream{"kids": {kidsUpstream}},
+		ClientGroups: map[string]string{
+			"kid-laptop":      "kids",
+			"192.168.178.55":  "kids",
+			"10.0.0.0/8":      "kids",
+			"laptop-*":        "kids",
+			"192.168.178.100": "default",
+		},
+	})
+
+	tests := []struct {
+		name        string
+		clientNames []string
+		clientIP    string
+		answer      string
+		group       string
+	}{
+		{"by name", []string{"kid-laptop"}, "192.168.178.25", "123.124.122.123", "kids"},
+		{"by IP", []string{"unknown"}, "192.168.178.55", "123.124.122.123", "kids"},
+		{"by CIDR", []string{"unknown"}, "10.1.1.1", "123.124.122.123", "kids"},
+		{"by wildcard name", []string{"laptop-1"}, "192.168.178.100", "123.124.122.123", "kids"},
+		{"default by IP", []string{"unknown"}, "192.168.178.100", "123.124.122.122", "default"},
+		{"default", []string{"laptop"}, "192.168.178.25", "123.124.122.122", "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := sut.Resolve(&Request{
+				ClientNames: tt.clientNames,
+				ClientIP:    net.ParseIP(tt.clientIP),
+				Req:         util.NewMsgWithQuestion("example.com.", dns.TypeA),
+				Log:         logrus.NewEntry(logrus.New()),
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, "example.com.	123	IN	A	"+tt.answer, resp.Res.Answer[0].String())
+			assert.Regexp(t, "^RESOLVED \\("+tt.group+": .*:[0-9]+\\)$", resp.Reason)
+		})
+	}
+}
+
+func Test_Resolve_UpstreamGroups_OnlyDefault(t *testing.T) {
+	upstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, err := util.NewMsgWithAnswer("example.com 123 IN A 123.124.122.122")
+
+		assert.NoError(t, err)
+		return response
+	})
+
+	sut := NewUpstreamGroupsResolver(config.UpstreamConfig{ExternalResolvers: []config.Upstream{upstream}})
+
+	resp, err := sut.Resolve(&Request{
+		ClientIP: net.ParseIP("192.168.178.25"),
+		Req:      util.NewMsgWithQuestion("example.com.", dns.TypeA),
+		Log:      logrus.NewEntry(logrus.New()),
+	})
+
+	// without groups, the reason remains unchanged
+	assert.NoError(t, err)
+	assert.NotContains(t, resp.Reason, "default")
+
+	c := sut.Configuration()
+	assert.Len(t, c, 2)
+	assert.Equal(t, "upstream resolvers:", c[0])
+}
+
+func Test_Configuration_UpstreamGroups(t *testing.T) {
+	sut := NewUpstreamGroupsResolver(config.UpstreamConfig{
+		ExternalResolvers: []config.Upstream{{Host: "host1"}},
+		Groups:            map[string][]config.Upstream{"kids": {{Host: "host2"}}},
+		ClientGroups:      map[string]string{"kid-laptop": "kids"},
+	})
+
+	c := sut.Configuration()
+
+	assert.Len(t, c, 8)
+	assert.Equal(t, "group 'default':", c[0])
+	assert.Equal(t, "group 'kids':", c[3])
+	assert.Equal(t, "  kid-laptop = \"kids\"", c[7])
+}
+
+func Test_ReasonWithGroup(t *testing.T) {
+	assert.Equal(t, "RESOLVED (kids: udp:1.1.1.1:53)", reasonWithGroup("RESOLVED (udp:1.1.1.1:53)", "kids"))
+	assert.Equal(t, "RESOLVED (kids)", reasonWithGroup("RESOLVED", "kids"))
+}
+
+func Test_Resolve_UpstreamGroups_Cached(t *testing.T) {
+	upstream := func(answer string) config.Upstream {
+		return TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+			response, err := util.NewMsgWithAnswer("example.com 123 IN A " + answer)
+
+			assert.NoError(t, err)
+			return response
+		})
+	}
+
+	sut := Chain(NewCachingResolver(config.CachingConfig{}), NewUpstreamGroupsResolver(config.UpstreamConfig{
+		ExternalResolvers: []config.Upstream{upstream("123.124.122.122")},
+		Groups:            map[string][]config.Upstream{"kids": {upstream("123.124.122.123")}},
+		ClientGroups:      map[string]string{"kid-laptop": "kids"},
+	}))
+
+	resolve := func(clientName string) *Response {
+		resp, err := sut.Resolve(&Request{
+			ClientNames: []string{clientName},
+			ClientIP:    net.ParseIP("192.168.178.25"),
+			Req:         util.NewMsgWithQuestion("example.com.", dns.TypeA),
+			Log:         logrus.NewEntry(logrus.New()),
+		})
+		assert.NoError(t, err)
+
+		return resp
+	}
+
+	// first query of each client goes to the upstream of its group, second one is answered from the group's cache
+	for _, reason := range []string{"RESOLVED", "CACHED"} {
+		resp := resolve("kid-laptop")
+		assert.Equal(t, "123.124.122.123", resp.Res.Answer[0].(*dns.A).A.String())
+		assert.Contains(t, resp.Reason, reason)
+
+		resp = resolve("laptop")
+		assert.Equal(t, "123.124.122.122", resp.Res.Answer[0].(*dns.A).A.String())
+		assert.Contains(t, resp.Reason, reason)
+	}
+}
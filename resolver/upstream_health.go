@@ -0,0 +1,340 @@
+package resolver
+
+import (
+	"blocky/config"
+	"blocky/metrics"
+	"blocky/util"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// weight of the newest value in the moving averages of latency and error rate
+	healthSmoothingFactor = 0.2
+	// count of consecutive failures, after that the upstream will be excluded
+	failuresBeforeBackoff = 3
+	backoffBase           = 10 * time.Second
+	backoffMax            = 5 * time.Minute
+	// added to the latency for weight calculation, so fast upstreams don't get an extreme weight
+	latencyWeightOffsetMs = 10
+)
+
+// upstreamHealth wraps an upstream resolver and tracks its error rate and latency.
+// Upstreams which fail repeatedly will be excluded temporarily (exponential back-off)
+type upstreamHealth struct {
+	resolver Resolver
+	name     string
+
+	mu                  sync.RWMutex
+	avgLatencyMs        float64
+	errorRate           float64
+	consecutiveFailures int
+	disabledUntil       time.Time
+
+	metrics *upstreamMetrics
+}
+
+// upstreamMetrics contains prometheus gauges with the state of the upstreams
+type upstreamMetrics struct {
+	available *prometheus.GaugeVec
+	latency   *prometheus.GaugeVec
+	errorRate *prometheus.GaugeVec
+}
+
+// nolint:gochecknoglobals
+var (
+	sharedUpstreamMetrics     *upstreamMetrics
+	sharedUpstreamMetricsOnce sync.Once
+)
+
+// returns the gauges for all upstreams (of all groups), nil if metrics are disabled
+func newUpstreamMetrics() *upstreamMetrics {
+	if !metrics.IsEnabled() {
+		return nil
+	}
+
+	sharedUpstreamMetricsOnce.Do(func() {
+		m := &upstreamMetrics{
+			available: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "blocky_upstream_available",
+				Help: "1 if the upstream resolver is available, 0 if it is excluded after errors",
+			}, []string{"upstream"}),
+			latency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "blocky_upstream_latency_ms",
+				Help: "Moving average of the upstream resolver response time",
+			}, []string{"upstream"}),
+			errorRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "blocky_upstream_error_rate",
+				Help: "Moving average of the upstream resolver error rate (0 - 1)",
+			}, []string{"upstream"}),
+		}
+
+		metrics.RegisterMetric(m.available)
+		metrics.RegisterMetric(m.latency)
+		metrics.RegisterMetric(m.errorRate)
+
+		sharedUpstreamMetrics = m
+	})
+
+	return sharedUpstreamMetrics
+}
+
+// creates upstream resolvers with health tracking for the configured upstreams
+func createUpstreamHealths(upstreams []config.Upstream) []*upstreamHealth {
+	result := make([]*upstreamHealth, len(upstreams))
+	m := newUpstreamMetrics()
+
+	for i, u := range upstreams {
+		result[i] = newUpstreamHealth(NewUpstreamResolver(u), m)
+	}
+
+	return result
+}
+
+// resolves the request with the first upstream which returns an answer without error. Next upstream
+// will be used only if the previous one fails
+func resolveSequential(request *Request, upstreams []*upstreamHealth, prefix string) (*Response, error) {
+	logger := withPrefix(request.Log, prefix)
+
+	var collectedErrors []error
+
+	for _, u := range upstreams {
+		logger.WithField("resolver", u).Debug("delegating to resolver")
+
+		resp, err := u.Resolve(request)
+		if err == nil {
+			logger.WithFields(logrus.Fields{
+				"resolver": u,
+				"answer":   util.AnswerToString(resp.Res.Answer),
+			}).Debug("using response from resolver")
+
+			return resp, nil
+		}
+
+		logger.WithField("resolver", u).Debug("resolution failed from resolver, cause: ", err)
+		collectedErrors = append(collectedErrors, err)
+	}
+
+	return nil, fmt.Errorf("resolution was not successful, errors: %v", collectedErrors)
+}
+
+// returns the configuration with the state of each upstream
+func upstreamsConfiguration(title string, upstreams []*upstreamHealth) (result []string) {
+	result = append(result, title)
+	for _, u := range upstreams {
+		result = append(result, fmt.Sprintf("- %s (%s)", u, u.state()))
+	}
+
+	return
+}
+
+func newUpstreamHealth(resolver Resolver, m *upstreamMetrics) *upstreamHealth {
+	u := &upstreamHealth{
+		resolver: resolver,
+		name:     fmt.Sprint(resolver),
+		metrics:  m,
+	}
+
+	u.updateMetrics()
+
+	return u
+}
+
+func (u *upstreamHealth) String() string {
+	return u.name
+}
+
+func (u *upstreamHealth) Configuration() []string {
+	return u.resolver.Configuration()
+}
+
+// Resolve delegates the request to the upstream and records the result
+func (u *upstreamHealth) Resolve(request *Request) (*Response, error) {
+	start := time.Now()
+
+	resp, err := u.resolver.Resolve(request)
+
+	u.record(time.Since(start), err)
+
+	return resp, err
+}
+
+// updates the averages and the back-off state with the result of one request
+func (u *upstreamHealth) record(duration time.Duration, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err != nil {
+		u.errorRate += healthSmoothingFactor * (1 - u.errorRate)
+		u.consecutiveFailures++
+
+		if u.consecutiveFailures >= failuresBeforeBackoff {
+			backoff := backoffBase << uint(u.consecutiveFailures-failuresBeforeBackoff)
+			if backoff > backoffMax || backoff <= 0 {
+				backoff = backoffMax
+			}
+
+			u.disabledUntil = time.Now().Add(backoff)
+
+			logger("upstream_health").WithFields(logrus.Fields{
+				"upstream": u.name,
+				"failures": u.consecutiveFailures,
+			}).Warnf("upstream resolver will be excluded for %s", backoff)
+		}
+	} else {
+		latencyMs := float64(duration.Milliseconds())
+		if u.avgLatencyMs == 0 {
+			u.avgLatencyMs = latencyMs
+		} else {
+			u.avgLatencyMs += healthSmoothingFactor * (latencyMs - u.avgLatencyMs)
+		}
+
+		u.errorRate -= healthSmoothingFactor * u.errorRate
+		u.consecutiveFailures = 0
+		u.disabledUntil = time.Time{}
+	}
+
+	u.updateMetricsLocked()
+}
+
+func (u *upstreamHealth) updateMetrics() {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	u.updateMetricsLocked()
+}
+
+func (u *upstreamHealth) updateMetricsLocked() {
+	if u.metrics == nil {
+		return
+	}
+
+	available := 1.0
+	if time.Now().Before(u.disabledUntil) {
+		available = 0
+	}
+
+	u.metrics.available.WithLabelValues(u.name).Set(available)
+	u.metrics.latency.WithLabelValues(u.name).Set(u.avgLatencyMs)
+	u.metrics.errorRate.WithLabelValues(u.name).Set(u.errorRate)
+}
+
+// returns true if the upstream is not excluded
+func (u *upstreamHealth) available() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return !time.Now().Before(u.disabledUntil)
+}
+
+func (u *upstreamHealth) excludedUntil() time.Time {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return u.disabledUntil
+}
+
+// returns the moving average of the response time, 0 if the upstream was not used yet
+func (u *upstreamHealth) latency() float64 {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return u.avgLatencyMs
+}
+
+// weight for the random selection: fast upstreams with low error rate have a higher weight
+func (u *upstreamHealth) weight() float64 {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return (1.05 - u.errorRate) * 1000 / (u.avgLatencyMs + latencyWeightOffsetMs)
+}
+
+// returns a description of the current state
+func (u *upstreamHealth) state() string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	state := "available"
+	if remaining := time.Until(u.disabledUntil); remaining > 0 {
+		state = fmt.Sprintf("excluded for %s after %d failures", remaining.Round(time.Second), u.consecutiveFailures)
+	}
+
+	return fmt.Sprintf("avg latency: %d ms, error rate: %d %%, %s",
+		int64(math.Round(u.avgLatencyMs)), int64(math.Round(u.errorRate*100)), state)
+}
+
+// picks count different upstreams, weighted by their latency and error rate. Excluded upstreams will be
+// only used, if not enough upstreams are available (the ones with the shortest remaining back-off first)
+func pickWeighted(upstreams []*upstreamHealth, count int) []*upstreamHealth {
+	available, excluded := partitionAvailable(upstreams)
+
+	result := make([]*upstreamHealth, 0, count)
+
+	for len(result) < count && len(available) > 0 {
+		var picked *upstreamHealth
+
+		picked, available = pickOneWeighted(available)
+		result = append(result, picked)
+	}
+
+	for i := 0; len(result) < count && i < len(excluded); i++ {
+		result = append(result, excluded[i])
+	}
+
+	return result
+}
+
+// splits the upstreams in available and excluded ones (sorted by the remaining back-off)
+func partitionAvailable(upstreams []*upstreamHealth) (available, excluded []*upstreamHealth) {
+	for _, u := range upstreams {
+		if u.available() {
+			available = append(available, u)
+		} else {
+			excluded = append(excluded, u)
+		}
+	}
+
+	sort.SliceStable(excluded, func(i, j int) bool {
+		return excluded[i].excludedUntil().Before(excluded[j].excludedUntil())
+	})
+
+	return available, excluded
+}
+
+// picks one upstream weighted random, returns it and the remaining upstreams
+func pickOneWeighted(upstreams []*upstreamHealth) (*upstreamHealth, []*upstreamHealth) {
+	weights := make([]float64, len(upstreams))
+
+	var total float64
+
+	for i, u := range upstreams {
+		weights[i] = u.weight()
+		total += weights[i]
+	}
+
+	idx := len(upstreams) - 1
+	x := rand.Float64() * total
+
+	for i, w := range weights {
+		if x < w {
+			idx = i
+			break
+		}
+
+		x -= w
+	}
+
+	remaining := make([]*upstreamHealth, 0, len(upstreams)-1)
+	remaining = append(remaining, upstreams[:idx]...)
+	remaining = append(remaining, upstreams[idx+1:]...)
+
+	return upstreams[idx], remaining
+}
@@ -0,0 +1,98 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_UpstreamHealth_Backoff(t *testing.T) {
+	m := &resolverMock{}
+	m.On("Resolve", mock.Anything).Return(nil, errors.New("timeout"))
+
+	sut := newUpstreamHealth(m, nil)
+
+	// first failures: still available
+	for i := 0; i < failuresBeforeBackoff-1; i++ {
+		_, _ = sut.Resolve(&Request{})
+		assert.True(t, sut.available())
+	}
+
+	_, _ = sut.Resolve(&Request{})
+	assert.False(t, sut.available())
+	assert.WithinDuration(t, time.Now().Add(backoffBase), sut.excludedUntil(), time.Second)
+	assert.Contains(t, sut.state(), "excluded for 10s after 3 failures")
+
+	// back-off doubles with each further failure
+	_, _ = sut.Resolve(&Request{})
+	assert.WithinDuration(t, time.Now().Add(2*backoffBase), sut.excludedUntil(), time.Second)
+
+	// max back-off
+	for i := 0; i < 20; i++ {
+		_, _ = sut.Resolve(&Request{})
+	}
+
+	assert.WithinDuration(t, time.Now().Add(backoffMax), sut.excludedUntil(), time.Second)
+
+	// success resets the back-off
+	sut.record(10*time.Millisecond, nil)
+	assert.True(t, sut.available())
+	assert.Equal(t, 0, sut.consecutiveFailures)
+}
+
+func Test_UpstreamHealth_Averages(t *testing.T) {
+	sut := newUpstreamHealth(&resolverMock{}, nil)
+
+	sut.record(100*time.Millisecond, nil)
+	assert.Equal(t, 100.0, sut.avgLatencyMs)
+	assert.Equal(t, 0.0, sut.errorRate)
+
+	sut.record(200*time.Millisecond, nil)
+	assert.Equal(t, 120.0, sut.avgLatencyMs)
+
+	sut.record(0, errors.New("error"))
+	assert.InDelta(t, 0.2, sut.errorRate, 0.001)
+	assert.Equal(t, 120.0, sut.avgLatencyMs)
+	assert.Equal(t, "avg latency: 120 ms, error rate: 20 %, available", sut.state())
+}
+
+func Test_PickWeighted_PrefersFastUpstreams(t *testing.T) {
+	fast := newUpstreamHealth(&resolverMock{}, nil)
+	fast.name = "fast"
+	fast.avgLatencyMs = 5
+
+	slow := newUpstreamHealth(&resolverMock{}, nil)
+	slow.name = "slow"
+	slow.avgLatencyMs = 500
+
+	counts := make(map[string]int)
+
+	for i := 0; i < 1000; i++ {
+		counts[pickWeighted([]*upstreamHealth{fast, slow}, 1)[0].name]++
+	}
+
+	assert.True(t, counts["fast"] > 900, fmt.Sprintf("fast upstream was picked %d times", counts["fast"]))
+	assert.True(t, counts["slow"] > 0)
+}
+
+func Test_PickWeighted_SkipsExcludedUpstreams(t *testing.T) {
+	upstreams := make([]*upstreamHealth, 3)
+	for i := range upstreams {
+		upstreams[i] = newUpstreamHealth(&resolverMock{}, nil)
+		upstreams[i].name = fmt.Sprintf("upstream%d", i)
+	}
+
+	upstreams[0].disabledUntil = time.Now().Add(time.Minute)
+	upstreams[1].disabledUntil = time.Now().Add(time.Hour)
+
+	for i := 0; i < 100; i++ {
+		picked := pickWeighted(upstreams, 2)
+
+		// only one upstream is available, the second one is the one with the shortest back-off
+		assert.Equal(t, []*upstreamHealth{upstreams[2], upstreams[0]}, picked)
+	}
+}
@@ -0,0 +1,27 @@
+package resolver
+
+import (
+	"blocky/config"
+	"strings"
+)
+
+const (
+	strategyParallelBest = "parallel_best"
+	strategyStrict       = "strict"
+	strategyRandom       = "random"
+	strategyFastest      = "fastest"
+)
+
+// NewUpstreamStrategyResolver creates the resolver for the configured upstream strategy
+func NewUpstreamStrategyResolver(cfg config.UpstreamConfig) Resolver {
+	switch strings.ToLower(cfg.Strategy) {
+	case strategyStrict:
+		return NewStrictResolver(cfg)
+	case strategyRandom:
+		return NewRandomResolver(cfg)
+	case strategyFastest:
+		return NewFastestResolver(cfg)
+	default:
+		return NewParallelBestResolver(cfg)
+	}
+}
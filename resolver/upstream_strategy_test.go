@@ -0,0 +1,47 @@
+package resolver
+
+import (
+	"blocky/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewUpstreamStrategyResolver(t *testing.T) {
+	upstreams := []config.Upstream{{Host: "host1"}, {Host: "host2"}}
+
+	assert.IsType(t, &ParallelBestResolver{}, NewUpstreamStrategyResolver(config.UpstreamConfig{ExternalResolvers: upstreams}))
+	assert.IsType(t, &ParallelBestResolver{}, NewUpstreamStrategyResolver(config.UpstreamConfig{
+		ExternalResolvers: upstreams, Strategy: "parallel_best"}))
+	assert.IsType(t, &StrictResolver{}, NewUpstreamStrategyResolver(config.UpstreamConfig{
+		ExternalResolvers: upstreams, Strategy: "strict"}))
+	assert.IsType(t, &RandomResolver{}, NewUpstreamStrategyResolver(config.UpstreamConfig{
+		ExternalResolvers: upstreams, Strategy: "Random"}))
+	assert.IsType(t, &FastestResolver{}, NewUpstreamStrategyResolver(config.UpstreamConfig{
+		ExternalResolvers: upstreams, Strategy: "fastest"}))
+}
+
+func Test_Configuration_UpstreamStrategyResolver(t *testing.T) {
+	tests := []struct {
+		strategy string
+		title    string
+	}{
+		{strategy: "strict", title: "upstream resolvers (strict order):"},
+		{strategy: "random", title: "upstream resolvers (random):"},
+		{strategy: "fastest", title: "upstream resolvers (fastest):"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			sut := NewUpstreamStrategyResolver(config.UpstreamConfig{
+				ExternalResolvers: []config.Upstream{{Host: "host1"}, {Host: "host2"}},
+				Strategy:          tt.strategy,
+			})
+
+			c := sut.Configuration()
+
+			assert.Len(t, c, 3)
+			assert.Equal(t, tt.title, c[0])
+		})
+	}
+}
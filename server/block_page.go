@@ -0,0 +1,110 @@
+package server
+
+import (
+	"blocky/config"
+	"blocky/resolver"
+	"blocky/web"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+// blockPage contains the values for the block page template
+type blockPage struct {
+	Domain   string
+	Group    string
+	Reason   string
+	AdminURL string
+}
+
+// nolint:gochecknoglobals
+var blockPageTmpl = template.Must(template.New("blockPage").Parse(web.BlockPageTmpl))
+
+func (s *Server) createBlockPageRouter() *chi.Mux {
+	router := chi.NewRouter()
+	router.HandleFunc("/*", s.blockPageHandler)
+
+	return router
+}
+
+// blockPageHandler shows the block page for all requests. Blocked domains point to blocky's IP (block type
+// with custom IP), so the requested host is the blocked domain
+func (s *Server) blockPageHandler(rw http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	page := blockPage{
+		Domain:   strings.ToLower(host),
+		AdminURL: s.blockPageAdminURL(req),
+	}
+
+	if blocking := s.blockingResolver(); blocking != nil {
+		if blocked, found := blocking.BlockedDomain(page.Domain); found {
+			page.Group = blocked.Group
+			page.Reason = blocked.Reason
+		}
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusForbidden)
+
+	if err := blockPageTmpl.Execute(rw, page); err != nil {
+		logrus.Error("can't write block page template: ", err)
+	}
+}
+
+// returns the configured admin URL or the URL of blocky's HTTP listener on the address the client connected to
+func (s *Server) blockPageAdminURL(req *http.Request) string {
+	cfg := s.currentCfg.Load().(*config.Config)
+	adminURL, httpPort := cfg.BlockPage.AdminURL, cfg.HTTPPort
+
+	if adminURL != "" || httpPort == 0 {
+		return adminURL
+	}
+
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			return fmt.Sprintf("http://%s/", net.JoinHostPort(host, fmt.Sprint(httpPort)))
+		}
+	}
+
+	return ""
+}
+
+// returns the blocking resolver of the current chain
+func (s *Server) blockingResolver() *resolver.BlockingResolver {
+	for res := s.resolver(); res != nil; res = nextResolver(res) {
+		if b, ok := res.(*resolver.BlockingResolver); ok {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// returns the query logging resolver of the current chain
+func (s *Server) queryLoggingResolver() *resolver.QueryLoggingResolver {
+	for res := s.resolver(); res != nil; res = nextResolver(res) {
+		if q, ok := res.(*resolver.QueryLoggingResolver); ok {
+			return q
+		}
+	}
+
+	return nil
+}
+
+// returns the next resolver of the chain or nil
+func nextResolver(r resolver.Resolver) resolver.Resolver {
+	if c, ok := r.(resolver.ChainedResolver); ok {
+		return c.GetNext()
+	}
+
+	return nil
+}
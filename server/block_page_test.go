@@ -0,0 +1,99 @@
+package server
+
+import (
+	"blocky/config"
+	"blocky/util"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BlockPage(t *testing.T) {
+	server, err := NewServer(&config.Config{
+		Blocking: config.BlockingConfig{
+			BlackLists: map[string][]string{
+				"ads": {"../testdata/doubleclick.net.txt"},
+			},
+			ClientGroupsBlock: map[string][]string{
+				"default": {"ads"},
+			},
+			BlockType: "192.168.178.100",
+		},
+		BlockPage: config.BlockPageConfig{AdminURL: "http://blocky.lan:4000/"},
+		Port:      55555,
+	})
+	assert.NoError(t, err)
+
+	// block the domain
+	resp, err := server.resolver().Resolve(createResolverRequest(&net.UDPAddr{IP: net.ParseIP("192.168.178.1")},
+		util.NewMsgWithQuestion("doubleclick.net.", dns.TypeA)))
+	assert.NoError(t, err)
+	assert.Equal(t, "doubleclick.net.\t21600\tIN\tA\t192.168.178.100", resp.Res.Answer[0].String())
+
+	// block page for the blocked domain
+	r, _ := http.NewRequest("GET", "/some/path", nil)
+	r.Host = "DoubleClick.net:80"
+	rr := httptest.NewRecorder()
+	server.blockPageMux.ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "<b>doubleclick.net</b>")
+	assert.Contains(t, rr.Body.String(), "Group: ads")
+	assert.Contains(t, rr.Body.String(), "Reason: BLOCKED (ads)")
+	assert.Contains(t, rr.Body.String(), `href="http://blocky.lan:4000/"`)
+
+	// unknown domain, host will be escaped
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Host = "<script>"
+	rr = httptest.NewRecorder()
+	server.blockPageMux.ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "<b>&lt;script&gt;</b>")
+	assert.NotContains(t, rr.Body.String(), "Reason:")
+}
+
+func Test_BlockPage_DefaultAdminURL(t *testing.T) {
+	server, err := NewServer(&config.Config{
+		Port: 55555,
+	})
+	assert.NoError(t, err)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Host = "blocked.com"
+
+	// without http listener: no link
+	assert.Equal(t, "", server.blockPageAdminURL(r))
+
+	// link to the http listener on the address the client connected to
+	server.cfg.HTTPPort = 4000
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey,
+		&net.TCPAddr{IP: net.ParseIP("192.168.178.2"), Port: 80}))
+	assert.Equal(t, "http://192.168.178.2:4000/", server.blockPageAdminURL(r))
+}
+
+func Test_BlockPage_DuringReload(t *testing.T) {
+	server, err := NewServer(&config.Config{
+		Port:      55555,
+		BlockPage: config.BlockPageConfig{AdminURL: "http://blocky.lan/"},
+	})
+	assert.NoError(t, err)
+
+	// a running reload (e.g. downloading the lists) must not block the block page
+	server.reloadMutex.Lock()
+	defer server.reloadMutex.Unlock()
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Host = "blocked.com"
+
+	rr := httptest.NewRecorder()
+	server.blockPageMux.ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "http://blocky.lan/")
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"blocky/api"
+	"blocky/resolver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// apiCacheStats is the http endpoint to get the item counts of the caches
+// @Summary Cache statistics
+// @Description returns the count of DNS cache entries (per query type) and of cached client names
+// @Tags cache
+// @Produce  json
+// @Success 200 {object} api.CacheStats "Returns the cache statistics"
+// @Router /cache/stats [get]
+func (s *Server) apiCacheStats(rw http.ResponseWriter, _ *http.Request) {
+	writeJSON(rw, resolver.CacheStats(s.resolver()))
+}
+
+// apiCacheLookup is the http endpoint to get the cached entries of a domain
+// @Summary Cache lookup
+// @Description returns the DNS cache entries of the domain (all query types)
+// @Tags cache
+// @Produce  json
+// @Param name query string true "domain"
+// @Success 200 {array} api.CacheEntry "Returns the cache entries of the domain"
+// @Failure 400   "Wrong parameter format"
+// @Router /cache/lookup [get]
+func (s *Server) apiCacheLookup(rw http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		http.Error(rw, "parameter 'name' is required", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(rw, resolver.LookupCache(s.resolver(), name))
+}
+
+// apiCacheDelete is the http endpoint to delete the cached entries of a domain
+// @Summary Delete cache entries
+// @Description deletes the DNS cache entries of the domain (all query types), optionally of all subdomains too
+// @Tags cache
+// @Produce  json
+// @Param name query string true "domain"
+// @Param subdomains query bool false "delete also entries of all subdomains"
+// @Success 200 {object} api.CacheDeleteResult "Returns the count of deleted entries"
+// @Failure 400   "Wrong parameter format"
+// @Router /cache/delete [post]
+func (s *Server) apiCacheDelete(rw http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		http.Error(rw, "parameter 'name' is required", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		withSubdomains bool
+		err            error
+	)
+
+	if param := req.URL.Query().Get("subdomains"); param != "" {
+		if withSubdomains, err = strconv.ParseBool(param); err != nil {
+			http.Error(rw, fmt.Sprintf("wrong value for parameter 'subdomains': %s", param), http.StatusBadRequest)
+			return
+		}
+	}
+
+	count := resolver.DeleteFromCache(s.resolver(), name, withSubdomains)
+
+	logger().Infof("deleted %d cache entries for '%s'", count, name)
+
+	writeJSON(rw, api.CacheDeleteResult{Deleted: count})
+}
+
+// apiCacheFlush is the http endpoint to flush the caches
+// @Summary Flush caches
+// @Description removes all entries from the DNS cache and the client name cache
+// @Tags cache
+// @Param cache query string false "flush only this cache (dns or clientNames)"
+// @Success 200   "Caches were flushed"
+// @Failure 400   "Wrong parameter format"
+// @Router /cache/flush [post]
+func (s *Server) apiCacheFlush(rw http.ResponseWriter, req *http.Request) {
+	dnsCache, clientNames := true, true
+
+	switch param := req.URL.Query().Get("cache"); param {
+	case "":
+	case "dns":
+		clientNames = false
+	case "clientNames":
+		dnsCache = false
+	default:
+		http.Error(rw, fmt.Sprintf("unknown cache '%s'", param), http.StatusBadRequest)
+		return
+	}
+
+	resolver.FlushCaches(s.resolver(), dnsCache, clientNames)
+
+	logger().Infof("flushed caches (DNS: %t, client names: %t)", dnsCache, clientNames)
+}
+
+func writeJSON(rw http.ResponseWriter, value interface{}) {
+	response, _ := json.Marshal(value)
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if _, err := rw.Write(response); err != nil {
+		logger().Error("unable to write response ", err)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"blocky/api"
+	"blocky/config"
+	"blocky/resolver"
+	"blocky/util"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CacheAPI(t *testing.T) {
+	upstream := resolver.TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		response, _ := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+
+		return response
+	})
+
+	server, err := NewServer(&config.Config{
+		Upstream: config.UpstreamConfig{ExternalResolvers: []config.Upstream{upstream}},
+		Port:     55555,
+	})
+	assert.NoError(t, err)
+
+	_, err = server.resolver().Resolve(createResolverRequest(&net.UDPAddr{IP: net.ParseIP("192.168.178.1")},
+		util.NewMsgWithQuestion("example.com.", dns.TypeA)))
+	assert.NoError(t, err)
+
+	call := func(handler http.HandlerFunc, method, url string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, url, nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, r)
+
+		return rr
+	}
+
+	t.Run("stats", func(t *testing.T) {
+		rr := call(server.apiCacheStats, "GET", api.CacheStatsPath)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var stats api.CacheStats
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&stats))
+		assert.Equal(t, 1, stats.ItemCount)
+		assert.Equal(t, 1, stats.ItemCountPerType["A"])
+		assert.Equal(t, 1, stats.ClientNamesItemCount)
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		rr := call(server.apiCacheLookup, "GET", api.CacheLookupPath+"?name=example.com")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var entries []api.CacheEntry
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&entries))
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "A (123.122.121.120)", entries[0].Answer)
+
+		rr = call(server.apiCacheLookup, "GET", api.CacheLookupPath)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		rr := call(server.apiCacheDelete, "POST", api.CacheDeletePath+"?name=com&subdomains=yes")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = call(server.apiCacheDelete, "POST", api.CacheDeletePath+"?name=com&subdomains=true")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var result api.CacheDeleteResult
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+		assert.Equal(t, 1, result.Deleted)
+		assert.Equal(t, 0, resolver.CacheStats(server.resolver()).ItemCount)
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		rr := call(server.apiCacheFlush, "POST", api.CacheFlushPath+"?cache=unknown")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = call(server.apiCacheFlush, "POST", api.CacheFlushPath+"?cache=clientNames")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, 0, resolver.CacheStats(server.resolver()).ClientNamesItemCount)
+	})
+}
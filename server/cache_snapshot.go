@@ -0,0 +1,58 @@
+package server
+
+import (
+	"blocky/resolver"
+	"time"
+)
+
+const defaultCacheSnapshotPeriod = time.Hour
+
+// restores the entries of the DNS and client name caches from the snapshot file
+func (s *Server) restoreCacheSnapshot() {
+	file := s.cfg.CacheSnapshot.File
+	if file == "" {
+		return
+	}
+
+	count, err := resolver.RestoreCacheSnapshot(file, s.resolver())
+	if err != nil {
+		logger().Warnf("can't restore cache snapshot from '%s': %v", file, err)
+		return
+	}
+
+	logger().Infof("restored %d cache entries from '%s'", count, file)
+}
+
+// writes the entries of the DNS and client name caches to the snapshot file
+func (s *Server) saveCacheSnapshot() {
+	s.reloadMutex.Lock()
+	file := s.cfg.CacheSnapshot.File
+	s.reloadMutex.Unlock()
+
+	if file == "" {
+		return
+	}
+
+	count, err := resolver.SaveCacheSnapshot(file, s.resolver())
+	if err != nil {
+		logger().Errorf("can't save cache snapshot to '%s': %v", file, err)
+		return
+	}
+
+	logger().Debugf("saved %d cache entries to '%s'", count, file)
+}
+
+// periodically writes the cache snapshot
+func (s *Server) periodicCacheSnapshot(period time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.saveCacheSnapshot()
+		case <-stop:
+			return
+		}
+	}
+}
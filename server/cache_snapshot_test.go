@@ -0,0 +1,60 @@
+package server
+
+import (
+	"blocky/config"
+	"blocky/resolver"
+	"blocky/util"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CacheSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocky")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	var upstreamCalls int32
+
+	upstream := resolver.TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+		atomic.AddInt32(&upstreamCalls, 1)
+		response, _ := util.NewMsgWithAnswer("example.com. 300 IN A 123.122.121.120")
+
+		return response
+	})
+
+	cfg := &config.Config{
+		Upstream:      config.UpstreamConfig{ExternalResolvers: []config.Upstream{upstream}},
+		CacheSnapshot: config.CacheSnapshotConfig{File: filepath.Join(dir, "cache.json")},
+		Port:          55555,
+	}
+
+	resolve := func(s *Server) string {
+		resp, err := s.resolver().Resolve(createResolverRequest(&net.UDPAddr{IP: net.ParseIP("192.168.178.1")},
+			util.NewMsgWithQuestion("example.com.", dns.TypeA)))
+		assert.NoError(t, err)
+
+		return resp.Reason
+	}
+
+	server, err := NewServer(cfg)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "CACHED", resolve(server))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&upstreamCalls))
+
+	// will be called on stop
+	server.saveCacheSnapshot()
+
+	// new server restores the cache from the snapshot
+	server, err = NewServer(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "CACHED", resolve(server))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&upstreamCalls))
+}
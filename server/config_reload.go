@@ -0,0 +1,229 @@
+package server
+
+import (
+	"blocky/config"
+	"blocky/resolver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	configWatchPeriod = 10 * time.Second
+	// replaced resolvers will be closed after this delay, requests in flight can still use them
+	replacedResolverCloseDelay = 30 * time.Second
+)
+
+// configuredResolver is a resolver of the chain with the config section it was created with
+type configuredResolver struct {
+	cfg      interface{}
+	resolver resolver.Resolver
+}
+
+// creates all resolvers of the chain. A resolver from the previous chain will be reused
+// (with its caches), if its config section was not changed. If a resolver can't be created, all new resolvers
+// will be closed and the error will be returned
+func createResolvers(cfg *config.Config, previous []configuredResolver) ([]configuredResolver, error) {
+	definitions := []struct {
+		cfg    interface{}
+		create func() (resolver.Resolver, error)
+	}{
+		{cfg.ClientLookup, func() (resolver.Resolver, error) {
+			return resolver.NewClientNamesResolver(cfg.ClientLookup), nil
+		}},
+		{cfg.QueryLog, func() (resolver.Resolver, error) {
+			return resolver.NewQueryLoggingResolver(cfg.QueryLog)
+		}},
+		{struct{}{}, func() (resolver.Resolver, error) {
+			return resolver.NewStatsResolver(), nil
+		}},
+		{cfg.Prometheus, func() (resolver.Resolver, error) {
+			return resolver.NewMetricsResolver(cfg.Prometheus), nil
+		}},
+		{cfg.Conditional, func() (resolver.Resolver, error) {
+			return resolver.NewConditionalUpstreamResolver(cfg.Conditional), nil
+		}},
+		{cfg.CustomDNS, func() (resolver.Resolver, error) {
+			return resolver.NewCustomDNSResolver(cfg.CustomDNS), nil
+		}},
+		{cfg.Blocking, func() (resolver.Resolver, error) {
+			return resolver.NewBlockingResolver(cfg.Blocking)
+		}},
+		{cfg.Caching, func() (resolver.Resolver, error) {
+			return resolver.NewCachingResolver(cfg.Caching), nil
+		}},
+		{cfg.Upstream, func() (resolver.Resolver, error) {
+			return resolver.NewUpstreamGroupsResolver(cfg.Upstream), nil
+		}},
+	}
+
+	result := make([]configuredResolver, len(definitions))
+
+	for i, d := range definitions {
+		if i < len(previous) && reflect.DeepEqual(previous[i].cfg, d.cfg) {
+			result[i] = previous[i]
+			continue
+		}
+
+		r, err := d.create()
+		if err != nil {
+			closeCreatedResolvers(result[:i], previous)
+
+			return nil, err
+		}
+
+		result[i] = configuredResolver{cfg: d.cfg, resolver: r}
+	}
+
+	return result, nil
+}
+
+// closes the resolvers, which were not reused from the previous chain
+func closeCreatedResolvers(created, previous []configuredResolver) {
+	for i, c := range created {
+		if i < len(previous) && previous[i].resolver == c.resolver {
+			continue
+		}
+
+		if closer, ok := c.resolver.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// chains all resolvers and returns the first one
+func chain(resolvers []configuredResolver) resolver.Resolver {
+	r := make([]resolver.Resolver, len(resolvers))
+	for i, res := range resolvers {
+		r[i] = res.resolver
+	}
+
+	return resolver.Chain(r...)
+}
+
+// returns the first resolver of the current chain
+func (s *Server) resolver() resolver.Resolver {
+	return s.queryResolver.Load().(resolver.Resolver)
+}
+
+// Reload reads the config file again and replaces all resolvers with changed configuration.
+// The current configuration will be kept, if the new one is not valid
+func (s *Server) Reload() error {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	if s.cfg.Path == "" {
+		return errors.New("config file path is not defined")
+	}
+
+	cfg, err := config.LoadConfig(s.cfg.Path)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Port != s.cfg.Port || cfg.HTTPPort != s.cfg.HTTPPort || cfg.HTTPSPort != s.cfg.HTTPSPort ||
+		cfg.TLSPort != s.cfg.TLSPort || cfg.CertFile != s.cfg.CertFile || cfg.KeyFile != s.cfg.KeyFile ||
+		cfg.BlockPage.Port != s.cfg.BlockPage.Port {
+		logger().Warn("changed listening ports and certificates will be applied after restart")
+
+		cfg.Port, cfg.HTTPPort, cfg.HTTPSPort, cfg.TLSPort = s.cfg.Port, s.cfg.HTTPPort, s.cfg.HTTPSPort, s.cfg.TLSPort
+		cfg.CertFile, cfg.KeyFile = s.cfg.CertFile, s.cfg.KeyFile
+		cfg.BlockPage.Port = s.cfg.BlockPage.Port
+	}
+
+	if cfg.CacheSnapshot != s.cfg.CacheSnapshot {
+		logger().Warn("changed cache snapshot config will be applied after restart")
+
+		cfg.CacheSnapshot = s.cfg.CacheSnapshot
+	}
+
+	if level, err := logrus.ParseLevel(cfg.LogLevel); err == nil {
+		logrus.SetLevel(level)
+	}
+
+	previous := s.resolvers
+
+	resolvers, err := createResolvers(&cfg, previous)
+	if err != nil {
+		return fmt.Errorf("can't create resolvers, keeping the current configuration: %v", err)
+	}
+
+	s.resolvers = resolvers
+	s.queryResolver.Store(chain(s.resolvers))
+	s.cfg = &cfg
+	s.currentCfg.Store(s.cfg)
+
+	// release resources of replaced resolvers, after the requests in flight were processed by the old chain
+	for i, p := range previous {
+		if p.resolver != s.resolvers[i].resolver {
+			logger().Infof("resolver '%s' was reconfigured", resolver.Name(p.resolver))
+
+			if c, ok := p.resolver.(io.Closer); ok {
+				time.AfterFunc(replacedResolverCloseDelay, func() {
+					_ = c.Close()
+				})
+			}
+		}
+	}
+
+	logger().Info("config reloaded")
+	s.printConfiguration()
+
+	return nil
+}
+
+// periodically checks the modification time of the config file and reloads the config on change
+func (s *Server) watchConfigFile(stop <-chan struct{}) {
+	ticker := time.NewTicker(configWatchPeriod)
+	defer ticker.Stop()
+
+	lastModTime := modTime(s.cfg.Path)
+
+	for {
+		select {
+		case <-ticker.C:
+			if t := modTime(s.cfg.Path); !t.Equal(lastModTime) {
+				lastModTime = t
+
+				logger().Info("config file was changed, reloading...")
+
+				if err := s.Reload(); err != nil {
+					logger().Error("can't reload config: ", err)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// apiConfigReload is the http endpoint to reload the configuration
+// @Summary Reload configuration
+// @Description reads the config file and replaces the resolvers with changed configuration
+// @Tags config
+// @Success 200   "Configuration was reloaded"
+// @Failure 500   "Configuration is not valid or can't be read"
+// @Router /config/reload [post]
+func (s *Server) apiConfigReload(rw http.ResponseWriter, _ *http.Request) {
+	logger().Info("reloading config...")
+
+	if err := s.Reload(); err != nil {
+		logger().Error("can't reload config: ", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
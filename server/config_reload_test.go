@@ -0,0 +1,172 @@
+package server
+
+import (
+	"blocky/api"
+	"blocky/config"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CreateResolvers_ReuseUnchanged(t *testing.T) {
+	cfg := &config.Config{
+		Caching: config.CachingConfig{MinCachingTime: 5},
+	}
+
+	first, err := createResolvers(cfg, nil)
+	assert.NoError(t, err)
+
+	changedCfg := &config.Config{
+		Caching:   config.CachingConfig{MinCachingTime: 10},
+		CustomDNS: cfg.CustomDNS,
+	}
+
+	second, err := createResolvers(changedCfg, first)
+	assert.NoError(t, err)
+
+	assert.Len(t, second, len(first))
+
+	for i := range first {
+		if i == 7 {
+			// caching resolver: config was changed
+			assert.True(t, first[i].resolver != second[i].resolver)
+		} else {
+			assert.True(t, first[i].resolver == second[i].resolver)
+		}
+	}
+}
+
+func Test_Reload(t *testing.T) {
+	file := writeConfigFile(t, testUpstreams+"customDNS:\n  mapping:\n    custom.lan: 192.168.178.55\nport: 55556\n")
+	defer os.Remove(file)
+
+	cfg, err := config.LoadConfig(file)
+	assert.NoError(t, err)
+
+	server, err := NewServer(&cfg)
+	assert.NoError(t, err)
+
+	oldResolvers := server.resolvers
+
+	// change the custom DNS mapping and the port
+	err = ioutil.WriteFile(file,
+		[]byte(testUpstreams+"customDNS:\n  mapping:\n    custom.lan: 192.168.178.56\nport: 55557\n"), 0600)
+	assert.NoError(t, err)
+
+	err = server.Reload()
+	assert.NoError(t, err)
+
+	assert.True(t, oldResolvers[5].resolver != server.resolvers[5].resolver)
+	assert.True(t, oldResolvers[7].resolver == server.resolvers[7].resolver)
+	assert.Equal(t, []string{"custom.lan = \"192.168.178.56\""}, server.resolvers[5].resolver.Configuration())
+
+	// port change needs restart
+	assert.Equal(t, uint16(55556), server.cfg.Port)
+
+	// invalid config: keep the current one
+	err = ioutil.WriteFile(file, []byte("logLevel: wrong\n"), 0600)
+	assert.NoError(t, err)
+
+	err = server.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"custom.lan = \"192.168.178.56\""}, server.resolvers[5].resolver.Configuration())
+}
+
+func Test_Reload_ResolverCreationFails(t *testing.T) {
+	file := writeConfigFile(t, testUpstreams+"customDNS:\n  mapping:\n    custom.lan: 192.168.178.55\nport: 55556\n")
+	defer os.Remove(file)
+
+	cfg, err := config.LoadConfig(file)
+	assert.NoError(t, err)
+
+	server, err := NewServer(&cfg)
+	assert.NoError(t, err)
+
+	oldResolvers := server.resolvers
+	oldChain := server.resolver()
+
+	// valid config, but the query log directory is not writable
+	err = ioutil.WriteFile(file, []byte(testUpstreams+"customDNS:\n  mapping:\n    custom.lan: 192.168.178.56\n"+
+		"queryLog:\n  dir: /not/existing/dir\nport: 55556\n"), 0600)
+	assert.NoError(t, err)
+
+	err = server.Reload()
+	assert.Error(t, err)
+
+	// the previous chain is still in place
+	assert.Equal(t, oldResolvers, server.resolvers)
+	assert.True(t, oldChain == server.resolver())
+	assert.Empty(t, server.cfg.QueryLog.Dir)
+	assert.Equal(t, []string{"custom.lan = \"192.168.178.55\""}, server.resolvers[5].resolver.Configuration())
+}
+
+func Test_Reload_APIEndpoints(t *testing.T) {
+	file := writeConfigFile(t,
+		testUpstreams+"blocking:\n  blackLists:\n    ads:\n      - ../testdata/doubleclick.net.txt\nport: 55556\n")
+	defer os.Remove(file)
+
+	cfg, err := config.LoadConfig(file)
+	assert.NoError(t, err)
+
+	server, err := NewServer(&cfg)
+	assert.NoError(t, err)
+
+	groups := func() (result []string) {
+		r, _ := http.NewRequest("GET", api.BlockingStatusPath, nil)
+		rr := httptest.NewRecorder()
+		server.httpMux.ServeHTTP(rr, r)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var status api.BlockingStatus
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&status))
+
+		for _, g := range status.Groups {
+			result = append(result, g.Name)
+		}
+
+		return result
+	}
+
+	assert.Equal(t, []string{"ads"}, groups())
+
+	err = ioutil.WriteFile(file,
+		[]byte(testUpstreams+"blocking:\n  blackLists:\n    special:\n      - ../testdata/doubleclick.net.txt\n"+
+			"port: 55556\n"), 0600)
+	assert.NoError(t, err)
+
+	assert.NoError(t, server.Reload())
+
+	// endpoint uses the new blocking resolver
+	assert.Equal(t, []string{"special"}, groups())
+}
+
+func Test_ApiConfigReload_WithoutFile(t *testing.T) {
+	server, err := NewServer(&config.Config{Port: 55556})
+	assert.NoError(t, err)
+
+	r, _ := http.NewRequest("POST", "/api/config/reload", nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(server.apiConfigReload).ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+const testUpstreams = "upstream:\n  externalResolvers:\n    - udp:1.1.1.1\n"
+
+func writeConfigFile(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "config*.yml")
+	assert.NoError(t, err)
+
+	defer f.Close()
+
+	_, err = f.WriteString(data)
+	assert.NoError(t, err)
+
+	return f.Name()
+}
@@ -7,8 +7,12 @@ import (
 	"blocky/metrics"
 	"blocky/resolver"
 	"blocky/web"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"html/template"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"syscall"
@@ -17,6 +21,8 @@ import (
 	"os/signal"
 	"runtime"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"blocky/util"
@@ -31,13 +37,29 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
+const (
+	dohPath        = "/dns-query"
+	dnsContentType = "application/dns-message"
+)
+
 type Server struct {
 	udpServer     *dns.Server
 	tcpServer     *dns.Server
+	tlsServer     *dns.Server
 	httpListener  net.Listener
-	queryResolver resolver.Resolver
+	httpsListener net.Listener
+	// optional listener for the block page
+	blockPageListener net.Listener
+	blockPageMux      *chi.Mux
+	// contains the first resolver of the chain, will be replaced on config reload
+	queryResolver atomic.Value
+	resolvers     []configuredResolver
 	cfg           *config.Config
+	currentCfg    atomic.Value // current config for readers, which must not wait for a running config reload
 	httpMux       *chi.Mux
+	reloadMutex   sync.Mutex
+	watcherStop   chan struct{}
+	snapshotStop  chan struct{}
 }
 
 func logger() *logrus.Entry {
@@ -64,7 +86,10 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		},
 	}
 
-	var httpListener net.Listener
+	var (
+		httpListener, httpsListener net.Listener
+		tlsServer                   *dns.Server
+	)
 
 	router := createRouter(cfg)
 
@@ -73,31 +98,74 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		if httpListener, err = net.Listen("tcp", fmt.Sprintf(":%d", cfg.HTTPPort)); err != nil {
 			logger().Fatalf("start http listener on port %d failed: %v", cfg.HTTPPort, err)
 		}
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load certificate files: %v", err)
+		}
+
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+
+		tlsServer = &dns.Server{
+			Addr:      fmt.Sprintf(":%d", cfg.TLSPort),
+			Net:       "tcp-tls",
+			Handler:   tcpHandler,
+			TLSConfig: tlsConfig,
+			NotifyStartedFunc: func() {
+				logger().Infof("tcp-tls server is up and running on port %d", cfg.TLSPort)
+			},
+		}
+
+		if cfg.HTTPSPort > 0 {
+			if httpsListener, err = tls.Listen("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), tlsConfig); err != nil {
+				logger().Fatalf("start https listener on port %d failed: %v", cfg.HTTPSPort, err)
+			}
+		}
+	}
 
+	if httpListener != nil || httpsListener != nil {
 		metrics.Start(router, cfg.Prometheus)
 	}
 
-	queryResolver := resolver.Chain(
-		resolver.NewClientNamesResolver(cfg.ClientLookup),
-		resolver.NewQueryLoggingResolver(cfg.QueryLog),
-		resolver.NewStatsResolver(),
-		resolver.NewMetricsResolver(cfg.Prometheus),
-		resolver.NewConditionalUpstreamResolver(cfg.Conditional),
-		resolver.NewCustomDNSResolver(cfg.CustomDNS),
-		resolver.NewBlockingResolver(router, cfg.Blocking),
-		resolver.NewCachingResolver(cfg.Caching),
-		resolver.NewParallelBestResolver(cfg.Upstream),
-	)
+	var blockPageListener net.Listener
+
+	if cfg.BlockPage.Port > 0 {
+		var err error
+		if blockPageListener, err = net.Listen("tcp", fmt.Sprintf(":%d", cfg.BlockPage.Port)); err != nil {
+			logger().Fatalf("start block page listener on port %d failed: %v", cfg.BlockPage.Port, err)
+		}
+	}
+
+	resolvers, err := createResolvers(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
 
 	server := Server{
 		udpServer:     udpServer,
 		tcpServer:     tcpServer,
-		queryResolver: queryResolver,
+		tlsServer:     tlsServer,
+		resolvers:     resolvers,
 		cfg:           cfg,
 		httpListener:  httpListener,
+		httpsListener: httpsListener,
 		httpMux:       router,
+
+		blockPageListener: blockPageListener,
 	}
 
+	server.blockPageMux = server.createBlockPageRouter()
+
+	server.queryResolver.Store(chain(resolvers))
+	server.currentCfg.Store(cfg)
+
+	server.restoreCacheSnapshot()
+
 	server.printConfiguration()
 
 	server.registerDNSHandlers(udpHandler)
@@ -213,7 +281,7 @@ func (s *Server) apiQuery(rw http.ResponseWriter, req *http.Request) {
 	dnsRequest := util.NewMsgWithQuestion(query, qType)
 	r := createResolverRequest(nil, dnsRequest)
 
-	response, err := s.queryResolver.Resolve(r)
+	response, err := s.resolver().Resolve(r)
 
 	if err != nil {
 		logger().Error("unable to process query: ", err)
@@ -241,7 +309,7 @@ func (s *Server) apiQuery(rw http.ResponseWriter, req *http.Request) {
 func (s *Server) printConfiguration() {
 	logger().Info("current configuration:")
 
-	res := s.queryResolver
+	res := s.resolver()
 	for res != nil {
 		logger().Infof("-> resolver: '%s'", resolver.Name(res))
 
@@ -259,6 +327,11 @@ func (s *Server) printConfiguration() {
 	logger().Infof("- DNS listening port: %d", s.cfg.Port)
 	logger().Infof("- HTTP listening port: %d", s.cfg.HTTPPort)
 
+	if s.tlsServer != nil {
+		logger().Infof("- DNS over TLS listening port: %d", s.cfg.TLSPort)
+		logger().Infof("- HTTPS listening port: %d", s.cfg.HTTPSPort)
+	}
+
 	logger().Info("runtime information:")
 
 	// force garbage collector
@@ -297,6 +370,14 @@ func (s *Server) Start() {
 		}
 	}()
 
+	if s.tlsServer != nil {
+		go func() {
+			if err := s.tlsServer.ListenAndServe(); err != nil {
+				logger().Fatalf("start %s listener failed: %v", s.tlsServer.Net, err)
+			}
+		}()
+	}
+
 	go func() {
 		if s.httpListener != nil {
 			logger().Infof("http server is up and running on port %d", s.cfg.HTTPPort)
@@ -307,13 +388,53 @@ func (s *Server) Start() {
 		}
 	}()
 
-	signals := make(chan os.Signal)
-	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		if s.httpsListener != nil {
+			logger().Infof("https server is up and running on port %d", s.cfg.HTTPSPort)
+
+			if err := http.Serve(s.httpsListener, s.httpMux); err != nil {
+				logger().Fatalf("start https listener failed: %v", err)
+			}
+		}
+	}()
+
+	go func() {
+		if s.blockPageListener != nil {
+			logger().Infof("block page server is up and running on port %d", s.cfg.BlockPage.Port)
+
+			if err := http.Serve(s.blockPageListener, s.blockPageMux); err != nil {
+				logger().Fatalf("start block page listener failed: %v", err)
+			}
+		}
+	}()
+
+	if s.cfg.Path != "" {
+		s.watcherStop = make(chan struct{})
+		go s.watchConfigFile(s.watcherStop)
+	}
+
+	if s.cfg.CacheSnapshot.File != "" && s.cfg.CacheSnapshot.Period >= 0 {
+		period := s.cfg.CacheSnapshot.Period
+		if period == 0 {
+			period = defaultCacheSnapshotPeriod
+		}
+
+		s.snapshotStop = make(chan struct{})
+		go s.periodicCacheSnapshot(period, s.snapshotStop)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGHUP)
 
 	go func() {
 		for {
-			<-signals
-			s.printConfiguration()
+			if sig := <-signals; sig == syscall.SIGHUP {
+				if err := s.Reload(); err != nil {
+					logger().Error("can't reload config: ", err)
+				}
+			} else {
+				s.printConfiguration()
+			}
 		}
 	}()
 }
@@ -328,6 +449,40 @@ func (s *Server) Stop() {
 	if err := s.tcpServer.Shutdown(); err != nil {
 		logger().Fatalf("stop %s listener failed: %v", s.tcpServer.Net, err)
 	}
+
+	if s.tlsServer != nil {
+		if err := s.tlsServer.Shutdown(); err != nil {
+			logger().Fatalf("stop %s listener failed: %v", s.tlsServer.Net, err)
+		}
+	}
+
+	if s.watcherStop != nil {
+		close(s.watcherStop)
+		s.watcherStop = nil
+	}
+
+	if s.snapshotStop != nil {
+		close(s.snapshotStop)
+		s.snapshotStop = nil
+	}
+
+	s.saveCacheSnapshot()
+
+	s.closeResolvers()
+}
+
+// releases the resources of all resolvers, pending query log entries will be written
+func (s *Server) closeResolvers() {
+	s.reloadMutex.Lock()
+	resolvers := s.resolvers
+	s.resolvers = nil
+	s.reloadMutex.Unlock()
+
+	for _, r := range resolvers {
+		if c, ok := r.resolver.(io.Closer); ok {
+			_ = c.Close()
+		}
+	}
 }
 
 func createResolverRequest(remoteAddress net.Addr, request *dns.Msg) *resolver.Request {
@@ -349,7 +504,7 @@ func (s *Server) OnRequest(w dns.ResponseWriter, request *dns.Msg) {
 
 	r := createResolverRequest(w.RemoteAddr(), request)
 
-	response, err := s.queryResolver.Resolve(r)
+	response, err := s.resolver().Resolve(r)
 
 	if err != nil {
 		logger().Errorf("error on processing request: %v", err)
@@ -376,6 +531,92 @@ func (s *Server) OnHealthCheck(w dns.ResponseWriter, request *dns.Msg) {
 
 func (s *Server) registerAPIEndpoints(router *chi.Mux) {
 	router.Post(api.BlockingQueryPath, s.apiQuery)
+	router.Post(api.ConfigReloadPath, s.apiConfigReload)
+	router.Get(api.CacheStatsPath, s.apiCacheStats)
+	router.Get(api.CacheLookupPath, s.apiCacheLookup)
+	router.Post(api.CacheDeletePath, s.apiCacheDelete)
+	router.Post(api.CacheFlushPath, s.apiCacheFlush)
+
+	resolver.RegisterBlockingAPIEndpoints(router, s.blockingResolver)
+	resolver.RegisterQueryLogAPIEndpoints(router, s.queryLoggingResolver)
+
+	router.Get(dohPath, s.dohGetRequestHandler)
+	router.Post(dohPath, s.dohPostRequestHandler)
+}
+
+// DNS over HTTPS (RFC 8484): handles GET request with base64url encoded DNS message in "dns" parameter
+func (s *Server) dohGetRequestHandler(rw http.ResponseWriter, req *http.Request) {
+	dnsParam := req.URL.Query().Get("dns")
+	if dnsParam == "" {
+		http.Error(rw, "dns param is missing", http.StatusBadRequest)
+		return
+	}
+
+	rawMsg, err := base64.RawURLEncoding.DecodeString(dnsParam)
+	if err != nil {
+		http.Error(rw, "wrong message format", http.StatusBadRequest)
+		return
+	}
+
+	s.processDohMessage(rawMsg, rw, req)
+}
+
+// DNS over HTTPS (RFC 8484): handles POST request with DNS message in body
+func (s *Server) dohPostRequestHandler(rw http.ResponseWriter, req *http.Request) {
+	if contentType := req.Header.Get("Content-Type"); contentType != dnsContentType {
+		http.Error(rw, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	rawMsg, err := ioutil.ReadAll(io.LimitReader(req.Body, dns.MaxMsgSize))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.processDohMessage(rawMsg, rw, req)
+}
+
+func (s *Server) processDohMessage(rawMsg []byte, rw http.ResponseWriter, httpReq *http.Request) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(rawMsg); err != nil {
+		logger().Error("can't deserialize message: ", err)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	var remoteAddr net.Addr
+
+	if host, _, err := net.SplitHostPort(httpReq.RemoteAddr); err == nil {
+		remoteAddr = &net.TCPAddr{IP: net.ParseIP(host)}
+	}
+
+	r := createResolverRequest(remoteAddr, msg)
+
+	response, err := s.resolver().Resolve(r)
+	if err != nil {
+		logger().Error("unable to process query: ", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	response.Res.MsgHdr.RecursionAvailable = msg.MsgHdr.RecursionDesired
+
+	b, err := response.Res.Pack()
+	if err != nil {
+		logger().Error("can't serialize message: ", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	rw.Header().Set("content-type", dnsContentType)
+
+	if _, err = rw.Write(b); err != nil {
+		logger().Error("can't write response: ", err)
+	}
 }
 
 func resolveClientIP(addr net.Addr) net.IP {
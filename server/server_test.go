@@ -4,9 +4,14 @@ import (
 	"blocky/config"
 	"blocky/resolver"
 	"blocky/util"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -196,13 +201,13 @@ func TestDnsRequest(t *testing.T) {
 	// create server
 	server, err := NewServer(&config.Config{
 		CustomDNS: config.CustomDNSConfig{
-			Mapping: map[string]net.IP{
-				"custom.lan": net.ParseIP("192.168.178.55"),
-				"lan.home":   net.ParseIP("192.168.178.56"),
+			Mapping: map[string]config.CustomDNSEntry{
+				"custom.lan": {IPs: []net.IP{net.ParseIP("192.168.178.55")}},
+				"lan.home":   {IPs: []net.IP{net.ParseIP("192.168.178.56")}},
 			},
 		},
 		Conditional: config.ConditionalUpstreamConfig{
-			Mapping: map[string]config.Upstream{"fritz.box": upstreamFritzbox},
+			Mapping: map[string]config.UpstreamList{"fritz.box": {upstreamFritzbox}},
 		},
 		Blocking: config.BlockingConfig{
 			BlackLists: map[string][]string{
@@ -247,7 +252,7 @@ func TestDnsRequest(t *testing.T) {
 	for _, tt := range tests {
 		tst := tt
 		t.Run(tt.name, func(t *testing.T) {
-			res := server.queryResolver
+			res := server.resolver()
 			for res != nil {
 				if t, ok := res.(*resolver.ClientNamesResolver); ok {
 					t.FlushCache()
@@ -278,9 +283,9 @@ func Test_Start(t *testing.T) {
 	// create server
 	server, err := NewServer(&config.Config{
 		CustomDNS: config.CustomDNSConfig{
-			Mapping: map[string]net.IP{
-				"custom.lan": net.ParseIP("192.168.178.55"),
-				"lan.home":   net.ParseIP("192.168.178.56"),
+			Mapping: map[string]config.CustomDNSEntry{
+				"custom.lan": {IPs: []net.IP{net.ParseIP("192.168.178.55")}},
+				"lan.home":   {IPs: []net.IP{net.ParseIP("192.168.178.56")}},
 			},
 		},
 
@@ -315,9 +320,9 @@ func Test_Stop(t *testing.T) {
 	// create server
 	server, err := NewServer(&config.Config{
 		CustomDNS: config.CustomDNSConfig{
-			Mapping: map[string]net.IP{
-				"custom.lan": net.ParseIP("192.168.178.55"),
-				"lan.home":   net.ParseIP("192.168.178.56"),
+			Mapping: map[string]config.CustomDNSEntry{
+				"custom.lan": {IPs: []net.IP{net.ParseIP("192.168.178.55")}},
+				"lan.home":   {IPs: []net.IP{net.ParseIP("192.168.178.56")}},
 			},
 		},
 
@@ -413,6 +418,117 @@ func requestServer(request *dns.Msg) *dns.Msg {
 	return nil
 }
 
+func Test_DNSOverTLS(t *testing.T) {
+	server, err := NewServer(&config.Config{
+		CustomDNS: config.CustomDNSConfig{
+			Mapping: map[string]config.CustomDNSEntry{
+				"custom.lan": {IPs: []net.IP{net.ParseIP("192.168.178.55")}},
+			},
+		},
+		CertFile: "../testdata/cert.pem",
+		KeyFile:  "../testdata/key.pem",
+		Port:     55555,
+		TLSPort:  55853,
+	})
+
+	assert.NoError(t, err)
+
+	go func() {
+		server.Start()
+	}()
+
+	defer server.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	client := &dns.Client{
+		Net: "tcp-tls",
+		// nolint:gosec
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	response, _, err := client.Exchange(util.NewMsgWithQuestion("custom.lan.", dns.TypeA), "127.0.0.1:55853")
+	assert.NoError(t, err)
+	assert.Equal(t, "custom.lan.\t3600\tIN\tA\t192.168.178.55", response.Answer[0].String())
+}
+
+func Test_NewServer_WrongCertificate(t *testing.T) {
+	_, err := NewServer(&config.Config{
+		CertFile: "../testdata/notexisting.pem",
+		KeyFile:  "../testdata/key.pem",
+		Port:     55555,
+	})
+
+	assert.Error(t, err)
+}
+
+//nolint:funlen
+func Test_DNSOverHTTPS(t *testing.T) {
+	server, err := NewServer(&config.Config{
+		CustomDNS: config.CustomDNSConfig{
+			Mapping: map[string]config.CustomDNSEntry{
+				"custom.lan": {IPs: []net.IP{net.ParseIP("192.168.178.55")}},
+			},
+		},
+		Port: 55555,
+	})
+
+	assert.NoError(t, err)
+
+	rawMsg, err := util.NewMsgWithQuestion("custom.lan.", dns.TypeA).Pack()
+	assert.NoError(t, err)
+
+	validateResponse := func(rr *httptest.ResponseRecorder) {
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/dns-message", rr.Header().Get("content-type"))
+
+		msg := new(dns.Msg)
+		err := msg.Unpack(rr.Body.Bytes())
+		assert.NoError(t, err)
+		assert.Equal(t, "custom.lan.\t3600\tIN\tA\t192.168.178.55", msg.Answer[0].String())
+	}
+
+	// GET
+	r, _ := http.NewRequest("GET", "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(rawMsg), nil)
+	r.RemoteAddr = "192.168.178.1:12345"
+	rr := httptest.NewRecorder()
+	server.httpMux.ServeHTTP(rr, r)
+	validateResponse(rr)
+
+	// POST
+	r, _ = http.NewRequest("POST", "/dns-query", bytes.NewReader(rawMsg))
+	r.Header.Set("Content-Type", "application/dns-message")
+	rr = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(rr, r)
+	validateResponse(rr)
+
+	// GET without parameter
+	r, _ = http.NewRequest("GET", "/dns-query", nil)
+	rr = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// GET with wrong encoding
+	r, _ = http.NewRequest("GET", "/dns-query?dns=!!!", nil)
+	rr = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// POST with wrong content type
+	r, _ = http.NewRequest("POST", "/dns-query", bytes.NewReader(rawMsg))
+	r.Header.Set("Content-Type", "text/plain")
+	rr = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+
+	// POST with wrong message
+	r, _ = http.NewRequest("POST", "/dns-query", bytes.NewReader([]byte("wrong")))
+	r.Header.Set("Content-Type", "application/dns-message")
+	rr = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
 func Test_ResolveClientIpUdp(t *testing.T) {
 	ip := resolveClientIP(&net.UDPAddr{IP: net.ParseIP("192.168.178.88")})
 	assert.Equal(t, net.ParseIP("192.168.178.88"), ip)
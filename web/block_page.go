@@ -0,0 +1,22 @@
+package web
+
+const BlockPageTmpl = `<!DOCTYPE html>
+<html>
+	<head>
+		<title>blocked by blocky</title>
+		<meta name="viewport" content="width=device-width, initial-scale=1">
+	</head>
+	<body>
+		<h1>This site is blocked</h1>
+		<p>The domain <b>{{.Domain}}</b> was blocked by blocky.</p>
+		{{if .Group}}
+		<p>Group: {{.Group}}</p>
+		{{end}}
+		{{if .Reason}}
+		<p>Reason: {{.Reason}}</p>
+		{{end}}
+		{{if .AdminURL}}
+		<p><a href="{{.AdminURL}}">blocky administration</a></p>
+		{{end}}
+	</body>
+</html>`